@@ -0,0 +1,82 @@
+//go:build !windows
+
+package atf
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Creates a test case with a single step executing given program; the
+// cleanup action always passes.
+func abortCase(name, script, args string) *TestCase {
+	return &TestCase{Name: name, Expected: "Pass",
+		Cleanup: CreateAction("true", ""),
+		Steps: []*TestStep{&TestStep{Name: "step", Expected: "Pass",
+			Action: CreateAction(script, args)}}}
+}
+
+func TestExecuteAbort(t *testing.T) {
+	tests := []struct {
+		name        string
+		skipCleanup bool
+		cleanup     TestResult // the result of the aborted case's cleanup
+	}{
+		{"cleanup executed", false, "Pass"},
+		{"cleanup skipped", true, "NotTested"},
+	}
+	for _, test := range tests {
+		ts := &TestSet{Name: "set", Cases: []*TestCase{
+			abortCase("a", "true", ""),
+			abortCase("b", "sleep", "10"),
+			abortCase("c", "true", "")}}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if test.skipCleanup {
+			ctx = SkipCleanupOnAbort(ctx)
+		}
+
+		// abort while the step of the second case is running
+		events := NewEventBus()
+		skipped := make(map[string]string)
+		aborted := false
+		events.Subscribe(SubscriberFunc(func(e Event) {
+			switch ev := e.(type) {
+			case *StepStarted:
+				if ev.Case.Name == "b" {
+					time.AfterFunc(100*time.Millisecond, cancel)
+				}
+			case *CaseSkipped:
+				skipped[ev.Case.Name] = ev.Reason
+			case *SetFinished:
+				aborted = ev.Aborted
+			}
+		}))
+		start := time.Now()
+		ts.Execute(ctx, events)
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%q: the running step was not killed (%s)", test.name,
+				elapsed)
+		}
+
+		for i, expected := range []TestResult{"Pass", "Fail", "NotTested"} {
+			tc := ts.Cases[i]
+			if tc.Status != expected {
+				t.Errorf("%q: case %q: got %s, expected %s", test.name,
+					tc.Name, tc.Status, expected)
+			}
+		}
+		if skipped["c"] != "aborted" || len(skipped) != 1 {
+			t.Errorf("%q: got skipped cases %v, expected c", test.name,
+				skipped)
+		}
+		if got := ts.Cases[1].Cleanup.Result; got != test.cleanup {
+			t.Errorf("%q: cleanup got %s, expected %s", test.name, got,
+				test.cleanup)
+		}
+		if !aborted {
+			t.Errorf("%q: the test set is not aborted", test.name)
+		}
+	}
+}
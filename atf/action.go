@@ -1,10 +1,12 @@
 package atf
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"strings"
+	"time"
 )
 
 // actioner interface
@@ -13,6 +15,9 @@ type Actioner interface {
 	IsManual() bool     /* is action Manual? */
 }
 
+// The placeholder script name of the empty (do-nothing) action.
+const emptyActionScript = "No action"
+
 // Represents a single action.
 // There are 3 types of actions:
 // - Automated action: this is the executable one (either script or executable
@@ -37,6 +42,9 @@ type Action struct {
 	// script execution output text
 	Output string
 
+	// script execution duration
+	Duration time.Duration
+
 	// description text, used mainly for manual actions
 	Description string
 
@@ -69,6 +77,13 @@ func (a *Action) Init() {
 
     // default result is always set to "not tested".
     a.Result = "NotTested"
+    a.setFlags()
+}
+
+// Determine the manual and executable flags from the contents of the Action.
+// Unlike Init(), this leaves the execution result intact, so it can be used
+// when actions are loaded back from a saved report.
+func (a *Action) setFlags() {
 
 	// initialy, action is neither executable not manual
 	a.executable = false
@@ -76,7 +91,7 @@ func (a *Action) Init() {
 
 	// if the action script is defined, action is executable
 	// we like executable actions, so we gave them precedence
-	if a.Script != "" {
+	if a.Script != "" && a.Script != emptyActionScript {
 		a.executable = true
 		a.manual = false
 	} else {
@@ -120,16 +135,20 @@ func (a *Action) Json() (string, error) {
 // are reset, that action is considered an empty (do-nothing) action.
 // If we deal with non-executable action, 'description' is simply copied to
 // 'output' field. Also, 'success' has a meaning only if action is executed;
-// if not, 'Result' is always set to "not tested".
-func (a *Action) Execute() string {
+// if not, 'Result' is always set to "not tested". When the context is
+// cancelled, the executed script/program is killed and the action fails.
+func (a *Action) Execute(ctx context.Context) string {
 
 	a.Result = "NotTested" // we assume neutral status
+	a.Duration = 0
 
 	// We execute the action only if it's marked executable
 	if a.IsExecutable() {
 
 		var err error
-		a.Output, err = Execute(a.Script, strings.Split(a.Args, " "))
+		start := time.Now()
+		a.Output, err = Execute(ctx, a.Script, strings.Split(a.Args, " "))
+		a.Duration = time.Since(start)
 
 		// if error has accured, script has failed; otherwise, it's OK
 		if err != nil {
@@ -150,7 +169,7 @@ func (a *Action) Execute() string {
 // The 'Result' flag is set to 'NotTested' by default. The 'description' field 
 // has no special meaning with automated action.
 func CreateAction(script string, args string) *Action {
-	return &Action{script, args, "NotTested", "", "", true, false}
+	return &Action{script, args, "NotTested", "", 0, "", true, false}
 }
 
 // Create a manual action.
@@ -159,7 +178,7 @@ func CreateAction(script string, args string) *Action {
 // The 'manual' flag is set and 'executable' flag is reset.
 // Since this action is not executable, the success is set to "not tested".
 func CreateManualAction(descr string) *Action {
-	return &Action{"", "", "NotTested", "", descr, false, true}
+	return &Action{"", "", "NotTested", "", 0, descr, false, true}
 }
 
 // Create empty (do-nothing) action.
@@ -167,5 +186,27 @@ func CreateManualAction(descr string) *Action {
 // apropriately: only flags are actually needed. The 'manual' and 'executable'
 // flags are reset, 'success' flag is set to "not tested".
 func CreateEmptyAction() *Action {
-	return &Action{ "No action", "", "NotTested", "", "", false, false }
+	return &Action{ emptyActionScript, "", "NotTested", "", 0, "", false, false }
+}
+
+// Execute the setup or cleanup action (given by role) of the test set (when
+// the test case is nil) or the test case, publishing the progress onto the
+// event bus. Returns false when the action is not defined (or it is not
+// executable).
+func executeAction(ctx context.Context, tc *TestCase, role string, a *Action,
+	events *EventBus) bool {
+
+	if a == nil || !a.IsExecutable() {
+		events.Message("notice", fmt.Sprintf("%s%s action is not defined.\n",
+			strings.ToUpper(role[:1]), role[1:]))
+		return false
+	}
+	events.Publish(&ActionStarted{Case: tc, Role: role, Action: a})
+	ctx = WithLineHandler(ctx, func(line string) {
+		events.Publish(&ActionOutput{Case: tc, Role: role, Line: line})
+	})
+	output := a.Execute(ctx)
+	events.Publish(&ActionFinished{Case: tc, Role: role, Action: a,
+		Result: a.Result, Duration: a.Duration, Output: output})
+	return true
 }
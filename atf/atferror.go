@@ -13,6 +13,12 @@ const (
 	ATFError_Invalid_Value // substitute for EINVAL
 	ATFError_Unknown_Report_Type
 	ATFError_Invalid_Test_Result
+	ATFError_User_Not_Found
+	ATFError_User_Exists
+	ATFError_Authentication_Failed
+	ATFError_Token_Not_Found
+	ATFError_Permission_Denied
+	ATFError_Unknown_Config_Type
 )
 
 // implementing the 'error' interface
@@ -27,6 +33,18 @@ func (e AtfError) Error() string {
 		msg = "Unknown report type"
 	case ATFError_Invalid_Test_Result:
 		msg = "Invalid test result value"
+	case ATFError_User_Not_Found:
+		msg = "User not found"
+	case ATFError_User_Exists:
+		msg = "User already exists"
+	case ATFError_Authentication_Failed:
+		msg = "Authentication failed"
+	case ATFError_Token_Not_Found:
+		msg = "API token not found"
+	case ATFError_Permission_Denied:
+		msg = "Permission denied"
+	case ATFError_Unknown_Config_Type:
+		msg = "Unknown configuration file type"
 	}
 	return msg
 }
@@ -0,0 +1,276 @@
+/*
+ * audit.go - implementation of the audit log
+ *
+ * The audit log records who ran, edited and signed off the test results. It
+ * is an append-only file in the root of the working directories, one
+ * JSON-encoded entry per line. The entries are hash-chained: every entry
+ * contains the hash of the previous one and its own hash, so removing,
+ * inserting or modifying any of the entries breaks the chain. The entries
+ * also record the hashes of the report files they refer to, so tampering with
+ * the historical reports is detected, too (see Verify()).
+ */
+
+package atf
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The default name of the audit log file.
+const AuditFilename = "audit.jsonl"
+
+// The actions recorded into the audit log.
+const (
+	AuditRunStarted  = "run.started"
+	AuditRunFinished = "run.finished"
+	AuditMerged      = "report.merged"
+	AuditRegenerated = "report.regenerated"
+	AuditVerdict     = "step.verdict"
+)
+
+// Represents a single entry of the audit log.
+type AuditEntry struct {
+
+	// the sequence number of the entry, starting with 1
+	Seq int
+
+	// when and by whom (and on which host) the action was performed
+	Time time.Time
+	User string
+	Host string `json:",omitempty"`
+
+	// the action (see Audit* constants) and its subject, e.g. the working
+	// directory of the run
+	Action  string
+	Subject string
+
+	// additional details of the action
+	Details map[string]string `json:",omitempty"`
+
+	// the hashes of the files (by path) produced by the action
+	Files map[string]string `json:",omitempty"`
+
+	// the hash of the previous entry (empty for the first one) and of this one
+	Prev string `json:",omitempty"`
+	Hash string
+}
+
+// Computes the hash of the entry; the Hash field itself is not included.
+func (e *AuditEntry) computeHash() string {
+	c := *e
+	c.Hash = ""
+	b, err := json.Marshal(&c)
+	if err != nil {
+		panic("Cannot marshal audit entry.") // cannot happen
+	}
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Returns the hash of the file contents; the same form is used for the
+// config files recorded in the reports.
+func HashFile(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Represents the audit log file.
+type AuditLog struct {
+	filename string
+	mutex    sync.Mutex
+}
+
+// The audit logs opened so far (by path): a single instance per file is
+// shared, so the appends within the process are serialized.
+var (
+	auditLogs      = make(map[string]*AuditLog)
+	auditLogsMutex sync.Mutex
+)
+
+// Opens the audit log in given directory; the file is created when the
+// first entry is appended. The same instance is returned for the same
+// directory.
+func OpenAuditLog(dir string) *AuditLog {
+	filename := path.Join(dir, AuditFilename)
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = filepath.ToSlash(abs)
+	}
+	auditLogsMutex.Lock()
+	defer auditLogsMutex.Unlock()
+	if l, found := auditLogs[filename]; found {
+		return l
+	}
+	l := &AuditLog{filename: filename}
+	auditLogs[filename] = l
+	return l
+}
+
+// Returns a plain text representation of the AuditLog instance.
+func (l *AuditLog) String() string {
+	return fmt.Sprintf("AuditLog: %q", l.filename)
+}
+
+// Reads all the entries of the audit log from the open file.
+func (l *AuditLog) read(f *os.File) ([]*AuditEntry, error) {
+	entries := make([]*AuditEntry, 0)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		e := new(AuditEntry)
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("line %d: damaged entry: %s", n, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Returns all the entries of the audit log.
+func (l *AuditLog) Entries() ([]*AuditEntry, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	f, err := os.Open(l.filename)
+	if os.IsNotExist(err) {
+		return make([]*AuditEntry, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// the other processes may be appending to the log right now
+	unlock, err := lockFile(f, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return l.read(f)
+}
+
+// Appends the entry to the audit log: the sequence number, the timestamp (if
+// not set) and the hashes are filled in. The files given in the entry (by
+// path) are hashed, too. The log file is locked while the last entry is read
+// and the new one is appended, so the chain is kept intact even when several
+// processes share the log.
+func (l *AuditLog) Append(e *AuditEntry, files ...string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err := os.MkdirAll(path.Dir(l.filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.filename, os.O_CREATE|os.O_RDWR|os.O_APPEND,
+		0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	unlock, err := lockFile(f, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := l.read(f)
+	if err != nil {
+		return err
+	}
+	e.Seq, e.Prev = 1, ""
+	if n := len(entries); n > 0 {
+		e.Seq, e.Prev = entries[n-1].Seq+1, entries[n-1].Hash
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	if len(files) > 0 {
+		e.Files = make(map[string]string)
+		for _, name := range files {
+			if e.Files[name], err = HashFile(name); err != nil {
+				return err
+			}
+		}
+	}
+	e.Hash = e.computeHash()
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Verifies the audit log: the hash chain must be intact and the files must
+// have the hashes recorded by the latest entries referring to them. Returns
+// the descriptions of the problems found (none, if the log is intact); the
+// error is returned only when the log cannot be read.
+func (l *AuditLog) Verify() ([]string, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+	problems := make([]string, 0)
+	prev, seq := "", 0
+	latest := make(map[string]string) // the latest hashes of the files
+	for _, e := range entries {
+		if e.Seq != seq+1 {
+			problems = append(problems, fmt.Sprintf(
+				"entry %d: sequence number gap, expected %d", e.Seq, seq+1))
+		}
+		seq = e.Seq
+		if e.Prev != prev {
+			problems = append(problems, fmt.Sprintf(
+				"entry %d: chain broken, the previous entry is missing or "+
+					"modified", e.Seq))
+		}
+		if e.computeHash() != e.Hash {
+			problems = append(problems, fmt.Sprintf(
+				"entry %d: hash mismatch, the entry has been modified", e.Seq))
+		}
+		prev = e.Hash
+		for name, hash := range e.Files {
+			latest[name] = hash
+		}
+	}
+
+	names := make([]string, 0, len(latest))
+	for name := range latest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		hash, err := HashFile(name)
+		switch {
+		case os.IsNotExist(err):
+			problems = append(problems, fmt.Sprintf("%s: file is missing",
+				name))
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %s", name, err))
+		case hash != latest[name]:
+			problems = append(problems, fmt.Sprintf(
+				"%s: file has been modified", name))
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,123 @@
+package atf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Creates the audit log with three entries in a new directory, the second
+// entry refers to the report file. Returns the log and the report filename.
+func auditFixture(t *testing.T) (*AuditLog, string) {
+	dir := t.TempDir()
+	report := filepath.Join(dir, "report.json")
+	if err := os.WriteFile(report, []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l := OpenAuditLog(filepath.Join(dir, "root"))
+	entries := []*AuditEntry{
+		&AuditEntry{User: "alice", Action: AuditRunStarted, Subject: "run"},
+		&AuditEntry{User: "alice", Action: AuditRunFinished, Subject: "run"},
+		&AuditEntry{User: "bob", Action: AuditVerdict, Subject: "run"},
+	}
+	for i, e := range entries {
+		files := []string{}
+		if i == 1 {
+			files = append(files, report)
+		}
+		if err := l.Append(e, files...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return l, report
+}
+
+// Rewrites the lines of the audit log file using given function.
+func editAuditLog(t *testing.T, l *AuditLog, edit func([]string) []string) {
+	b, err := os.ReadFile(l.filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	text := strings.Join(edit(lines), "\n") + "\n"
+	if err = os.WriteFile(l.filename, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditLogVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		tamper   func(t *testing.T, l *AuditLog, report string)
+		expected []string
+	}{
+		{"intact", func(*testing.T, *AuditLog, string) {}, nil},
+		{"modified entry", func(t *testing.T, l *AuditLog, _ string) {
+			editAuditLog(t, l, func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], `"alice"`, `"eve"`, 1)
+				return lines
+			})
+		}, []string{"entry 2: hash mismatch"}},
+		{"removed entry", func(t *testing.T, l *AuditLog, _ string) {
+			editAuditLog(t, l, func(lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			})
+		}, []string{"entry 3: sequence number gap", "entry 3: chain broken"}},
+		{"modified report", func(t *testing.T, _ *AuditLog, report string) {
+			os.WriteFile(report, []byte("{\"Aborted\":true}\n"), 0644)
+		}, []string{"file has been modified"}},
+		{"removed report", func(t *testing.T, _ *AuditLog, report string) {
+			os.Remove(report)
+		}, []string{"file is missing"}},
+	}
+	for _, test := range tests {
+		l, report := auditFixture(t)
+		test.tamper(t, l, report)
+		problems, err := l.Verify()
+		if err != nil {
+			t.Fatalf("%q: %s", test.name, err)
+		}
+		if len(problems) != len(test.expected) {
+			t.Errorf("%q: got %q, expected %q", test.name, problems,
+				test.expected)
+			continue
+		}
+		for i, p := range problems {
+			if !strings.Contains(p, test.expected[i]) {
+				t.Errorf("%q: got %q, expected %q", test.name, p,
+					test.expected[i])
+			}
+		}
+	}
+}
+
+func TestAuditLogConcurrentAppend(t *testing.T) {
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every append opens the log anew, as the commands do
+			e := &AuditEntry{User: "alice", Action: AuditRunStarted}
+			if err := OpenAuditLog(dir).Append(e); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	l := OpenAuditLog(dir)
+	problems, err := l.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("got %q, expected no problems", problems)
+	}
+	if entries, _ := l.Entries(); len(entries) != 20 {
+		t.Errorf("got %d entries, expected 20", len(entries))
+	}
+}
@@ -4,6 +4,7 @@
 package atf
 
 import (
+    "context"
     "fmt"
     "os"
     "path"
@@ -53,45 +54,45 @@ func testCollector() {
 func testExecutor()  {
     fmt.Println("#### EXEC ####")
     fmt.Println("excuting python script...")
-    output, err := Execute("d:/test/test.py",
+    output, err := Execute(context.Background(), "d:/test/test.py",
                             []string{})
     //output,_ := Execute("/home/miran/Code/go/hello/main", []string{""})
     fmt.Printf("### OUTPUT ###\n%s\n### END ###\n", output)
     //fmt.Println("Error code: " + err.String())
     fmt.Println("excuting perl script...")
-    output,_ = Execute("d:/test/test.pl",
+    output,_ = Execute(context.Background(), "d:/test/test.pl",
                            []string{})
     fmt.Printf("### OUTPUT ###\n%s\n### END ###\n", output)
     fmt.Println("excuting Tcl script...")
-    output,_ = Execute("d:/test/test.tcl",
+    output,_ = Execute(context.Background(), "d:/test/test.tcl",
                            []string{})
     fmt.Printf("### OUTPUT ###\n%s\n### END ###\n", output)
     fmt.Println("excuting Expect script...")
-    output, err = Execute("d:/test/test.exp", []string{})
+    output, err = Execute(context.Background(), "d:/test/test.exp", []string{})
     if err != nil { fmt.Println("expect script: ERROR", err) }
     fmt.Printf("### OUTPUT ###\n%s\n### END ###\n", output)
     fmt.Println("excuting native executable script...")
-    output, err = Execute("d:/test/uname", []string{"-a"})
+    output, err = Execute(context.Background(), "d:/test/uname", []string{"-a"})
     if err != nil { fmt.Println("native script: ERROR", err) }
     fmt.Printf("### OUTPUT ###\n%s\n### END ###\n", output)
     fmt.Println("excuting native executable script...")
-    output, err = Execute("d:/test/uname", []string{"--help"})
+    output, err = Execute(context.Background(), "d:/test/uname", []string{"--help"})
     if err != nil { fmt.Println("native script: ERROR", err) }
     fmt.Printf("### OUTPUT ###\n%s\n### END ###\n", output)
     fmt.Println("excuting native executable ...")
-    output, err = Execute("d:/test/uname", []string{})
+    output, err = Execute(context.Background(), "d:/test/uname", []string{})
     if err != nil { fmt.Println("native script: ERROR", err) }
     fmt.Printf("### OUTPUT ###\n%s\n### END ###\n", output)
     fmt.Println("excuting java JAR...")
-    output, err = Execute("d:/test/hello.jar", []string{})
+    output, err = Execute(context.Background(), "d:/test/hello.jar", []string{})
     if err != nil { fmt.Println("java executable: ERROR", err) }
     fmt.Printf("### OUTPUT ###\n%s\n### END ###\n", output)
     fmt.Println("excuting ruby script...")
-    output, err = Execute("d:/test/test.rb", []string{})
+    output, err = Execute(context.Background(), "d:/test/test.rb", []string{})
     if err != nil { fmt.Println("ruby script: ERROR", err) }
     fmt.Printf("### OUTPUT ###\n%s\n### END ###\n", output)
     fmt.Println("excuting groovy script...")
-    output, err = Execute("d:/test/test.groovy", []string{})
+    output, err = Execute(context.Background(), "d:/test/test.groovy", []string{})
     if err != nil { fmt.Println("groovy script: ERROR", err) }
     fmt.Printf("### OUTPUT ###\n%s\n### END ###\n", output)
  
@@ -14,6 +14,7 @@
  *                  had to change XML schema and add an <Action> tag
  *                  into <TestStep>
  *  3   May14   MR  A refactoring and simplification of the collector code
+ *  4   Oct26   MR  LoadTestSet() added: the collector errors are reported
  */
 
 package atf
@@ -77,13 +78,25 @@ func (c *TextCollector) Collect(pth string, ts *TestSet) error {
 // executed.
 func Collect(pth string) (ts *TestSet) {
 
-	// let's create empty TestSet
-	ts = new(TestSet)
+	// silently drop error: if 'ts' is 'nil', it is an error already...
+	ts, err := LoadTestSet(pth)
+	if err != nil {
+		return nil
+	}
+	// update flags for actions
+	ts.Initialize()
+	return
+}
+
+// Reads the test set config; the collector is resolved from the file
+// extension. Unlike Collect(), the errors are returned and the test set is not
+// initialized, so it can be validated or converted as it is written.
+func LoadTestSet(pth string) (*TestSet, error) {
 
 	// we need one of the Collectors to get test set data
 	var c Collector
 
-	// determine the type of config file and unmarshal the data into TestSet 
+	// determine the type of config file and unmarshal the data into TestSet
 	switch path.Ext(pth) {
 
 	case ".json":
@@ -95,14 +108,13 @@ func Collect(pth string) (ts *TestSet) {
 	case ".xml":
 		c = new(XmlCollector)
 
-    default:
-		return nil
+	default:
+		return nil, ATFError_Unknown_Config_Type
 	}
 
-	// now collect the test set structure and update flags for actions
-	c.Collect(pth, ts)
-    ts.Initialize()
-    // silently drop error: if 'ts' is 'nil', it is an error already...
-
-	return
+	ts := new(TestSet)
+	if err := c.Collect(pth, ts); err != nil {
+		return nil, err
+	}
+	return ts, nil
 }
@@ -0,0 +1,282 @@
+/*
+ * event.go - the structured execution event stream
+ *
+ * While the test set is executed, the progress is published as typed events:
+ * the start and the end of the test set, test cases, test steps and their
+ * actions, as well as the free-form messages. The events are delivered to any
+ * number of subscribers (loggers, reporters, live UIs, notifiers...) through
+ * the EventBus, so nobody needs to parse the log strings to follow the
+ * execution.
+ */
+
+package atf
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is an interface implemented by all the execution events.
+type Event interface {
+
+	// returns the name of the event kind, e.g. "CaseStarted"
+	Kind() string
+
+	// returns the timestamp when the event has been published
+	When() time.Time
+}
+
+// A common part of all the events: the event timestamp.
+type eventTime struct {
+	Time time.Time
+}
+
+// Returns the timestamp when the event has been published.
+func (e *eventTime) When() time.Time { return e.Time }
+
+// Sets the event timestamp.
+func (e *eventTime) stamp() { e.Time = time.Now() }
+
+// Published when the execution of the test set is started.
+type SetStarted struct {
+	eventTime
+	Set *TestSet
+}
+
+// Published when the execution of the test set is finished; Aborted is set
+// when the execution has been cancelled.
+type SetFinished struct {
+	eventTime
+	Set      *TestSet
+	Duration time.Duration
+	Aborted  bool
+}
+
+// Published when the execution of the test case is started.
+type CaseStarted struct {
+	eventTime
+	Case *TestCase
+}
+
+// Published when the test case is skipped (e.g. it has already been completed
+// by the previous, interrupted run).
+type CaseSkipped struct {
+	eventTime
+	Case   *TestCase
+	Reason string
+}
+
+// Published when the execution of the test case is finished and the case is
+// evaluated; Aborted is set when the execution has been cancelled while the
+// case was running (so its result is not reliable).
+type CaseFinished struct {
+	eventTime
+	Case     *TestCase
+	Result   TestResult
+	Duration time.Duration
+	Aborted  bool
+}
+
+// Published when the execution of the test step is started.
+type StepStarted struct {
+	eventTime
+	Case *TestCase
+	Step *TestStep
+}
+
+// Published when the execution of the test step is finished and the step is
+// evaluated.
+type StepFinished struct {
+	eventTime
+	Case     *TestCase
+	Step     *TestStep
+	Result   TestResult
+	Duration time.Duration
+	Output   string
+}
+
+// Published when the setup or cleanup action of the test set or test case is
+// started. The Case is nil for the test set actions; the Role is either
+// "setup" or "cleanup".
+type ActionStarted struct {
+	eventTime
+	Case   *TestCase
+	Role   string
+	Action *Action
+}
+
+// Published when the setup or cleanup action is finished.
+type ActionFinished struct {
+	eventTime
+	Case     *TestCase
+	Role     string
+	Action   *Action
+	Result   TestResult
+	Duration time.Duration
+	Output   string
+}
+
+// Published for every line of the action output as soon as it is produced.
+// The Step is nil for the setup and cleanup actions (the Role is set then),
+// and the Case is nil for the test set actions.
+type ActionOutput struct {
+	eventTime
+	Case *TestCase
+	Step *TestStep
+	Role string
+	Line string
+}
+
+// A free-form message about the execution; the severity is one of the
+// severity names used by the logger ("error", "warning", "notice", "info"...).
+type Message struct {
+	eventTime
+	Severity string
+	Text     string
+}
+
+func (e *SetStarted) Kind() string     { return "SetStarted" }
+func (e *SetFinished) Kind() string    { return "SetFinished" }
+func (e *CaseStarted) Kind() string    { return "CaseStarted" }
+func (e *CaseSkipped) Kind() string    { return "CaseSkipped" }
+func (e *CaseFinished) Kind() string   { return "CaseFinished" }
+func (e *StepStarted) Kind() string    { return "StepStarted" }
+func (e *StepFinished) Kind() string   { return "StepFinished" }
+func (e *ActionStarted) Kind() string  { return "ActionStarted" }
+func (e *ActionFinished) Kind() string { return "ActionFinished" }
+func (e *ActionOutput) Kind() string   { return "ActionOutput" }
+func (e *Message) Kind() string        { return "Message" }
+
+// Subscriber interface is implemented by everybody interested in the
+// execution events.
+type Subscriber interface {
+	HandleEvent(e Event)
+}
+
+// An adapter that allows an ordinary function to be used as a Subscriber.
+type SubscriberFunc func(e Event)
+
+// Calls the function; implements the Subscriber interface.
+func (f SubscriberFunc) HandleEvent(e Event) { f(e) }
+
+// EventBus delivers the published events to all the subscribers. The events
+// are delivered synchronously, in the order of subscription, so a subscriber
+// that needs the event to be persisted before the execution goes on (e.g.
+// the journal) can rely on it. A nil EventBus is valid and discards all the
+// events.
+type EventBus struct {
+	subscribers []Subscriber
+	mutex       sync.RWMutex
+}
+
+// Create a new, empty EventBus instance.
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make([]Subscriber, 0)}
+}
+
+// Add a subscriber to the bus.
+func (b *EventBus) Subscribe(s Subscriber) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.subscribers = append(b.subscribers, s)
+}
+
+// Remove the subscriber from the bus. Only the subscribers of comparable
+// types (e.g. pointers) can be removed; removing a SubscriberFunc panics.
+func (b *EventBus) Unsubscribe(s Subscriber) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	// the slice is copied, so the events being published are not affected
+	subscribers := make([]Subscriber, 0, len(b.subscribers))
+	for _, sub := range b.subscribers {
+		if sub != s {
+			subscribers = append(subscribers, sub)
+		}
+	}
+	b.subscribers = subscribers
+}
+
+// Publish the event to all the subscribers; the event timestamp is set when
+// it is published.
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if s, ok := e.(interface{ stamp() }); ok {
+		s.stamp()
+	}
+	b.mutex.RLock()
+	subscribers := b.subscribers
+	b.mutex.RUnlock()
+	for _, sub := range subscribers {
+		sub.HandleEvent(e)
+	}
+}
+
+// A convenience method that publishes the Message event.
+func (b *EventBus) Message(severity, text string) {
+	b.Publish(&Message{Severity: severity, Text: text})
+}
+
+// EventRecord is a flat, self-contained representation of the event, suitable
+// for encoding (e.g. for streaming the events to remote clients). Unlike the
+// events themselves, it holds no pointers to the live test set structures, so
+// it can be safely used after the execution has moved on.
+type EventRecord struct {
+	Kind     string
+	Time     time.Time
+	Set      string        `json:",omitempty"`
+	Case     string        `json:",omitempty"`
+	Step     string        `json:",omitempty"`
+	Role     string        `json:",omitempty"`
+	Result   TestResult    `json:",omitempty"`
+	Duration time.Duration `json:",omitempty"`
+	Output   string        `json:",omitempty"`
+	Line     string        `json:",omitempty"`
+	Severity string        `json:",omitempty"`
+	Text     string        `json:",omitempty"`
+	Reason   string        `json:",omitempty"`
+	Aborted  bool          `json:",omitempty"`
+}
+
+// Create a new EventRecord from the event.
+func NewEventRecord(e Event) *EventRecord {
+	r := &EventRecord{Kind: e.Kind(), Time: e.When()}
+	caseName := func(tc *TestCase) string {
+		if tc == nil {
+			return ""
+		}
+		return tc.Name
+	}
+	switch ev := e.(type) {
+	case *SetStarted:
+		r.Set = ev.Set.Name
+	case *SetFinished:
+		r.Set, r.Duration, r.Aborted = ev.Set.Name, ev.Duration, ev.Aborted
+	case *CaseStarted:
+		r.Case = ev.Case.Name
+	case *CaseSkipped:
+		r.Case, r.Reason = ev.Case.Name, ev.Reason
+	case *CaseFinished:
+		r.Case, r.Result, r.Duration = ev.Case.Name, ev.Result, ev.Duration
+		r.Aborted = ev.Aborted
+	case *StepStarted:
+		r.Case, r.Step = caseName(ev.Case), ev.Step.Name
+	case *StepFinished:
+		r.Case, r.Step = caseName(ev.Case), ev.Step.Name
+		r.Result, r.Duration, r.Output = ev.Result, ev.Duration, ev.Output
+	case *ActionStarted:
+		r.Case, r.Role = caseName(ev.Case), ev.Role
+	case *ActionFinished:
+		r.Case, r.Role = caseName(ev.Case), ev.Role
+		r.Result, r.Duration, r.Output = ev.Result, ev.Duration, ev.Output
+	case *ActionOutput:
+		r.Case, r.Role, r.Line = caseName(ev.Case), ev.Role, ev.Line
+		if ev.Step != nil {
+			r.Step = ev.Step.Name
+		}
+	case *Message:
+		r.Severity, r.Text = ev.Severity, ev.Text
+	}
+	return r
+}
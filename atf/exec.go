@@ -13,31 +13,87 @@
  * History:
  * 0.1  Apr10   MR  The first working version with limited testing 
  * 0.2  Mar12   MR  type ExecDisplayFnCback defined
+ * 0.3  Oct26   MR  ExecDisplayFnCback replaced by the execution events
+ * 0.4  Oct26   MR  execution can be cancelled through context.Context
+ * 0.5  Oct26   MR  output lines can be captured while the script is running
  */
 package atf
 
 import (
+	"bytes"
+	"context"
+	"os"
 	"os/exec"
 	//"fmt"
 	"path"
 	"runtime"
+	"strings"
+	"time"
 )
 
-/*
- * ExecDisplayFnCback -  This type is an alias for a closure that is used as a
- * parameter of Execute() method of the Executor interface (see below). It as
- * a callback function that mimics fmt.Printxy() functions to comment how the 
- * execution is proceeding; therefore more or less a log function.
- */
-type ExecDisplayFnCback func(...string)
-
-// Executor interface defining the Execute() method
+// Executor interface defining the Execute() method; the progress of the
+// execution is published as events onto the given bus (see event.go). When
+// the context is cancelled, the execution is aborted.
 type Executor interface {
-	Execute(ExecDisplayFnCback) string
+	Execute(ctx context.Context, events *EventBus)
 }
 
-// String constants defining different script/program executors
+// a private type for the context keys defined by this package
+type contextKey int
+
 const (
+	skipCleanupKey contextKey = iota
+	lineHandlerKey
+	sutLogKey
+	variablesKey
+)
+
+// LineHandler is a function that is called for every line of the output of
+// the script/program while it is running.
+type LineHandler func(line string)
+
+// Returns a copy of the context with the handler that receives the output
+// lines of the scripts/programs executed under this context as soon as they
+// are produced.
+func WithLineHandler(ctx context.Context, h LineHandler) context.Context {
+	return context.WithValue(ctx, lineHandlerKey, h)
+}
+
+// Returns a copy of the context with the variables passed to the scripts and
+// programs executed under this context as the environment variables.
+func WithVariables(ctx context.Context, vars map[string]string) context.Context {
+	return context.WithValue(ctx, variablesKey, vars)
+}
+
+// Returns a copy of the context under which the cleanup actions are skipped
+// when the execution is aborted. By default, the cleanup actions are executed
+// even after the execution has been aborted, so the test environment is left
+// in a sane state.
+func SkipCleanupOnAbort(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipCleanupKey, true)
+}
+
+// Returns the context for executing the cleanup actions: when the execution
+// has been aborted, the cleanup actions are still executed (unless disabled,
+// see SkipCleanupOnAbort()), but they cannot be cancelled anymore. The second
+// return value is false when the cleanup action should be skipped.
+func cleanupContext(ctx context.Context) (context.Context, bool) {
+	if ctx.Err() == nil {
+		return ctx, true
+	}
+	if skip, _ := ctx.Value(skipCleanupKey).(bool); skip {
+		return ctx, false
+	}
+	return context.WithoutCancel(ctx), true
+}
+
+// How long to wait for the output of the killed script/program; its children
+// may keep the output pipes open.
+const killWaitDelay = 2 * time.Second
+
+// Strings defining different script/program executors; they can be changed
+// using SetInterpreter().
+var (
 	pyExec     = "python"
 	plExec     = "perl"
 	tclExec    = "tclsh"
@@ -47,6 +103,37 @@ const (
 	groovyExec = "groovy"
 )
 
+// The script/program executors by language name.
+var interpreters = map[string]*string{
+	"python": &pyExec,
+	"perl":   &plExec,
+	"tcl":    &tclExec,
+	"expect": &expExec,
+	"java":   &javaExec,
+	"ruby":   &rubyExec,
+	"groovy": &groovyExec,
+}
+
+// Set the executor (interpreter) of the scripts in the given language, e.g.
+// "python" to "python3"; must not be called while the scripts are executed.
+func SetInterpreter(lang, exe string) error {
+	p, found := interpreters[strings.ToLower(lang)]
+	if !found || exe == "" {
+		return ATFError_Invalid_Value
+	}
+	*p = exe
+	return nil
+}
+
+// Returns the executors (interpreters) of the scripts by language name.
+func Interpreters() map[string]string {
+	m := make(map[string]string, len(interpreters))
+	for lang, p := range interpreters {
+		m[lang] = *p
+	}
+	return m
+}
+
 // Define some executable types as enum
 type ScriptType int
 const (
@@ -74,6 +161,8 @@ func FmtOutput(o string) string {
 // and returns the output and/or error code.
 //
 // Input:
+//       ctx - a context; when cancelled, the process (and its children) is
+//          killed
 //       exe - an interpreter for given script or program to be executed
 //      args - arguments to the interpreter as slice of string; the script 
 //          name is always included, of course. Any additional argument are to
@@ -82,7 +171,8 @@ func FmtOutput(o string) string {
 // eturns:
 //      output - is the text output from the executed script/program
 //         err - error code; if everything is OK, it should be nil
-func execute(exe string, args []string) (output string, err error) {
+func execute(ctx context.Context, exe string,
+	args []string) (output string, err error) {
 
 
 	output = ""
@@ -93,18 +183,65 @@ func execute(exe string, args []string) (output string, err error) {
     }
 
 	// prepare data for execution
-	cmd := exec.Command(exe, args...)
+	cmd := exec.CommandContext(ctx, exe, args...)
 	if cmd == nil {
 		return
 	}
+	killProcessGroup(cmd)
+	cmd.WaitDelay = killWaitDelay
+	if vars, _ := ctx.Value(variablesKey).(map[string]string); len(vars) > 0 {
+		cmd.Env = os.Environ()
+		for name, value := range vars {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
 
-    // run the command and wait for output text from STDIN and STDERR combined
-	var out []byte
-	out, err = cmd.CombinedOutput()
-	output = string(out)
+    // run the command and wait for output text from STDIN and STDERR combined;
+    // the lines are passed to the line handler (if any) as they are produced
+	h, _ := ctx.Value(lineHandlerKey).(LineHandler)
+	w := &lineWriter{handler: h}
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err = cmd.Run()
+	w.flush()
+	output = w.buf.String()
 	return
 }
 
+// An io.Writer that collects the complete output and passes every complete
+// line to the line handler. When used as both STDOUT and STDERR of the
+// command, the writes are serialized by os/exec.
+type lineWriter struct {
+	buf     bytes.Buffer
+	handler LineHandler
+	start   int // the start of the incomplete line in the buffer
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	if w.handler == nil {
+		return len(p), nil
+	}
+	b := w.buf.Bytes()
+	for {
+		i := bytes.IndexByte(b[w.start:], '\n')
+		if i < 0 {
+			break
+		}
+		w.handler(string(b[w.start : w.start+i]))
+		w.start += i + 1
+	}
+	return len(p), nil
+}
+
+// Passes the last incomplete line (if any) to the line handler.
+func (w *lineWriter) flush() {
+	if w.handler != nil && w.start < w.buf.Len() {
+		w.handler(string(w.buf.Bytes()[w.start:]))
+		w.start = w.buf.Len()
+	}
+}
+
 // A private function that prepares arguments for executing the JARs.   
 //
 // Input:
@@ -114,7 +251,8 @@ func execute(exe string, args []string) (output string, err error) {
 // Returns:
 //      out - is the text output from the executed script/program
 //      err - error code; if everything is OK, it should be nil
-func executeJava(jar string, args []string) (out string, err error) {
+func executeJava(ctx context.Context, jar string,
+	args []string) (out string, err error) {
 	realargs := make([]string, len(args)+3)
 	realargs[0] = "-jar"
 	realargs[1] = jar
@@ -123,7 +261,7 @@ func executeJava(jar string, args []string) (out string, err error) {
 			realargs[ix+3] = val
 		} // for
 	} // if
-	out, err = execute(javaExec, realargs)
+	out, err = execute(ctx, javaExec, realargs)
 	return out, err
 }
 
@@ -138,7 +276,8 @@ func executeJava(jar string, args []string) (out string, err error) {
 // Returns:
 //      out - is the text output from the executed script/program
 //      err - error code; if everything is OK, it should be nil
-func executeScript(exe string, script string, args []string) (out string, err error) {
+func executeScript(ctx context.Context, exe string, script string,
+	args []string) (out string, err error) {
 	// we need to insert an empty string before our args for python script to
 	// run properly
 	realargs := make([]string, len(args)+2)
@@ -148,7 +287,7 @@ func executeScript(exe string, script string, args []string) (out string, err er
 			realargs[ix+2] = val
 		} // for
 	} // if
-	out, err = execute(exe, realargs)
+	out, err = execute(ctx, exe, realargs)
 	return out, err
 }
 
@@ -191,38 +330,40 @@ func determineType(scr string) ScriptType {
 // (STDOUT & STDERR) and error code if something goes wrong.
 // 
 // Input:
+//         ctx - a context; when cancelled, the script/program is killed
 //      script - a python script to be run 
 //        args - additional arguments for the script as a slice of strings
 // 
 // Returns:
 //      output - is the text output from the executed script/program
 //         err - error code; if everything is OK, it should be nil
-func Execute(script string, args []string) (output string, err error) {
+func Execute(ctx context.Context, script string,
+	args []string) (output string, err error) {
 	var scrtype ScriptType
 	scrtype = determineType(script)
 	switch scrtype {
 	case PythonScript:
-		output, err = executeScript(pyExec, script, args)
+		output, err = executeScript(ctx, pyExec, script, args)
 	case PerlScript:
-		output, err = executeScript(plExec, script, args)
+		output, err = executeScript(ctx, plExec, script, args)
 	case TclScript:
-		output, err = executeScript(tclExec, script, args)
+		output, err = executeScript(ctx, tclExec, script, args)
 	case ExpectScript:
 		// if we execute the script on WinXY, expect scripts are treated as
 		// the TCL scripts; expect on Win is only a TCL extension, not the
 		// separate interpreter
 		if runtime.GOOS == "windows" {
-			output, err = executeScript(tclExec, script, args)
+			output, err = executeScript(ctx, tclExec, script, args)
 		}
-		output, err = executeScript(expExec, script, args)
+		output, err = executeScript(ctx, expExec, script, args)
 	case NativeExecutable:
-		output, err = execute(script, args)
+		output, err = execute(ctx, script, args)
 	case JavaExecutable:
-		output, err = executeJava(script, args)
+		output, err = executeJava(ctx, script, args)
 	case RubyScript:
-		output, err = executeScript(rubyExec, script, args)
+		output, err = executeScript(ctx, rubyExec, script, args)
 	case GroovyScript:
-		output, err = executeScript(groovyExec, script, args)
+		output, err = executeScript(ctx, groovyExec, script, args)
 	default:
 		output = "XXX: Invalid output"
 		err = ATFError_Invalid_Value
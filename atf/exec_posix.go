@@ -0,0 +1,22 @@
+//go:build !windows
+
+/*
+ * exec_posix.go - POSIX specific parts of the script/program executor
+ */
+
+package atf
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Starts the process in its own process group, so that the whole group (the
+// script and all the processes it has spawned) is killed when the execution
+// is cancelled; otherwise the children would be left orphaned.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,78 @@
+package atf
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestLineWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		writes   []string
+		expected []string
+	}{
+		{"complete lines", []string{"a\nb\n"}, []string{"a", "b"}},
+		{"split line", []string{"fir", "st\nsec", "ond\n"},
+			[]string{"first", "second"}},
+		{"incomplete last line", []string{"a\nb"}, []string{"a", "b"}},
+		{"empty lines", []string{"\n\na\n"}, []string{"", "", "a"}},
+		{"no output", []string{}, []string{}},
+	}
+	for _, test := range tests {
+		lines := make([]string, 0)
+		w := &lineWriter{handler: func(line string) {
+			lines = append(lines, line)
+		}}
+		output := ""
+		for _, s := range test.writes {
+			w.Write([]byte(s))
+			output += s
+		}
+		w.flush()
+		if len(lines) != len(test.expected) {
+			t.Errorf("%q: got %q, expected %q", test.name, lines,
+				test.expected)
+			continue
+		}
+		for i := range lines {
+			if lines[i] != test.expected[i] {
+				t.Errorf("%q: got %q, expected %q", test.name, lines,
+					test.expected)
+				break
+			}
+		}
+		// the complete output is still collected
+		if s := w.buf.String(); s != output {
+			t.Errorf("%q: got output %q, expected %q", test.name, s, output)
+		}
+	}
+}
+
+// The output lines are passed to the handler while the program is running,
+// not only after it has finished.
+func TestExecuteLineHandler(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no shell")
+	}
+	arrived := make(map[string]time.Duration)
+	start := time.Now()
+	ctx := WithLineHandler(context.Background(), func(line string) {
+		arrived[line] = time.Since(start)
+	})
+	output, err := execute(ctx, "sh",
+		[]string{"-c", "echo first; sleep 1; printf second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "first\nsecond" {
+		t.Errorf("got output %q", output)
+	}
+	if d, ok := arrived["first"]; !ok || d >= time.Second {
+		t.Errorf("first line: arrived after %s (%t)", d, ok)
+	}
+	if _, ok := arrived["second"]; !ok {
+		t.Errorf("incomplete last line not passed")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+/*
+ * exec_windows.go - Windows specific parts of the script/program executor
+ */
+
+package atf
+
+import (
+	"os/exec"
+)
+
+// On Windows, there are no process groups to kill; only the process itself
+// is killed when the execution is cancelled (the default behaviour).
+func killProcessGroup(cmd *exec.Cmd) {}
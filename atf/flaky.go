@@ -0,0 +1,153 @@
+/*
+ * flaky.go - detection of the flaky test cases and steps
+ *
+ * A test case (or step) is flaky when its status keeps changing between runs
+ * although the system under test stays the same. The flakiness score is the
+ * status flip rate over the last N runs against the same SUT version: 0 means
+ * the status has never changed, 1 means it has changed in every run. The runs
+ * are taken from the results history store (see history.go).
+ */
+
+package atf
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Represents the flakiness of a single test case or test step.
+type Flakiness struct {
+
+	// a name of the test set, the SUT version and the test case
+	TestSet    string
+	SutVersion string `json:",omitempty"`
+	Case       string
+
+	// a name of the test step; empty for test cases
+	Step string `json:",omitempty"`
+
+	// the number of considered runs and the number of status flips
+	Runs  int
+	Flips int
+
+	// the flip rate: flips / (runs - 1)
+	Score float64
+
+	// the status in the most recent run
+	LastStatus TestResult
+}
+
+// Returns a plain text representation of the Flakiness instance.
+func (f *Flakiness) String() string {
+	name := fmt.Sprintf("%s/%s", f.TestSet, f.Case)
+	if f.Step != "" {
+		name += "/" + f.Step
+	}
+	return fmt.Sprintf("%s [%s]: score=%.2f (%d flips in %d runs)", name,
+		f.SutVersion, f.Score, f.Flips, f.Runs)
+}
+
+// Returns the SUT version of the test report (empty if SUT is not defined).
+func sutVersion(tr *TestReport) string {
+	if tr.TestSet != nil && tr.TestSet.Sut != nil {
+		return tr.TestSet.Sut.Version
+	}
+	return ""
+}
+
+// Computes the flakiness of the test cases and test steps from the history
+// records (the aborted runs are not recorded there). The records are grouped
+// by test set name and SUT version; if the version is not empty, only the
+// records for that SUT version are considered. Only the last N runs (by their
+// start timestamps) are taken into account; if N is not positive, all runs
+// are. The result is ordered by the score, the flakiest first.
+func ComputeFlakiness(records []*HistoryRecord, version string,
+	last int) []*Flakiness {
+
+	sorted := make([]*HistoryRecord, 0, len(records))
+	for _, rec := range records {
+		if version != "" && rec.SutVersion != version {
+			continue
+		}
+		sorted = append(sorted, rec)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Started.Before(sorted[j].Started)
+	})
+
+	// collect the status histories of all the cases and steps
+	histories := make(map[Flakiness][]TestResult)
+	keys := make([]Flakiness, 0)
+	record := func(key Flakiness, status TestResult) {
+		if _, found := histories[key]; !found {
+			keys = append(keys, key)
+		}
+		histories[key] = append(histories[key], status)
+	}
+	for _, rec := range sorted {
+		for _, tc := range rec.Cases {
+			key := Flakiness{TestSet: rec.TestSet, SutVersion: rec.SutVersion,
+				Case: tc.Name}
+			record(key, tc.Status)
+			for _, step := range tc.Steps {
+				key.Step = step.Name
+				record(key, step.Status)
+			}
+		}
+	}
+
+	result := make([]*Flakiness, 0, len(keys))
+	for _, key := range keys {
+		statuses := histories[key]
+		if last > 0 && len(statuses) > last {
+			statuses = statuses[len(statuses)-last:]
+		}
+		f := key
+		f.Runs = len(statuses)
+		f.LastStatus = statuses[len(statuses)-1]
+		for i := 1; i < len(statuses); i++ {
+			if statuses[i] != statuses[i-1] {
+				f.Flips++
+			}
+		}
+		if f.Runs > 1 {
+			f.Score = float64(f.Flips) / float64(f.Runs-1)
+		}
+		result = append(result, &f)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Score > result[j].Score
+	})
+	return result
+}
+
+// Attaches the flakiness scores of the test cases to the report, so they are
+// displayed in the HTML report. Only the scores for the same test set and SUT
+// version are considered. If the threshold is positive, the cases whose score
+// is at least the threshold are quarantined: they are still executed, but
+// their failures are not taken into account by the exit status of the runner.
+// Returns the names of the quarantined test cases.
+func (tr *TestReport) SetFlakiness(scores []*Flakiness,
+	threshold float64) []string {
+
+	quarantined := make([]string, 0)
+	if tr.TestSet == nil {
+		return quarantined
+	}
+	tr.Flakiness = make(map[string]float64)
+	for _, f := range scores {
+		if f.Step != "" || f.TestSet != tr.Name() ||
+			f.SutVersion != sutVersion(tr) {
+			continue
+		}
+		tr.Flakiness[f.Case] = f.Score
+	}
+	for _, tc := range tr.TestSet.Cases {
+		score, found := tr.Flakiness[tc.Name]
+		if found && threshold > 0 && score >= threshold {
+			tc.Quarantined = true
+			quarantined = append(quarantined, tc.Name)
+		}
+	}
+	return quarantined
+}
@@ -0,0 +1,89 @@
+package atf
+
+import (
+	"testing"
+	"time"
+)
+
+// Creates the history records of the test set "set" against SUT version
+// "1.0", one record per status of the test case "a" (and its step).
+func flakyRecords(statuses ...TestResult) []*HistoryRecord {
+	start := time.Date(2026, 10, 26, 8, 0, 0, 0, time.UTC)
+	records := make([]*HistoryRecord, 0, len(statuses))
+	for i, status := range statuses {
+		ts := &TestSet{Name: "set", Sut: &SysUnderTest{Version: "1.0"},
+			Cases: []*TestCase{&TestCase{Name: "a", Status: status,
+				Steps: []*TestStep{&TestStep{Name: "s", Status: status}}}}}
+		tr := &TestReport{TestSet: ts,
+			Started: start.Add(time.Duration(i) * time.Hour)}
+		records = append(records, NewHistoryRecord(tr))
+	}
+	return records
+}
+
+func TestComputeFlakiness(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []*HistoryRecord
+		version string
+		last    int
+		runs    int
+		score   float64
+	}{
+		{"stable", flakyRecords("Pass", "Pass", "Pass"), "", 10, 3, 0},
+		{"flipping", flakyRecords("Pass", "Fail", "Pass"), "", 10, 3, 1},
+		{"once", flakyRecords("Pass", "Pass", "Fail", "Fail", "Fail"), "",
+			0, 5, 0.25},
+		{"last runs", flakyRecords("Pass", "Fail", "Pass", "Pass", "Pass"),
+			"", 3, 3, 0},
+		{"other version", flakyRecords("Pass", "Fail"), "2.0", 10, 0, 0},
+		{"same version", flakyRecords("Pass", "Fail"), "1.0", 10, 2, 1},
+	}
+	for _, test := range tests {
+		scores := ComputeFlakiness(test.records, test.version, test.last)
+		if test.runs == 0 {
+			if len(scores) != 0 {
+				t.Errorf("%q: got %d scores, expected none", test.name,
+					len(scores))
+			}
+			continue
+		}
+		// the test case and its step
+		if len(scores) != 2 {
+			t.Fatalf("%q: got %d scores, expected 2", test.name, len(scores))
+		}
+		for _, f := range scores {
+			if f.Runs != test.runs || f.Score != test.score {
+				t.Errorf("%q: %s: got %d runs, score %.2f, expected %d, %.2f",
+					test.name, f, f.Runs, f.Score, test.runs, test.score)
+			}
+		}
+	}
+}
+
+func TestSetFlakinessQuarantine(t *testing.T) {
+	scores := ComputeFlakiness(flakyRecords("Pass", "Fail", "Pass"), "1.0",
+		10)
+	tests := []struct {
+		threshold   float64
+		quarantined bool
+	}{
+		{0, false},
+		{0.5, true},
+		{1, true},
+	}
+	for _, test := range tests {
+		ts := &TestSet{Name: "set", Sut: &SysUnderTest{Version: "1.0"},
+			Cases: []*TestCase{&TestCase{Name: "a"}}}
+		report := &TestReport{TestSet: ts}
+		names := report.SetFlakiness(scores, test.threshold)
+		if got := len(names) == 1; got != test.quarantined {
+			t.Errorf("threshold %.1f: quarantined got %t, expected %t",
+				test.threshold, got, test.quarantined)
+		}
+		if report.Flakiness["a"] != 1 {
+			t.Errorf("threshold %.1f: got score %.2f, expected 1",
+				test.threshold, report.Flakiness["a"])
+		}
+	}
+}
@@ -0,0 +1,326 @@
+/*
+ * history.go - implementation of the results history store
+ *
+ * Every TestReport is a snapshot of a single run; the history store keeps the
+ * summaries of all the runs, so the trends can be queried: pass rate of a
+ * test case over time, the date of its last failure and the execution
+ * duration trends. The store is a simple embedded, file-based one: a single
+ * file in the root of the working directories, one JSON-encoded record per
+ * line, keyed by test set name, SUT name/version and start timestamp.
+ */
+
+package atf
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The default name of the history store file.
+const HistoryFilename = "history.jsonl"
+
+// Represents a result of a single test case in a history record.
+type HistoryCase struct {
+
+	// a name of the test case
+	Name string
+
+	// a final status of the test case
+	Status TestResult
+
+	// the execution duration of the test case (if known)
+	Duration time.Duration `json:",omitempty"`
+
+	// the results of the test steps (missing in the older records)
+	Steps []*HistoryStep `json:",omitempty"`
+}
+
+// Represents a result of a single test step in a history record.
+type HistoryStep struct {
+	Name   string
+	Status TestResult
+}
+
+// Represents a single run of a test set in the history store.
+type HistoryRecord struct {
+
+	// a name of the test set
+	TestSet string
+
+	// a name and version of the system under test (if defined)
+	SutName    string `json:",omitempty"`
+	SutVersion string `json:",omitempty"`
+
+	// execution start and finish timestamps
+	Started  time.Time
+	Finished time.Time
+
+	// the execution duration of the test set
+	Duration time.Duration
+
+	// the results of the test cases
+	Cases []*HistoryCase
+}
+
+// Create a new history record from the test report.
+func NewHistoryRecord(tr *TestReport) *HistoryRecord {
+	rec := &HistoryRecord{TestSet: tr.Name(), Started: tr.Started,
+		Finished: tr.Finished, Duration: tr.Duration()}
+	if tr.TestSet.Sut != nil {
+		rec.SutName = tr.TestSet.Sut.Name
+		rec.SutVersion = tr.TestSet.Sut.Version
+	}
+	for _, tc := range tr.TestSet.Cases {
+		c := &HistoryCase{Name: tc.Name, Status: tc.Status,
+			Duration: tc.Duration}
+		for _, step := range tc.Steps {
+			c.Steps = append(c.Steps, &HistoryStep{step.Name, step.Status})
+		}
+		rec.Cases = append(rec.Cases, c)
+	}
+	return rec
+}
+
+// Represents a query to the history store; empty fields match everything.
+type HistoryQuery struct {
+	TestSet    string
+	SutName    string
+	SutVersion string
+	Case       string
+
+	// only the records started at or after this timestamp are returned
+	Since time.Time
+}
+
+// Reports whether the record matches the query.
+func (q *HistoryQuery) matches(rec *HistoryRecord) bool {
+	switch {
+	case q.TestSet != "" && q.TestSet != rec.TestSet:
+		return false
+	case q.SutName != "" && q.SutName != rec.SutName:
+		return false
+	case q.SutVersion != "" && q.SutVersion != rec.SutVersion:
+		return false
+	case !q.Since.IsZero() && rec.Started.Before(q.Since):
+		return false
+	}
+	return true
+}
+
+// Represents the history store file.
+type HistoryStore struct {
+	filename string
+	mutex    sync.Mutex
+}
+
+// The history stores opened so far (by path): a single instance per file is
+// shared, so the access within the process is serialized (see OpenAuditLog()).
+var (
+	historyStores      = make(map[string]*HistoryStore)
+	historyStoresMutex sync.Mutex
+)
+
+// Opens the history store in given directory; the store file is created
+// when the first record is added. The same instance is returned for the same
+// directory.
+func OpenHistory(dir string) *HistoryStore {
+	filename := path.Join(dir, HistoryFilename)
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = filepath.ToSlash(abs)
+	}
+	historyStoresMutex.Lock()
+	defer historyStoresMutex.Unlock()
+	if h, found := historyStores[filename]; found {
+		return h
+	}
+	h := &HistoryStore{filename: filename}
+	historyStores[filename] = h
+	return h
+}
+
+// Returns a plain text representation of the HistoryStore instance.
+func (h *HistoryStore) String() string {
+	return fmt.Sprintf("HistoryStore: %q", h.filename)
+}
+
+// Adds the test report to the history store. The store file is locked while
+// the record is appended, so the records of several processes sharing the
+// store are not interleaved.
+func (h *HistoryStore) Add(tr *TestReport) error {
+	if tr.TestSet == nil {
+		return ATFError_Invalid_Value
+	}
+	b, err := json.Marshal(NewHistoryRecord(tr))
+	if err != nil {
+		return err
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if err := os.MkdirAll(path.Dir(h.filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(h.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND,
+		0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	unlock, err := lockFile(f, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Returns the records matching the query, ordered by their start timestamps.
+// When the query defines a test case, only that case is kept in the records.
+func (h *HistoryStore) Query(q *HistoryQuery) ([]*HistoryRecord, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	records := make([]*HistoryRecord, 0)
+	f, err := os.Open(h.filename)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// the other processes may be appending to the store right now
+	unlock, err := lockFile(f, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		rec := new(HistoryRecord)
+		if err := json.Unmarshal(scanner.Bytes(), rec); err != nil {
+			continue // skip damaged records
+		}
+		if !q.matches(rec) {
+			continue
+		}
+		if q.Case != "" {
+			cases := make([]*HistoryCase, 0, 1)
+			for _, c := range rec.Cases {
+				if c.Name == q.Case {
+					cases = append(cases, c)
+				}
+			}
+			if len(cases) == 0 {
+				continue
+			}
+			rec.Cases = cases
+		}
+		records = append(records, rec)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Started.Before(records[j].Started)
+	})
+	return records, scanner.Err()
+}
+
+// Represents the history of a single test case.
+type CaseTrend struct {
+
+	// a name of the test set and the test case
+	TestSet string
+	Case    string
+
+	// the number of runs and passes of the test case
+	Runs   int
+	Passed int
+
+	// the start timestamp of the last run where the test case failed; nil if
+	// it has never failed
+	LastFailure *time.Time `json:",omitempty"`
+
+	// the execution durations of the test case, from oldest to newest
+	Durations []time.Duration `json:",omitempty"`
+}
+
+// Returns the pass rate of the test case (0..1).
+func (c *CaseTrend) PassRate() float64 {
+	if c.Runs == 0 {
+		return 0
+	}
+	return float64(c.Passed) / float64(c.Runs)
+}
+
+// Returns the average execution duration of the test case.
+func (c *CaseTrend) AvgDuration() time.Duration {
+	if len(c.Durations) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, d := range c.Durations {
+		sum += d
+	}
+	return sum / time.Duration(len(c.Durations))
+}
+
+// Returns the duration of the most recent run of the test case.
+func (c *CaseTrend) LastDuration() time.Duration {
+	if len(c.Durations) == 0 {
+		return 0
+	}
+	return c.Durations[len(c.Durations)-1]
+}
+
+// Returns a plain text representation of the CaseTrend instance.
+func (c *CaseTrend) String() string {
+	last := "never"
+	if c.LastFailure != nil {
+		last = c.LastFailure.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%s/%s: runs=%d pass rate=%.1f%% last failure=%s",
+		c.TestSet, c.Case, c.Runs, 100*c.PassRate(), last)
+}
+
+// Computes the per-case trends from the history records. The records are
+// expected to be ordered by their start timestamps (as returned by Query()).
+// The trends are ordered by test set and test case names.
+func CaseTrends(records []*HistoryRecord) []*CaseTrend {
+	trends := make(map[string]*CaseTrend)
+	keys := make([]string, 0)
+	for _, rec := range records {
+		for _, c := range rec.Cases {
+			key := rec.TestSet + "/" + c.Name
+			t, found := trends[key]
+			if !found {
+				t = &CaseTrend{TestSet: rec.TestSet, Case: c.Name}
+				trends[key] = t
+				keys = append(keys, key)
+			}
+			t.Runs++
+			switch c.Status {
+			case "Pass":
+				t.Passed++
+			case "Fail":
+				started := rec.Started
+				t.LastFailure = &started
+			}
+			if c.Duration > 0 {
+				t.Durations = append(t.Durations, c.Duration)
+			}
+		}
+	}
+	sort.Strings(keys)
+	result := make([]*CaseTrend, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, trends[key])
+	}
+	return result
+}
@@ -0,0 +1,47 @@
+package atf
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistoryStoreConcurrentAdd(t *testing.T) {
+	dir := t.TempDir()
+	if OpenHistory(dir) != OpenHistory(dir+"/.") {
+		t.Errorf("the history store of the same directory is not shared")
+	}
+	start := time.Date(2026, 10, 26, 8, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ts := &TestSet{Name: "set", Cases: []*TestCase{&TestCase{
+				Name: fmt.Sprintf("case%02d", i), Status: "Pass"}}}
+			tr := &TestReport{TestSet: ts,
+				Started: start.Add(time.Duration(i) * time.Minute)}
+			// every run opens the store anew, as the runner does
+			if err := OpenHistory(dir).Add(tr); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	records, err := OpenHistory(dir).Query(&HistoryQuery{TestSet: "set"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 20 {
+		t.Fatalf("got %d records, expected 20", len(records))
+	}
+	for i, rec := range records {
+		name := fmt.Sprintf("case%02d", i)
+		if len(rec.Cases) != 1 || rec.Cases[0].Name != name {
+			t.Errorf("record %d: damaged or out of order, expected %q", i,
+				name)
+		}
+	}
+}
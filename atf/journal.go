@@ -0,0 +1,235 @@
+/*
+ * journal.go - implementation of the execution journal
+ *
+ * The TestReport lives only in memory until the execution is finished, so if
+ * the runner host crashes (or reboots) mid-run, all the progress is lost. The
+ * journal prevents that: every finished test step and test case is appended
+ * to the journal file (one JSON-encoded entry per line) as soon as it is
+ * finished. When the interrupted run is resumed, the journal is loaded back,
+ * the completed test cases are skipped and the execution continues with the
+ * rest of them.
+ */
+
+package atf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// The default name of the journal file in the working directory.
+const JournalFilename = "journal.jsonl"
+
+// The kinds of the journal entries.
+const (
+	journalStart = "start"
+	journalStep  = "step"
+	journalCase  = "case"
+)
+
+// Represents a single journal entry.
+type JournalEntry struct {
+
+	// a kind of entry: "start", "step" or "case"
+	Kind string
+
+	// a timestamp of the entry
+	Time time.Time
+
+	// the execution start timestamp and the input configuration file; used
+	// only for "start" entries
+	Started *time.Time `json:",omitempty"`
+	Input   string     `json:",omitempty"`
+
+	// a name of the test case that the finished step belongs to; used only
+	// for "step" entries
+	CaseName string `json:",omitempty"`
+
+	// a finished test step; used only for "step" entries
+	Step *TestStep `json:",omitempty"`
+
+	// a finished test case; used only for "case" entries
+	Case *TestCase `json:",omitempty"`
+}
+
+// Represents the journal file that the execution progress is written into.
+// Journal implements the Subscriber interface, so it can be directly
+// subscribed to the execution events.
+type Journal struct {
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// Opens the journal file for appending; if the file does not exist, it is
+// created. A truncated last line (left by the crashed run) is removed first,
+// so the resumed run does not append its entries to it.
+func OpenJournal(filename string) (*Journal, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = trimJournal(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Journal{file: f}, nil
+}
+
+// Truncates the journal file after its last complete line; the file is read
+// only when it does not end with a newline.
+func trimJournal(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	r, err := os.Open(f.Name())
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	last := make([]byte, 1)
+	if _, err = r.ReadAt(last, info.Size()-1); err != nil || last[0] == '\n' {
+		return err
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return f.Truncate(int64(bytes.LastIndexByte(b, '\n') + 1))
+}
+
+// Appends an entry to the journal. The file is synced after every entry, so
+// the entry survives the crash of the host.
+func (j *Journal) write(e *JournalEntry) error {
+	e.Time = time.Now()
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if _, err = j.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// Records the start of the execution.
+func (j *Journal) Start(started time.Time, input string) error {
+	return j.write(&JournalEntry{Kind: journalStart, Started: &started,
+		Input: input})
+}
+
+// Records the finished test steps and test cases; implements the Subscriber
+// interface.
+func (j *Journal) HandleEvent(e Event) {
+	switch ev := e.(type) {
+	case *StepFinished:
+		if ev.Case != nil {
+			j.write(&JournalEntry{Kind: journalStep, CaseName: ev.Case.Name,
+				Step: ev.Step})
+		}
+	case *CaseFinished:
+		// an aborted case is not completed: it is executed again on resume
+		if !ev.Aborted {
+			j.write(&JournalEntry{Kind: journalCase, Case: ev.Case})
+		}
+	}
+}
+
+// Close the journal file.
+func (j *Journal) Close() {
+	if j.file != nil {
+		j.file.Close()
+	}
+}
+
+// Represents the state of the execution as recorded in the journal.
+type JournalState struct {
+
+	// the execution start timestamp of the interrupted run
+	Started time.Time
+
+	// the input configuration file of the interrupted run
+	Input string
+
+	// completed test cases (by name)
+	Cases map[string]*TestCase
+
+	// finished steps of the test cases that have not been completed
+	Steps map[string][]*TestStep
+}
+
+// Loads the journal file and returns the recorded state of the execution. A
+// damaged last line (truncated when the host has crashed while writing) is
+// ignored; a damaged line anywhere else is an error, since the journal
+// cannot be trusted anymore.
+func LoadJournal(filename string) (*JournalState, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	state := &JournalState{Cases: make(map[string]*TestCase),
+		Steps: make(map[string][]*TestStep)}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	var damaged error // the damaged line, tolerated if it is the last one
+	for n := 1; scanner.Scan(); n++ {
+		if damaged != nil {
+			return nil, damaged
+		}
+		e := new(JournalEntry)
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			damaged = fmt.Errorf("%s: line %d: damaged entry: %s", filename,
+				n, err)
+			continue
+		}
+		switch e.Kind {
+		case journalStart:
+			// only the first start entry is relevant: resumed runs append
+			// their own entries into the same journal
+			if state.Started.IsZero() && e.Started != nil {
+				state.Started = *e.Started
+				state.Input = e.Input
+			}
+		case journalStep:
+			if e.Step != nil {
+				state.Steps[e.CaseName] = append(state.Steps[e.CaseName],
+					e.Step)
+			}
+		case journalCase:
+			if e.Case != nil {
+				state.Cases[e.Case.Name] = e.Case
+				delete(state.Steps, e.Case.Name)
+			}
+		}
+	}
+	return state, scanner.Err()
+}
+
+// Restore the results of the completed test cases from the journal state into
+// the test set: completed cases are replaced by their recorded versions and
+// are skipped when the test set is executed. Returns the number of restored
+// test cases.
+func (ts *TestSet) Resume(state *JournalState) int {
+	n := 0
+	for i, tc := range ts.Cases {
+		recorded, found := state.Cases[tc.Name]
+		if !found {
+			continue
+		}
+		ts.Cases[i] = recorded
+		recorded.completed = true
+		n++
+	}
+	ts.restoreFlags()
+	return n
+}
@@ -0,0 +1,154 @@
+package atf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadJournal(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), JournalFilename)
+	j, err := OpenJournal(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := time.Date(2026, 10, 26, 8, 30, 0, 0, time.UTC)
+	a := &TestCase{Name: "a", Status: "Pass",
+		Steps: []*TestStep{&TestStep{Name: "s1", Status: "Pass"}}}
+	b := &TestCase{Name: "b", Status: "Fail"}
+	c := &TestCase{Name: "c"}
+	if err = j.Start(started, "set.json"); err != nil {
+		t.Fatal(err)
+	}
+	j.HandleEvent(&StepFinished{Case: a, Step: a.Steps[0]})
+	j.HandleEvent(&CaseFinished{Case: a, Result: "Pass"})
+	j.HandleEvent(&CaseFinished{Case: b, Result: "Fail", Aborted: true})
+	j.HandleEvent(&StepFinished{Case: c,
+		Step: &TestStep{Name: "s1", Status: "Pass"}})
+	j.Close()
+
+	// the host crashed while writing the last entry
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"Kind":"case","Case":{"Name":"c","Sta`)
+	f.Close()
+
+	state, err := LoadJournal(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Started.Equal(started) || state.Input != "set.json" {
+		t.Errorf("got start %s %q, expected %s %q", state.Started,
+			state.Input, started, "set.json")
+	}
+	tests := []struct {
+		name      string
+		completed bool
+		steps     int
+	}{
+		{"a", true, 0},
+		{"b", false, 0},
+		{"c", false, 1},
+	}
+	for _, test := range tests {
+		if _, found := state.Cases[test.name]; found != test.completed {
+			t.Errorf("%q: completed got %t, expected %t", test.name, found,
+				test.completed)
+		}
+		if n := len(state.Steps[test.name]); n != test.steps {
+			t.Errorf("%q: got %d finished steps, expected %d", test.name, n,
+				test.steps)
+		}
+	}
+
+	ts := &TestSet{Name: "set", Cases: []*TestCase{&TestCase{Name: "a"},
+		&TestCase{Name: "b"}, &TestCase{Name: "c"}}}
+	if n := ts.Resume(state); n != 1 {
+		t.Errorf("Resume() got %d restored cases, expected 1", n)
+	}
+	for i, expected := range []bool{true, false, false} {
+		tc := ts.Cases[i]
+		if tc.completed != expected {
+			t.Errorf("%q: completed got %t, expected %t", tc.Name,
+				tc.completed, expected)
+		}
+	}
+	if ts.Cases[0].Status != "Pass" {
+		t.Errorf("%q: got status %q, expected %q", ts.Cases[0].Name,
+			ts.Cases[0].Status, "Pass")
+	}
+}
+
+func TestLoadJournalDamaged(t *testing.T) {
+	const (
+		start = `{"Kind":"start","Started":"2026-10-26T08:30:00Z"}` + "\n"
+		caseA = `{"Kind":"case","Case":{"Name":"a","Status":"Pass"}}` + "\n"
+		caseB = `{"Kind":"case","Case":{"Name":"b","Status":"Fail"}}` + "\n"
+		cut   = `{"Kind":"case","Case":{"Na`
+	)
+	tests := []struct {
+		name, text string
+		cases      int
+		err        string
+	}{
+		{"intact", start + caseA + caseB, 2, ""},
+		{"truncated last line", start + caseA + cut, 1, ""},
+		{"damaged last line", start + caseA + "garbage\n", 1, ""},
+		{"damaged middle line", start + cut + "\n" + caseB, 0, "line 2"},
+		{"garbage", "garbage\n" + start + caseA, 0, "line 1"},
+	}
+	for _, test := range tests {
+		filename := filepath.Join(t.TempDir(), JournalFilename)
+		if err := os.WriteFile(filename, []byte(test.text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		state, err := LoadJournal(filename)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: got error %v, expected %q", test.name, err,
+					test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", test.name, err)
+			continue
+		}
+		if len(state.Cases) != test.cases {
+			t.Errorf("%q: got %d completed cases, expected %d", test.name,
+				len(state.Cases), test.cases)
+		}
+	}
+}
+
+// The resumed run appends its entries after the truncated line of the
+// crashed run, so the truncated line must be removed when the journal is
+// opened again.
+func TestOpenJournalTrimsTruncatedLine(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), JournalFilename)
+	text := `{"Kind":"case","Case":{"Name":"a","Status":"Pass"}}` + "\n" +
+		`{"Kind":"case","Case":{"Na`
+	if err := os.WriteFile(filename, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	j, err := OpenJournal(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.HandleEvent(&CaseFinished{Case: &TestCase{Name: "b", Status: "Fail"}})
+	j.Close()
+
+	state, err := LoadJournal(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if _, found := state.Cases[name]; !found {
+			t.Errorf("%q: not completed", name)
+		}
+	}
+}
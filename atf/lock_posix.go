@@ -0,0 +1,31 @@
+//go:build !windows
+
+/*
+ * lock_posix.go - POSIX specific file locking
+ */
+
+package atf
+
+import (
+	"os"
+	"syscall"
+)
+
+// Locks the open file against the other processes (advisory lock); blocks
+// until the lock is acquired. Returns the function releasing the lock.
+func lockFile(f *os.File, exclusive bool) (func(), error) {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return func() { syscall.Flock(int(f.Fd()), syscall.LOCK_UN) }, nil
+	}
+}
@@ -0,0 +1,40 @@
+//go:build windows
+
+/*
+ * lock_windows.go - Windows specific file locking
+ */
+
+package atf
+
+import (
+	"os"
+	"time"
+)
+
+// The lock file older than this is considered stale (left behind by a
+// crashed process) and is removed.
+const staleLockAge = time.Minute
+
+// Locks the open file against the other processes: the lock file beside it
+// is created exclusively; blocks until the lock is acquired. There are no
+// shared locks, all the locks are exclusive. Returns the function releasing
+// the lock.
+func lockFile(f *os.File, exclusive bool) (func(), error) {
+	name := f.Name() + ".lock"
+	for {
+		lf, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			lf.Close()
+			return func() { os.Remove(name) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, err := os.Stat(name); err == nil &&
+			time.Since(fi.ModTime()) > staleLockAge {
+			os.Remove(name)
+			continue
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
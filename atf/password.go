@@ -9,7 +9,6 @@
 package atf
 
 import (
-	"fmt"
     "golang.org/x/crypto/bcrypt"
 )
 
@@ -38,9 +37,10 @@ func (p *Password) Set(passwd string) (e error) {
 }
 
 /*
- * Password.Get - return a stored hashed password
+ * Password.Get - return a stored hashed password; the hash can be compared
+ * using ComparePasswords()
  */
-func (p *Password) Get() string { return fmt.Sprintf("%x", p.pwd) }
+func (p *Password) Get() string { return string(p.pwd) }
 
 /*
  * Password.Cmp - compare arbitrary password to the one stored 
@@ -65,6 +65,7 @@ func HashPassword(passwd string) (string) {
 }
 
 
+// Compare the bcrypt-hashed password with the plain-text one.
 func ComparePasswords(hashed, plain string) bool {
     status := false
     err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(plain))
@@ -2,9 +2,8 @@
  * report.go - implementation of the Reporter module
  *
  * This module is repsonsible for creating reports. According to input data,
- * different reports can be created: HTML, XML, JSON and plain text (the last
- * one has not been implemented yet and it might be omitted in the end, since
- * I'm not sure this is actually needed). These reports are written as files to
+ * different reports can be created: HTML, XML, JSON and plain text. These
+ * reports are written as files to
  * a specified path. By default, only HTML report is
  * created.
  *
@@ -58,7 +57,8 @@ func (r *Report) create(tr *TestReport, typ string) (rpt string, err error) {
 		rpt, err = tr.Html()
 	case "xml":
 		rpt, err = tr.Xml()
-	case "txt": // TODO: TextReport not implemented yet
+	case "txt":
+		rpt, err = tr.Text()
 	case "json":
 		rpt, err = tr.Json()
 	default:
@@ -0,0 +1,307 @@
+/*
+ * rptdiff.go - implementation of the ReportDiff type
+ *
+ * The ReportDiff answers the question "what has changed since the last run?".
+ * Two TestReports of the same test set are compared and the differences are
+ * collected: test cases and steps that have started failing or passing, cases
+ * and steps that were added or removed and the execution duration regressions.
+ * As with other types, the diff can be represented as plain text, JSON or
+ * HTML.
+ */
+
+package atf
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Represents a single difference between two test reports: either a test
+// case or a test step (when Step field is not empty) with its old and new
+// status. For added items, the old status is empty; for removed items, the new
+// status is empty.
+type DiffItem struct {
+
+	// a name of the test case
+	Case string
+
+	// a name of the test step; empty for the test case differences
+	Step string `json:",omitempty"`
+
+	// a status in the old report
+	Old TestResult `json:",omitempty"`
+
+	// a status in the new report
+	New TestResult `json:",omitempty"`
+}
+
+// Returns a plain text representation of the DiffItem instance.
+func (d *DiffItem) String() string {
+	name := fmt.Sprintf("case %q", d.Case)
+	if d.Step != "" {
+		name += fmt.Sprintf(" step %q", d.Step)
+	}
+	switch {
+	case d.Old == "":
+		return fmt.Sprintf("%s (%s)", name, d.New)
+	case d.New == "":
+		return fmt.Sprintf("%s (%s)", name, d.Old)
+	}
+	return fmt.Sprintf("%s: %s -> %s", name, d.Old, d.New)
+}
+
+// Represents an execution duration change between two test reports.
+type DurationChange struct {
+
+	// a name of the measured item
+	Name string
+
+	// a duration in the old report
+	Old time.Duration
+
+	// a duration in the new report
+	New time.Duration
+}
+
+// Returns a plain text representation of the DurationChange instance.
+func (d *DurationChange) String() string {
+	pct := 100 * (float64(d.New) - float64(d.Old)) / float64(d.Old)
+	return fmt.Sprintf("%s: %s -> %s (%+.1f%%)", d.Name, d.Old, d.New, pct)
+}
+
+// Represents the differences between two test reports.
+type ReportDiff struct {
+
+	// a name of the compared test set (as found in the new report)
+	TestSet string
+
+	// execution start timestamps of the old and the new report
+	OldStarted time.Time
+	NewStarted time.Time
+
+	// test cases and steps that failed in the new report, but did not fail in
+	// the old one
+	NewlyFailing []*DiffItem
+
+	// test cases and steps that passed in the new report, but did not pass in
+	// the old one
+	NewlyPassing []*DiffItem
+
+	// test cases and steps found only in the new report
+	Added []*DiffItem
+
+	// test cases and steps found only in the old report
+	Removed []*DiffItem
+
+	// items whose execution took (noticeably) longer in the new report
+	Regressions []*DurationChange
+}
+
+// Reports whether there are any differences between the reports at all.
+func (d *ReportDiff) HasChanges() bool {
+	return len(d.NewlyFailing) > 0 || len(d.NewlyPassing) > 0 ||
+		len(d.Added) > 0 || len(d.Removed) > 0 || len(d.Regressions) > 0
+}
+
+// Returns a plain text representation of the ReportDiff instance.
+func (d *ReportDiff) String() string {
+	s := fmt.Sprintf("Test set %q: %s -> %s\n", d.TestSet,
+		d.OldStarted.Format(time.RFC3339), d.NewStarted.Format(time.RFC3339))
+	if !d.HasChanges() {
+		return s + "No changes.\n"
+	}
+	s += diffItems2Text("Newly failing", d.NewlyFailing)
+	s += diffItems2Text("Newly passing", d.NewlyPassing)
+	s += diffItems2Text("Added", d.Added)
+	s += diffItems2Text("Removed", d.Removed)
+	if len(d.Regressions) > 0 {
+		s += fmt.Sprintf("Duration regressions (%d):\n", len(d.Regressions))
+		for _, r := range d.Regressions {
+			s += fmt.Sprintf("  %s\n", r.String())
+		}
+	}
+	return s
+}
+
+// Returns a plain text section for a list of differences; if the list is
+// empty, an empty string is returned.
+func diffItems2Text(title string, items []*DiffItem) string {
+	if len(items) == 0 {
+		return ""
+	}
+	s := fmt.Sprintf("%s (%d):\n", title, len(items))
+	for _, item := range items {
+		s += fmt.Sprintf("  %s\n", item.String())
+	}
+	return s
+}
+
+// Returns a JSON-encoded representation of the ReportDiff instance.
+func (d *ReportDiff) Json() (string, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return "", err
+	}
+	return string(b[:]), err
+}
+
+// Returns a HTML representation of the ReportDiff instance. Only the contents
+// of the <body> section are created.
+func (d *ReportDiff) Html() (string, error) {
+	html := fmt.Sprintln("<header>")
+	html += fmt.Sprintf("<h1>Report Diff: %s</h1>\n", d.TestSet)
+	html += fmt.Sprintln("<table>")
+	html += fmt.Sprintln("<tr><td><b>Old Execution Started</b></td>")
+	html += fmt.Sprintf("<td>%s</td></tr>\n", d.OldStarted.Format(time.RFC3339))
+	html += fmt.Sprintln("<tr><td><b>New Execution Started</b></td>")
+	html += fmt.Sprintf("<td>%s</td></tr>\n", d.NewStarted.Format(time.RFC3339))
+	html += fmt.Sprintln("</table>")
+	html += fmt.Sprintln("</header>")
+	if !d.HasChanges() {
+		html += fmt.Sprintln("<p>No changes.</p>")
+		return html, nil
+	}
+	html += diffItems2Html("Newly Failing", d.NewlyFailing)
+	html += diffItems2Html("Newly Passing", d.NewlyPassing)
+	html += diffItems2Html("Added", d.Added)
+	html += diffItems2Html("Removed", d.Removed)
+	if len(d.Regressions) > 0 {
+		html += "<article>\n"
+		html += fmt.Sprintln("<h3>Duration Regressions</h3>")
+		html += "<table>\n"
+		html += fmt.Sprintf("<tr><th class=%q>Name</th>", "name")
+		html += "<th>Old Duration</th><th>New Duration</th></tr>\n"
+		for _, r := range d.Regressions {
+			html += fmt.Sprintf("<tr><td>%s</td><td>%s</td>", r.Name, r.Old)
+			html += fmt.Sprintf("<td class=%q>%s</td></tr>\n", "failed", r.New)
+		}
+		html += fmt.Sprintln("</table><p />")
+		html += "</article>\n"
+	}
+	return html, nil
+}
+
+// Returns a HTML section for a list of differences; if the list is empty, an
+// empty string is returned.
+func diffItems2Html(title string, items []*DiffItem) string {
+	if len(items) == 0 {
+		return ""
+	}
+	html := "<article>\n"
+	html += fmt.Sprintf("<h3>%s</h3>\n", title)
+	html += "<table>\n"
+	html += fmt.Sprintf("<tr><th class=%q>Test Case</th>", "name")
+	html += fmt.Sprintf("<th class=%q>Test Step</th>", "name")
+	html += fmt.Sprintf("<th class=%q>Old Status</th>", "status")
+	html += fmt.Sprintf("<th class=%q>New Status</th></tr>\n", "status")
+	for _, item := range items {
+		html += fmt.Sprintf("<tr><td>%s</td><td>%s</td>", item.Case, item.Step)
+		html += fmt.Sprintf("<td class=%q>%s</td>",
+			resolveResultClass(item.Old), item.Old)
+		html += fmt.Sprintf("<td class=%q>%s</td></tr>\n",
+			resolveResultClass(item.New), item.New)
+	}
+	html += fmt.Sprintln("</table><p />")
+	html += "</article>\n"
+	return html
+}
+
+// Compares the statuses of the same item in two reports and appends the item
+// to the appropriate list of differences.
+func (d *ReportDiff) compare(item *DiffItem) {
+	switch {
+	case item.New == "Fail" && item.Old != "Fail":
+		d.NewlyFailing = append(d.NewlyFailing, item)
+	case item.New == "Pass" && item.Old != "Pass":
+		d.NewlyPassing = append(d.NewlyPassing, item)
+	}
+}
+
+// Compares the steps of the same test case in two reports.
+func (d *ReportDiff) compareSteps(oldtc, newtc *TestCase) {
+	oldsteps := make(map[string]*TestStep)
+	for _, step := range oldtc.Steps {
+		oldsteps[step.Name] = step
+	}
+	seen := make(map[string]bool)
+	for _, step := range newtc.Steps {
+		seen[step.Name] = true
+		old, found := oldsteps[step.Name]
+		if !found {
+			d.Added = append(d.Added,
+				&DiffItem{newtc.Name, step.Name, "", step.Status})
+			continue
+		}
+		d.compare(&DiffItem{newtc.Name, step.Name, old.Status, step.Status})
+	}
+	for _, step := range oldtc.Steps {
+		if !seen[step.Name] {
+			d.Removed = append(d.Removed,
+				&DiffItem{oldtc.Name, step.Name, step.Status, ""})
+		}
+	}
+}
+
+// Checks whether the new duration exceeds the old one by more than given
+// tolerance (a fraction of the old duration) and records the regression.
+func (d *ReportDiff) compareDuration(name string,
+	was, now time.Duration, tolerance float64) {
+	if was <= 0 || now <= 0 {
+		return
+	}
+	if float64(now) > float64(was)*(1+tolerance) {
+		d.Regressions = append(d.Regressions, &DurationChange{name, was, now})
+	}
+}
+
+// Compares two test reports and returns the differences. Test cases are
+// matched by their names, test steps by their names within the same test
+// case. The tolerance defines how much longer (as a fraction of the old
+// duration, e.g. 0.2 for 20%) the execution may take before it's reported as
+// a duration regression.
+func DiffReports(oldtr, newtr *TestReport, tolerance float64) *ReportDiff {
+
+	d := newReportDiff(oldtr, newtr)
+	if oldtr.TestSet == nil || newtr.TestSet == nil {
+		return d
+	}
+
+	oldcases := make(map[string]*TestCase)
+	for _, tc := range oldtr.TestSet.Cases {
+		oldcases[tc.Name] = tc
+	}
+	seen := make(map[string]bool)
+	for _, tc := range newtr.TestSet.Cases {
+		seen[tc.Name] = true
+		oldtc, found := oldcases[tc.Name]
+		if !found {
+			d.Added = append(d.Added, &DiffItem{tc.Name, "", "", tc.Status})
+			continue
+		}
+		d.compare(&DiffItem{tc.Name, "", oldtc.Status, tc.Status})
+		d.compareSteps(oldtc, tc)
+		d.compareDuration(fmt.Sprintf("Test case %q", tc.Name),
+			oldtc.Duration, tc.Duration, tolerance)
+	}
+	for _, tc := range oldtr.TestSet.Cases {
+		if !seen[tc.Name] {
+			d.Removed = append(d.Removed, &DiffItem{tc.Name, "", tc.Status, ""})
+		}
+	}
+
+	d.compareDuration(fmt.Sprintf("Test set %q", d.TestSet),
+		oldtr.Duration(), newtr.Duration(), tolerance)
+	return d
+}
+
+// Create an empty ReportDiff for given reports.
+func newReportDiff(oldtr, newtr *TestReport) *ReportDiff {
+	d := &ReportDiff{OldStarted: oldtr.Started, NewStarted: newtr.Started}
+	if newtr.TestSet != nil {
+		d.TestSet = newtr.TestSet.Name
+	} else if oldtr.TestSet != nil {
+		d.TestSet = oldtr.TestSet.Name
+	}
+	return d
+}
@@ -0,0 +1,114 @@
+package atf
+
+import (
+	"testing"
+	"time"
+)
+
+// Creates a report with the test cases of given names and statuses, each
+// case with a single step of the same status.
+func diffReport(cases ...string) *TestReport {
+	ts := &TestSet{Name: "set"}
+	for i := 0; i+1 < len(cases); i += 2 {
+		status := TestResult(cases[i+1])
+		ts.Cases = append(ts.Cases, &TestCase{Name: cases[i], Status: status,
+			Steps: []*TestStep{&TestStep{Name: "step", Status: status}}})
+	}
+	return &TestReport{TestSet: ts}
+}
+
+// Returns the names of the items (case or case/step).
+func diffNames(items []*DiffItem) []string {
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		name := item.Case
+		if item.Step != "" {
+			name += "/" + item.Step
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestDiffReports(t *testing.T) {
+	tests := []struct {
+		name                             string
+		old, new                         *TestReport
+		failing, passing, added, removed []string
+	}{
+		{"unchanged", diffReport("a", "Pass", "b", "Fail"),
+			diffReport("a", "Pass", "b", "Fail"), nil, nil, nil, nil},
+		{"newly failing", diffReport("a", "Pass", "b", "NotTested"),
+			diffReport("a", "Fail", "b", "Fail"),
+			[]string{"a", "a/step", "b", "b/step"}, nil, nil, nil},
+		{"newly passing", diffReport("a", "Fail", "b", "XFail"),
+			diffReport("a", "Pass", "b", "Pass"), nil,
+			[]string{"a", "a/step", "b", "b/step"}, nil, nil},
+		{"not tested", diffReport("a", "Pass"), diffReport("a", "NotTested"),
+			nil, nil, nil, nil},
+		{"added and removed", diffReport("a", "Pass", "b", "Fail"),
+			diffReport("a", "Pass", "c", "Fail"), nil, nil,
+			[]string{"c"}, []string{"b"}},
+	}
+	for _, test := range tests {
+		d := DiffReports(test.old, test.new, 0.2)
+		lists := []struct {
+			kind     string
+			got      []*DiffItem
+			expected []string
+		}{
+			{"newly failing", d.NewlyFailing, test.failing},
+			{"newly passing", d.NewlyPassing, test.passing},
+			{"added", d.Added, test.added},
+			{"removed", d.Removed, test.removed},
+		}
+		for _, l := range lists {
+			if !equalStrings(diffNames(l.got), l.expected) {
+				t.Errorf("%q: %s got %q, expected %q", test.name, l.kind,
+					diffNames(l.got), l.expected)
+			}
+		}
+		changes := len(test.failing)+len(test.passing)+len(test.added)+
+			len(test.removed) > 0
+		if d.HasChanges() != changes {
+			t.Errorf("%q: HasChanges() got %t, expected %t", test.name,
+				d.HasChanges(), changes)
+		}
+	}
+}
+
+func TestDiffReportsRegressions(t *testing.T) {
+	tests := []struct {
+		old, new time.Duration
+		expected bool
+	}{
+		{10 * time.Second, 12 * time.Second, false},
+		{10 * time.Second, 13 * time.Second, true},
+		{10 * time.Second, 5 * time.Second, false},
+		{0, 13 * time.Second, false},
+	}
+	for _, test := range tests {
+		oldtr, newtr := diffReport("a", "Pass"), diffReport("a", "Pass")
+		oldtr.TestSet.Cases[0].Duration = test.old
+		newtr.TestSet.Cases[0].Duration = test.new
+		d := DiffReports(oldtr, newtr, 0.2)
+		if got := len(d.Regressions) > 0; got != test.expected {
+			t.Errorf("%s -> %s: regression got %t, expected %t", test.old,
+				test.new, got, test.expected)
+		}
+	}
+}
+
+// Reports whether the two slices contain the same strings in the same order;
+// nil and empty slices are equal.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+/*
+ * rptindex.go - the index of the test reports under the working dirs root
+ *
+ * Every run leaves its reports in its own working directory. The index lists
+ * the summaries of all the runs found under the root, so they can be browsed
+ * (e.g. by the web dashboard) without loading the complete reports.
+ */
+
+package atf
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// The overall statuses of the runs.
+const (
+	RunInProgress = "in progress"
+	RunAborted    = "aborted"
+	RunFailed     = "failed"
+	RunPassed     = "passed"
+)
+
+// Represents a summary of a single run (test report).
+type ReportSummary struct {
+
+	// the working directory of the run, relative to the root
+	Dir string
+
+	// a name of the test set and the SUT name/version (if defined)
+	TestSet    string
+	SutName    string `json:",omitempty"`
+	SutVersion string `json:",omitempty"`
+
+	// execution start and finish timestamps
+	Started  time.Time
+	Finished time.Time
+
+	// the overall status of the run: "in progress", "aborted", "failed" or
+	// "passed"
+	Status string
+
+	// the number of passed, failed and not tested test cases
+	Passed    int
+	Failed    int
+	NotTested int
+}
+
+// Create a summary of the test report.
+func (tr *TestReport) Summary() *ReportSummary {
+	s := &ReportSummary{TestSet: tr.Name(), SutVersion: sutVersion(tr),
+		Started: tr.Started, Finished: tr.Finished}
+	if tr.TestSet.Sut != nil {
+		s.SutName = tr.TestSet.Sut.Name
+	}
+	for _, tc := range tr.TestSet.Cases {
+		switch tc.Status {
+		case "Pass", "XFail":
+			s.Passed++
+		case "Fail":
+			s.Failed++
+		default:
+			s.NotTested++
+		}
+	}
+	switch {
+	case tr.InProgress:
+		s.Status = RunInProgress
+	case tr.Aborted:
+		s.Status = RunAborted
+	case len(tr.Failures()) > 0:
+		s.Status = RunFailed
+	default:
+		s.Status = RunPassed
+	}
+	return s
+}
+
+// Walks the directory tree under the given root and calls the function for
+// every JSON test report found there. Reports that cannot be loaded are
+// silently skipped.
+func walkReports(root string, fn func(filename string, tr *TestReport)) error {
+	return filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() || fi.Name() != "report.json" {
+			return nil
+		}
+		if tr, err := LoadTestReport(p); err == nil {
+			fn(p, tr)
+		}
+		return nil
+	})
+}
+
+// Lists the summaries of all the runs (JSON test reports) found under the
+// given root, the most recent first.
+func ListReports(root string) ([]*ReportSummary, error) {
+	summaries := make([]*ReportSummary, 0)
+	err := walkReports(root, func(filename string, tr *TestReport) {
+		if tr.TestSet == nil {
+			return
+		}
+		s := tr.Summary()
+		if dir, err := filepath.Rel(root, filepath.Dir(filename)); err == nil {
+			s.Dir = filepath.ToSlash(dir)
+		}
+		summaries = append(summaries, s)
+	})
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].Started.After(summaries[j].Started)
+	})
+	return summaries, err
+}
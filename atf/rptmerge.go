@@ -0,0 +1,200 @@
+/*
+ * rptmerge.go - merging of several TestReports into a consolidated one
+ *
+ * When a test set is split across several machines or it is (partially)
+ * re-executed, there are several TestReports describing the same test set.
+ * These reports are merged into a single one by test set/case identity: when
+ * the same test case is found in more than one report, the merge policy
+ * decides which result is kept.
+ */
+
+package atf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// An enum defining the policies used when the same test case is found in more
+// than one of the merged reports.
+type MergePolicy int
+
+const (
+	// the result from the most recently started report is kept
+	MergeLatest MergePolicy = iota
+
+	// the worst of the results is kept
+	MergeWorst
+
+	// a later result replaces the earlier one only if the earlier one has not
+	// passed and the later one has actually been executed; that is, a rerun
+	// overrides a failure, but not a pass, and an aborted (or skipped) rerun
+	// does not override anything
+	MergeRerunOverridesFailure
+)
+
+// A slice of valid merge policy (string) values, in the order of MergePolicy
+// values.
+var ValidMergePolicies = []string{"latest", "worst", "rerun"}
+
+// Returns a string representation of the MergePolicy.
+func (p MergePolicy) String() string {
+	if int(p) < 0 || int(p) >= len(ValidMergePolicies) {
+		return "unknown merge policy"
+	}
+	return ValidMergePolicies[p]
+}
+
+// Converts the merge policy given as string into proper MergePolicy value.
+func MergePolicyFromString(policy string) (MergePolicy, error) {
+	for i, p := range ValidMergePolicies {
+		if strings.ToLower(policy) == p {
+			return MergePolicy(i), nil
+		}
+	}
+	return MergeLatest, ATFError_Invalid_Value
+}
+
+// Returns the severity rank of the test result: the worse the result, the
+// higher the rank.
+func resultRank(result TestResult) int {
+	switch result {
+	case "Pass":
+		return 0
+	case "XFail":
+		return 1
+	case "Fail":
+		return 3
+	}
+	return 2 // NotTested and unknown values
+}
+
+// Reports whether the result is a result of the actual execution.
+func executed(result TestResult) bool {
+	return result == "Pass" || result == "Fail" || result == "XFail"
+}
+
+// Decides whether the current result should be replaced by the candidate
+// result (found in a later report) according to the merge policy.
+func (p MergePolicy) replaces(current, candidate TestResult) bool {
+	switch p {
+	case MergeWorst:
+		return resultRank(candidate) > resultRank(current)
+	case MergeRerunOverridesFailure:
+		return current != "Pass" && executed(candidate)
+	}
+	return true
+}
+
+// Merges the setup/cleanup action of the test set according to the policy.
+func (p MergePolicy) mergeAction(current, candidate *Action) *Action {
+	if candidate == nil {
+		return current
+	}
+	if current == nil || !current.IsExecutable() {
+		return candidate
+	}
+	if candidate.IsExecutable() && p.replaces(current.Result, candidate.Result) {
+		return candidate
+	}
+	return current
+}
+
+// Merges the given test reports into a single, consolidated report. Reports
+// are processed in the order of their execution start; the test cases are
+// identified by the test set name and the test case name, and when the same
+// case is found in more than one report, the merge policy decides which
+// result is kept. The merged report starts with the earliest start and ends
+// with the latest finish of the merged reports; it is aborted (or in progress)
+// when the latest report is, so a clean rerun of an aborted run is not
+// aborted anymore. The attribution of the run (initiator, host, version and
+// config hash) is taken as a whole from the latest report, so it always
+// describes a run that has actually happened. The flakiness scores are
+// combined, the later ones take precedence.
+func MergeReports(policy MergePolicy, reports ...*TestReport) (*TestReport,
+	error) {
+
+	if len(reports) == 0 {
+		return nil, fmt.Errorf("There are no reports to merge.")
+	}
+	sorted := make([]*TestReport, 0, len(reports))
+	for _, tr := range reports {
+		if tr == nil || tr.TestSet == nil {
+			return nil, fmt.Errorf("Cannot merge an empty report.")
+		}
+		sorted = append(sorted, tr)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Started.Before(sorted[j].Started)
+	})
+
+	merged := CreateTestReport(new(TestSet))
+	names := make([]string, 0)
+	cases := make(map[string]*TestCase)
+	keys := make([]string, 0) // keep the order of the first appearance
+	for _, tr := range sorted {
+		ts := tr.TestSet
+		if !containsString(names, ts.Name) {
+			names = append(names, ts.Name)
+		}
+		if merged.TestSet.Description == "" {
+			merged.TestSet.Description = ts.Description
+		}
+		if merged.TestSet.TestPlan == "" {
+			merged.TestSet.TestPlan = ts.TestPlan
+		}
+		if ts.Sut != nil {
+			merged.TestSet.Sut = ts.Sut
+		}
+		merged.TestSet.Setup = policy.mergeAction(merged.TestSet.Setup,
+			ts.Setup)
+		merged.TestSet.Cleanup = policy.mergeAction(merged.TestSet.Cleanup,
+			ts.Cleanup)
+
+		for _, tc := range ts.Cases {
+			key := ts.Name + "/" + tc.Name
+			current, found := cases[key]
+			if !found {
+				keys = append(keys, key)
+				cases[key] = tc
+			} else if policy.replaces(current.Status, tc.Status) {
+				cases[key] = tc
+			}
+		}
+
+		if merged.Started.IsZero() || tr.Started.Before(merged.Started) {
+			merged.Started = tr.Started
+		}
+		if tr.Finished.After(merged.Finished) {
+			merged.Finished = tr.Finished
+		}
+		merged.Aborted, merged.InProgress = tr.Aborted, tr.InProgress
+
+		// the attribution of the latest report is kept
+		merged.Initiator, merged.Host = tr.Initiator, tr.Host
+		merged.Version, merged.ConfigHash = tr.Version, tr.ConfigHash
+		for name, score := range tr.Flakiness {
+			if merged.Flakiness == nil {
+				merged.Flakiness = make(map[string]float64)
+			}
+			merged.Flakiness[name] = score
+		}
+	}
+
+	merged.TestSet.Name = strings.Join(names, "+")
+	for _, key := range keys {
+		merged.TestSet.Cases = append(merged.TestSet.Cases, cases[key])
+	}
+	return merged, nil
+}
+
+// Reports whether the slice of strings contains the given string.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package atf
+
+import (
+	"testing"
+	"time"
+)
+
+// Creates a report started at given hour with a single test case "a" of the
+// given status.
+func mergeReport(hour int, status TestResult) *TestReport {
+	ts := &TestSet{Name: "set",
+		Cases: []*TestCase{&TestCase{Name: "a", Status: status}}}
+	start := time.Date(2026, 10, 26, hour, 0, 0, 0, time.UTC)
+	return &TestReport{TestSet: ts, Started: start,
+		Finished: start.Add(time.Minute)}
+}
+
+func TestMergeReportsPolicies(t *testing.T) {
+	tests := []struct {
+		policy                MergePolicy
+		first, second, merged TestResult
+	}{
+		{MergeLatest, "Fail", "Pass", "Pass"},
+		{MergeLatest, "Pass", "Fail", "Fail"},
+		{MergeLatest, "Fail", "NotTested", "NotTested"},
+		{MergeWorst, "Fail", "Pass", "Fail"},
+		{MergeWorst, "Pass", "XFail", "XFail"},
+		{MergeWorst, "XFail", "NotTested", "NotTested"},
+		{MergeWorst, "NotTested", "Fail", "Fail"},
+		{MergeRerunOverridesFailure, "Fail", "Pass", "Pass"},
+		{MergeRerunOverridesFailure, "Pass", "Fail", "Pass"},
+		{MergeRerunOverridesFailure, "Fail", "NotTested", "Fail"},
+		{MergeRerunOverridesFailure, "NotTested", "Fail", "Fail"},
+		{MergeRerunOverridesFailure, "XFail", "Pass", "Pass"},
+	}
+	for _, test := range tests {
+		// the reports are given in reverse order: they are sorted by start
+		tr, err := MergeReports(test.policy, mergeReport(9, test.second),
+			mergeReport(8, test.first))
+		if err != nil {
+			t.Fatalf("%s: %s", test.policy, err)
+		}
+		if n := len(tr.TestSet.Cases); n != 1 {
+			t.Fatalf("%s: got %d test cases, expected 1", test.policy, n)
+		}
+		if got := tr.TestSet.Cases[0].Status; got != test.merged {
+			t.Errorf("%s: %s then %s: got %s, expected %s", test.policy,
+				test.first, test.second, got, test.merged)
+		}
+	}
+}
+
+func TestMergeReportsAttribution(t *testing.T) {
+	first, second := mergeReport(8, "Fail"), mergeReport(9, "Pass")
+	first.Initiator, first.Host = "alice", "lab1"
+	first.Version, first.ConfigHash = "1.1", "sha256:1111"
+	first.Flakiness = map[string]float64{"a": 0.5, "b": 0.1}
+	// the attribution is never mixed: the missing initiator of the latest
+	// report is not taken from the earlier one
+	second.Host, second.Version = "lab2", "1.2"
+	second.Flakiness = map[string]float64{"a": 0.25}
+
+	tr, err := MergeReports(MergeRerunOverridesFailure, second, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ name, got, expected string }{
+		{"initiator", tr.Initiator, ""},
+		{"host", tr.Host, "lab2"},
+		{"version", tr.Version, "1.2"},
+		{"config hash", tr.ConfigHash, ""},
+	}
+	for _, test := range tests {
+		if test.got != test.expected {
+			t.Errorf("%s: got %q, expected %q", test.name, test.got,
+				test.expected)
+		}
+	}
+	if tr.Flakiness["a"] != 0.25 || tr.Flakiness["b"] != 0.1 {
+		t.Errorf("flakiness: got %v", tr.Flakiness)
+	}
+	if !tr.Started.Equal(first.Started) || !tr.Finished.Equal(second.Finished) {
+		t.Errorf("got %s - %s, expected %s - %s", tr.Started, tr.Finished,
+			first.Started, second.Finished)
+	}
+}
+
+func TestMergeReportsAborted(t *testing.T) {
+	tests := []struct {
+		name                      string
+		prevAborted, rerunAborted bool
+		expected                  bool
+	}{
+		{"clean rerun of aborted run", true, false, false},
+		{"aborted rerun of clean run", false, true, true},
+		{"aborted rerun of aborted run", true, true, true},
+		{"clean rerun of clean run", false, false, false},
+	}
+	for _, test := range tests {
+		prev, rerun := mergeReport(8, "NotTested"), mergeReport(9, "Pass")
+		prev.Aborted, rerun.Aborted = test.prevAborted, test.rerunAborted
+		// the order of the arguments does not matter: the latest one wins
+		tr, err := MergeReports(MergeRerunOverridesFailure, rerun, prev)
+		if err != nil {
+			t.Fatalf("%q: %s", test.name, err)
+		}
+		if tr.Aborted != test.expected {
+			t.Errorf("%q: aborted got %t, expected %t", test.name,
+				tr.Aborted, test.expected)
+		}
+	}
+
+	prev, rerun := mergeReport(8, "Fail"), mergeReport(9, "Pass")
+	prev.InProgress = true
+	tr, err := MergeReports(MergeRerunOverridesFailure, prev, rerun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.InProgress {
+		t.Errorf("finished rerun of a partial report is in progress")
+	}
+}
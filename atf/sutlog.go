@@ -0,0 +1,207 @@
+/*
+ * sutlog.go - capturing the logs of the system under test
+ *
+ * The SUTs usually log to syslog. While the test set is executed, GoATF can
+ * act as a syslog receiver: every message received is tagged with the test
+ * case and test step being executed at the moment, stored into the working
+ * directory (one JSON-encoded entry per line) and attached to the test case,
+ * so the SUT logs appear in the reports next to the results. The test steps
+ * can also check that the SUT has logged an expected message while the step
+ * was executed (see TestStep.ExpectLog).
+ */
+
+package atf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"bitbucket.org/miranr/goatf/atf/utils"
+)
+
+// The default name of the SUT log file in the working directory.
+const SutLogFilename = "sutlog.jsonl"
+
+// How long the step waits for the expected SUT log message after its action
+// is finished: the messages may arrive a bit late (e.g. over UDP).
+var SutLogGrace = 2 * time.Second
+
+// Represents a single message received from the SUT.
+type SutLogEntry struct {
+
+	// when and from where the message has been received
+	Time time.Time
+	From string `xml:",omitempty" json:",omitempty"`
+
+	// the test case and test step executed when the message was received;
+	// empty when received outside of any test case
+	Case string `xml:",omitempty" json:",omitempty"`
+	Step string `xml:",omitempty" json:",omitempty"`
+
+	// the message itself: the severity, the originator and the text
+	Severity string
+	Host     string `xml:",omitempty" json:",omitempty"`
+	App      string `xml:",omitempty" json:",omitempty"`
+	Msg      string
+}
+
+// Returns a plain text representation of the SutLogEntry instance.
+func (e *SutLogEntry) String() string {
+	s := e.Time.Format("15:04:05.000") + " " + e.Severity
+	if e.Step != "" {
+		s += " [" + e.Step + "]"
+	}
+	if e.Host != "" {
+		s += " " + e.Host
+	}
+	if e.App != "" {
+		s += " " + e.App
+	}
+	return s + ": " + e.Msg
+}
+
+// SutLog receives the syslog messages from the SUT while the test set is
+// executed. SutLog implements the Subscriber interface: it follows the
+// execution to tag the messages and to attach them to the test cases, so it
+// must be subscribed before the subscribers that record the finished cases
+// (journal, reports).
+type SutLog struct {
+	receiver *utils.SyslogReceiver
+	file     *os.File
+
+	entries []*SutLogEntry // all the received messages
+	tc      *TestCase      // the test case being executed
+	step    string         // the test step being executed
+	first   int            // index of the first entry of the current case
+	arrived chan struct{}  // closed (and replaced) when a message arrives
+	mutex   sync.Mutex
+}
+
+// Starts receiving the SUT logs on given address (e.g. ":5514") using given
+// transport ("udp", "tcp" or "both"); the received messages are appended to
+// the file.
+func StartSutLog(proto, addr, filename string) (*SutLog, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	l := &SutLog{file: f, entries: make([]*SutLogEntry, 0),
+		arrived: make(chan struct{})}
+	if l.receiver, err = utils.ListenSyslog(proto, addr, l.receive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Returns a plain text representation of the SutLog instance.
+func (l *SutLog) String() string {
+	return fmt.Sprintf("SutLog: %s -> %q", l.receiver, l.file.Name())
+}
+
+// Handles the received syslog message.
+func (l *SutLog) receive(m *utils.SyslogMsg, from net.Addr) {
+	e := &SutLogEntry{Time: time.Now(), Severity: m.Sev.String(),
+		Host: m.Hostname, App: m.AppName, Msg: m.Msg}
+	if from != nil {
+		e.From = from.String()
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.tc != nil {
+		e.Case, e.Step = l.tc.Name, l.step
+	}
+	l.entries = append(l.entries, e)
+	if b, err := json.Marshal(e); err == nil {
+		l.file.Write(append(b, '\n'))
+	}
+	close(l.arrived)
+	l.arrived = make(chan struct{})
+}
+
+// Follows the execution; implements the Subscriber interface. The messages
+// received so far are attached to the test case whenever one of its steps or
+// actions is finished.
+func (l *SutLog) HandleEvent(e Event) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	switch ev := e.(type) {
+	case *CaseStarted:
+		l.tc, l.step, l.first = ev.Case, "", len(l.entries)
+	case *StepStarted:
+		l.step = ev.Step.Name
+	case *StepFinished:
+		l.step = ""
+		l.attach(ev.Case)
+	case *ActionFinished:
+		l.attach(ev.Case)
+	case *CaseFinished:
+		l.attach(ev.Case)
+		l.tc = nil
+	}
+}
+
+// Attaches the messages received during the test case to it.
+func (l *SutLog) attach(tc *TestCase) {
+	if tc == nil || tc != l.tc {
+		return
+	}
+	n := len(l.entries) - l.first
+	if n == 0 {
+		return
+	}
+	tc.SutLog = make([]*SutLogEntry, n)
+	copy(tc.SutLog, l.entries[l.first:])
+}
+
+// Waits for the message matching the regular expression received after the
+// given time; returns false when no such message arrives before the deadline
+// or the context is cancelled.
+func (l *SutLog) waitFor(ctx context.Context, re *regexp.Regexp,
+	since, deadline time.Time) bool {
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	checked := 0
+	for {
+		l.mutex.Lock()
+		for ; checked < len(l.entries); checked++ {
+			e := l.entries[checked]
+			if !e.Time.Before(since) && re.MatchString(e.Msg) {
+				l.mutex.Unlock()
+				return true
+			}
+		}
+		arrived := l.arrived
+		l.mutex.Unlock()
+
+		select {
+		case <-arrived:
+		case <-timer.C:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Stops receiving the SUT logs and closes the file.
+func (l *SutLog) Close() {
+	l.receiver.Close()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.file.Close()
+}
+
+// Returns a copy of the context with the SUT log the test steps check their
+// log expectations against.
+func WithSutLog(ctx context.Context, l *SutLog) context.Context {
+	return context.WithValue(ctx, sutLogKey, l)
+}
@@ -0,0 +1,91 @@
+package atf
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"bitbucket.org/miranr/goatf/atf/utils"
+)
+
+// Creates the SUT log without the syslog receiver: the messages are passed
+// to receive() directly.
+func newTestSutLog(t *testing.T) *SutLog {
+	f, err := os.Create(filepath.Join(t.TempDir(), SutLogFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return &SutLog{file: f, entries: make([]*SutLogEntry, 0),
+		arrived: make(chan struct{})}
+}
+
+// Creates an informational syslog message with given text.
+func sutMsg(text string) *utils.SyslogMsg {
+	return &utils.SyslogMsg{Sev: utils.Informational, Msg: text}
+}
+
+func TestSutLogWaitFor(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	tests := []struct {
+		name     string
+		early    string        // received before the wait has started
+		late     string        // received while waiting
+		delay    time.Duration // when the late message arrives
+		expected bool
+	}{
+		{"already received", "link up", "", 0, true},
+		{"received before deadline", "", "link up", timeout / 4, true},
+		{"received after deadline", "", "link up", 2 * timeout, false},
+		{"not matching", "link down", "link down", timeout / 4, false},
+		{"nothing received", "", "", 0, false},
+	}
+	re := regexp.MustCompile(`link up`)
+	for _, test := range tests {
+		l := newTestSutLog(t)
+		since := time.Now()
+		if test.early != "" {
+			l.receive(sutMsg(test.early), nil)
+		}
+		if test.late != "" {
+			time.AfterFunc(test.delay, func() {
+				l.receive(sutMsg(test.late), nil)
+			})
+		}
+		start := time.Now()
+		got := l.waitFor(context.Background(), re, since, start.Add(timeout))
+		elapsed := time.Since(start)
+		if got != test.expected {
+			t.Errorf("%q: got %t, expected %t", test.name, got,
+				test.expected)
+		}
+		if !got && elapsed < timeout {
+			t.Errorf("%q: gave up after %s, before the deadline", test.name,
+				elapsed)
+		}
+		if got && elapsed >= timeout {
+			t.Errorf("%q: matched after %s, after the deadline", test.name,
+				elapsed)
+		}
+	}
+}
+
+func TestSutLogWaitForSince(t *testing.T) {
+	l := newTestSutLog(t)
+	l.receive(sutMsg("link up"), nil)
+	since := time.Now().Add(time.Millisecond)
+	deadline := since.Add(50 * time.Millisecond)
+	re := regexp.MustCompile(`link up`)
+	if l.waitFor(context.Background(), re, since, deadline) {
+		t.Errorf("message received before the step has matched")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if l.waitFor(ctx, re, since, time.Now().Add(time.Hour)) {
+		t.Errorf("cancelled wait has matched")
+	}
+}
@@ -19,9 +19,11 @@
 package atf
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"time"
 )
 
 // Represents a single test case.
@@ -49,6 +51,37 @@ type TestCase struct {
 
 	// a detailed description of the test case
 	Description string
+
+	// is this result a product of rerunning the previously failed case?
+	Rerun bool          `xml:"rerun,attr,omitempty" json:",omitempty"`
+
+	// execution duration of the test case
+	Duration time.Duration
+
+	// an optional duration budget of the test case (e.g. "1m30s"); when the
+	// execution takes longer, the case is either warned about or failed
+	Budget string       `xml:"budget,attr,omitempty" json:",omitempty"`
+
+	// what to do when the budget is exceeded: "warn" (default) or "fail"
+	OnBudget string     `xml:"onbudget,attr,omitempty" json:",omitempty"`
+
+	// a warning issued during the execution (e.g. exceeded budget)
+	Warning string      `xml:",omitempty" json:",omitempty"`
+
+	// is this case quarantined due to its flakiness? Quarantined cases are
+	// executed, but their failures do not affect the execution exit status.
+	Quarantined bool    `xml:"quarantined,attr,omitempty" json:",omitempty"`
+
+	// the messages logged by the SUT while the case was executed (see
+	// SutLog)
+	SutLog []*SutLogEntry `xml:"SutLog>Entry,omitempty" json:",omitempty"`
+
+	// the log file of the test case, relative to the working directory;
+	// empty when the per-case log files are not created
+	LogFile string       `xml:"logfile,attr,omitempty" json:",omitempty"`
+
+	// has this case been completed in the previous (interrupted) run?
+	completed bool
 }
 
 // Returns a plain text representation of the TestSet instance.
@@ -71,7 +104,7 @@ func (tc *TestCase) String() string {
 			s += fmt.Sprintf("%s\n", step.String())
 		}
 	} else {
-		s += fmt.Sprintln("\tActions: empty\n")
+		s += fmt.Sprint("\tActions: empty\n\n")
 	}
 	return s
 }
@@ -83,11 +116,17 @@ func (tc *TestCase) String() string {
 func (tc *TestCase) Initialize() {
 
     // if setup and cleanup actions are empty....
+    // (actions defined in config file must be initialized, otherwise they
+    // are never executed)
     if tc.Setup == nil {
         tc.Setup = CreateEmptyAction()
+    } else {
+        tc.Setup.Init()
     }
     if tc.Cleanup == nil {
         tc.Cleanup = CreateEmptyAction()
+    } else {
+        tc.Cleanup.Init()
     }
 
     //
@@ -130,7 +169,6 @@ func (tc *TestCase) Append(steps ...*TestStep) {
 func (tc *TestCase) cleanupAfterCaseSetupFail() string {
 	output := "Setup action has FAILED.\n"
 	output += "Skipping the rest of the case...\n"
-	output += fmt.Sprintf("<<< Leaving TestCase %q\n", tc.Name)
 	tc.Status = "Fail"
 	// set all steps' status to NotTested
 	for _, step := range tc.Steps {
@@ -140,49 +178,50 @@ func (tc *TestCase) cleanupAfterCaseSetupFail() string {
 }
 
 
-// Execute the entire TestCase.
-func (tc *TestCase) Execute(display *ExecDisplayFnCback) {
+// Execute the entire TestCase; the progress is published onto the event bus.
+// When the context is cancelled, the running step is killed and no further
+// steps are executed; the cleanup action is still executed (unless disabled,
+// see SkipCleanupOnAbort()).
+func (tc *TestCase) Execute(ctx context.Context, events *EventBus) {
 
-	// we turn function ptr back to function
-	disp := *display
-
-	// and start with execution...
-	disp("notice", fmt.Sprintf(">>> Entering TestCase %q\n", tc.Name))
+	// start with execution...
+	events.Publish(&CaseStarted{Case: tc})
+	start := time.Now()
 
 	// let's execute setup action (if not empty)
-	if tc.Setup != nil && tc.Setup.IsExecutable() {
-		disp("notice", fmt.Sprintf("Executing case setup action: %q\n",
-                tc.Setup.String()))
-		disp("info", FmtOutput(tc.Setup.Execute()))
+	if executeAction(ctx, tc, "setup", tc.Setup, events) &&
+		tc.Setup.Result == "Fail" {
 		// if setup action has failed, skip the rest of the case
-		if tc.Setup.Result == "Fail" {
-			disp("error", tc.cleanupAfterCaseSetupFail())
-		}
-	} else {
-		disp("notice", fmt.Sprintln("Setup action is not defined.\n"))
+		events.Message("error", tc.cleanupAfterCaseSetupFail())
 	}
 
-	// now we execute the steps...
-	if tc.Steps != nil {
-		for _, step := range tc.Steps {
-			step.Execute(display)
+	// now we execute the steps...; when aborted, the remaining steps are not
+	// tested
+	for _, step := range tc.Steps {
+		if ctx.Err() != nil {
+			step.Status = "NotTested"
+			continue
 		}
+		step.execute(ctx, tc, events)
 	}
 
 	// let's execute cleanup action (if not empty)
-	if tc.Cleanup != nil && tc.Cleanup.IsExecutable() {
-		disp("notice", fmt.Sprintf("Executing case cleanup action: %q\n",
-                tc.Cleanup.String()))
-        if tc.Setup != nil {
-		    disp("info", FmtOutput(tc.Setup.Execute()))
-        }
-	} else {
-		disp("notice", fmt.Sprintln("Cleanup action is not defined.\n"))
+	if cctx, ok := cleanupContext(ctx); ok {
+		executeAction(cctx, tc, "cleanup", tc.Cleanup, events)
 	}
+
 	// now we evaluate the complete test case
+	tc.Duration = time.Since(start)
 	tc.evaluate()
-	disp("notice", fmt.Sprintf("Test case evaluated to %q\n", tc.Status))
-	disp("notice", fmt.Sprintf("<<< Leaving TestCase %q\n", tc.Name))
+	if err := tc.checkBudget(); err != nil {
+		events.Message("error", fmt.Sprintf("Invalid budget: %s\n", err))
+	}
+	if tc.Warning != "" {
+		events.Message("warning",
+			fmt.Sprintf("Test case %q: %s\n", tc.Name, tc.Warning))
+	}
+	events.Publish(&CaseFinished{Case: tc, Result: tc.Status,
+		Duration: tc.Duration, Aborted: ctx.Err() != nil})
 }
 
 // Evaluate results after the case was executed.
@@ -216,6 +255,29 @@ func (tc *TestCase) evaluate() {
 	} // switch 
 }
 
+// Check the execution duration against the budget of the test case (if
+// defined). When the budget is exceeded, a warning is issued and, if so
+// requested, the test case fails.
+func (tc *TestCase) checkBudget() error {
+	tc.Warning = ""
+	if tc.Budget == "" {
+		return nil
+	}
+	budget, err := time.ParseDuration(tc.Budget)
+	if err != nil {
+		return err
+	}
+	if tc.Duration <= budget {
+		return nil
+	}
+	tc.Warning = fmt.Sprintf("duration %s exceeds budget %s",
+		tc.Duration, budget)
+	if tc.OnBudget == "fail" && tc.Status == "Pass" {
+		tc.Status = "Fail"
+	}
+	return nil
+}
+
 // Evaluate the test case status when expected status is XFail.
 func (tc *TestCase) evaluateExpectedFail() {
 
@@ -287,5 +349,6 @@ func (tc *TestCase) evaluateExpectedPass() {
 func CreateTestCase(name, descr string, setup, cleanup *Action,
 	                expected, status TestResult) *TestCase {
 	steps := make([]*TestStep, 0)
-	return &TestCase{name, setup, cleanup, expected, status, steps, descr}
+	return &TestCase{name, setup, cleanup, expected, status, steps, descr,
+		false, 0, "", "", "", false, nil, "", false}
 }
@@ -0,0 +1,68 @@
+package atf
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckBudget(t *testing.T) {
+	tests := []struct {
+		name             string
+		budget, onBudget string
+		duration         time.Duration
+		status, expected TestResult
+		warned           bool
+	}{
+		{"no budget", "", "fail", time.Hour, "Pass", "Pass", false},
+		{"within budget", "1m", "fail", time.Minute, "Pass", "Pass", false},
+		{"warn by default", "1m", "", 2 * time.Minute, "Pass", "Pass", true},
+		{"warn", "1m", "warn", 2 * time.Minute, "Pass", "Pass", true},
+		{"fail", "1m", "fail", 2 * time.Minute, "Pass", "Fail", true},
+		{"already failed", "1m", "fail", 2 * time.Minute, "Fail", "Fail",
+			true},
+		{"not tested", "1m", "fail", 2 * time.Minute, "NotTested",
+			"NotTested", true},
+	}
+	for _, test := range tests {
+		tc := &TestCase{Name: "a", Budget: test.budget,
+			OnBudget: test.onBudget, Duration: test.duration,
+			Status: test.status, Warning: "stale"}
+		if err := tc.checkBudget(); err != nil {
+			t.Fatalf("%q: %s", test.name, err)
+		}
+		if tc.Status != test.expected {
+			t.Errorf("%q: got %s, expected %s", test.name, tc.Status,
+				test.expected)
+		}
+		if warned := tc.Warning != ""; warned != test.warned {
+			t.Errorf("%q: got warning %q", test.name, tc.Warning)
+		}
+	}
+
+	tc := &TestCase{Name: "a", Budget: "a minute", Duration: time.Hour}
+	if err := tc.checkBudget(); err == nil {
+		t.Errorf("invalid budget %q accepted", tc.Budget)
+	}
+}
+
+// The budget is rechecked when the manual step is signed off: the failure of
+// the exceeded budget is not lost by the reevaluation.
+func TestSetVerdictBudget(t *testing.T) {
+	tc := &TestCase{Name: "a", Expected: "Pass", Budget: "1s",
+		OnBudget: "fail", Duration: time.Minute,
+		Steps: []*TestStep{&TestStep{Name: "step", Expected: "Pass",
+			Action: CreateManualAction("check it")}}}
+	tr := &TestReport{TestSet: &TestSet{Name: "set",
+		Cases: []*TestCase{tc}}}
+	bob := &User{Username: "bob", Role: "user"}
+	if err := tr.SetVerdict("a", "step", bob, "Pass", ""); err != nil {
+		t.Fatal(err)
+	}
+	if tc.Status != "Fail" {
+		t.Errorf("got %s, expected Fail", tc.Status)
+	}
+	if !strings.Contains(tc.Warning, "exceeds budget") {
+		t.Errorf("got warning %q", tc.Warning)
+	}
+}
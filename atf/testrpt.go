@@ -10,6 +10,11 @@
  *  1   jun11 MR Initial version, limited testing
  *  2   oct11 MR HTML report generation added
  *  3   may14 MR improved and cleaned version
+ *  4   oct26 MR the attribution of the run: initiator, host, GoATF version and
+ *               config hash
+ *  5   oct26 MR the SUT logs captured during the test cases
+ *  6   oct26 MR links to the per-case log files
+ *  7   oct26 MR the reports saved with the old timestamps can be loaded
  */
 
 package atf
@@ -18,30 +23,132 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	gohtml "html"
+	"path"
+	"sort"
+	"time"
+	"bitbucket.org/miranr/goatf/atf/utils"
 )
 
+// The version of the GoATF, recorded into the test reports.
+const Version = "0.9.0"
+
 // Represents the test report (test set that has been executed).
 type TestReport struct {
 
     // TestSet sctructure that will be executed
 	TestSet  *TestSet
 
-    // execution start timestamp (as a string)
-	Started  string
+    // execution start timestamp
+	Started  time.Time
+
+    // execution finish timestamp
+	Finished time.Time
+
+    // is the execution still in progress (the report is partial)?
+	InProgress bool `xml:"inprogress,attr,omitempty" json:",omitempty"`
+
+    // has the execution been aborted (cancelled by user or signal)?
+	Aborted bool `xml:"aborted,attr,omitempty" json:",omitempty"`
+
+    // flakiness scores of the test cases (by name), computed from the
+    // previous runs
+	Flakiness map[string]float64 `xml:"-" json:",omitempty"`
+
+    // the user that has initiated the run and the host it was executed on
+	Initiator string `xml:",omitempty" json:",omitempty"`
+	Host      string `xml:",omitempty" json:",omitempty"`
+
+    // the version of the GoATF that executed the run
+	Version string `xml:",omitempty" json:",omitempty"`
 
-    // execution finish timestamp (as a string)
-	Finished string
+    // the hash of the test set config file (see HashFile())
+	ConfigHash string `xml:",omitempty" json:",omitempty"`
 }
 
 // Return s string representation of the TestReport
 func (tr *TestReport) String() string {
 	return fmt.Sprintf("TestReport: %s\nstarted: %s\nfinished: %s\n",
-		tr.TestSet.String(), tr.Started, tr.Finished)
+		tr.TestSet.String(), tr.Started.Format(time.RFC3339),
+		tr.Finished.Format(time.RFC3339))
 }
 
 // Returns a name of the TestReport (which is actually the name of the TestSet).
 func (tr *TestReport) Name() string { return tr.TestSet.Name }
 
+// Returns the duration of the TestSet execution. If either of the timestamps
+// is missing, zero duration is returned.
+func (tr *TestReport) Duration() time.Duration {
+	if tr.Started.IsZero() || tr.Finished.IsZero() {
+		return 0
+	}
+	return tr.Finished.Sub(tr.Started)
+}
+
+// Returns the names of the test cases that need to be rerun: the ones that
+// have failed or have not been tested at all (usually due to infrastructure
+// problems, e.g. failed setup action).
+func (tr *TestReport) FailedCases() []string {
+	names := make([]string, 0)
+	if tr.TestSet != nil {
+		for _, tc := range tr.TestSet.Cases {
+			if tc.Status == "Fail" || tc.Status == "NotTested" {
+				names = append(names, tc.Name)
+			}
+		}
+	}
+	return names
+}
+
+// Returns the names of the failed test cases that are not quarantined; these
+// are the failures that determine the exit status of the execution.
+func (tr *TestReport) Failures() []string {
+	names := make([]string, 0)
+	if tr.TestSet != nil {
+		for _, tc := range tr.TestSet.Cases {
+			if tc.Status == "Fail" && !tc.Quarantined {
+				names = append(names, tc.Name)
+			}
+		}
+	}
+	return names
+}
+
+// Records the verdict of the tester for the manual step of the test case;
+// the test case is evaluated again.
+func (tr *TestReport) SetVerdict(caseName, stepName string, tester *User,
+	result TestResult, comment string) error {
+
+	if tr.TestSet != nil {
+		for _, tc := range tr.TestSet.Cases {
+			if tc.Name != caseName {
+				continue
+			}
+			for _, step := range tc.Steps {
+				if step.Name == stepName {
+					if err := step.SetVerdict(tester, result,
+						comment); err != nil {
+						return err
+					}
+					tc.evaluate()
+					tc.checkBudget()
+					return nil
+				}
+			}
+		}
+	}
+	return ATFError_Invalid_Value
+}
+
+// Mark all the test cases in the report as the results of rerun.
+func (tr *TestReport) MarkRerun() {
+	if tr.TestSet != nil {
+		for _, tc := range tr.TestSet.Cases {
+			tc.Rerun = true
+		}
+	}
+}
+
 // Create an XML-encoded representation of the TestReport. 
 func (tr *TestReport) Xml() (x string, err error) {
 
@@ -69,6 +176,7 @@ func (tr *TestReport) Html() (string, error) {
 	var html = ""
 	if tr.TestSet != nil {
 		html += tr.addHeader2Html()
+		html += tr.addSlowest2Html(SlowestCount)
 		for _, tc := range tr.TestSet.Cases {
 			html += tr.addTestCase2Html(tc)
 		}
@@ -82,9 +190,37 @@ func (tr *TestReport) addHeader2Html() string {
 	html += fmt.Sprintf("<h1>Test Report: %s</h1>\n", tr.TestSet.Name)
 	html += fmt.Sprintln("<table>")
 	html += fmt.Sprintln("<tr><td><b>Execution Started</b></td>")
-	html += fmt.Sprintf("<td>%s</td></tr>\n", tr.Started)
+	html += fmt.Sprintf("<td>%s</td></tr>\n", tr.Started.Format(time.RFC3339))
 	html += fmt.Sprintln("<tr><td><b>Execution Finished</b></td>")
-	html += fmt.Sprintf("<td>%s</td></tr>\n", tr.Finished)
+	if tr.InProgress {
+		html += fmt.Sprintf("<td class=%q>in progress</td></tr>\n",
+			"nottested")
+	} else {
+		html += fmt.Sprintf("<td>%s</td></tr>\n",
+			tr.Finished.Format(time.RFC3339))
+		html += fmt.Sprintln("<tr><td><b>Duration</b></td>")
+		html += fmt.Sprintf("<td>%s</td></tr>\n", tr.Duration())
+	}
+	if tr.Aborted {
+		html += fmt.Sprintln("<tr><td><b>Execution Status</b></td>")
+		html += fmt.Sprintf("<td class=%q>aborted</td></tr>\n", "failed")
+	}
+	if tr.Initiator != "" {
+		html += fmt.Sprintln("<tr><td><b>Initiated By</b></td>")
+		html += fmt.Sprintf("<td>%s</td></tr>\n", tr.Initiator)
+	}
+	if tr.Host != "" {
+		html += fmt.Sprintln("<tr><td><b>Host</b></td>")
+		html += fmt.Sprintf("<td>%s</td></tr>\n", tr.Host)
+	}
+	if tr.Version != "" {
+		html += fmt.Sprintln("<tr><td><b>GoATF Version</b></td>")
+		html += fmt.Sprintf("<td>%s</td></tr>\n", tr.Version)
+	}
+	if tr.ConfigHash != "" {
+		html += fmt.Sprintln("<tr><td><b>Config Hash</b></td>")
+		html += fmt.Sprintf("<td>%s</td></tr>\n", tr.ConfigHash)
+	}
 	html += fmt.Sprintln("</table>")
 	html += fmt.Sprintln("<p />")
 	if tr.TestSet.Sut != nil {
@@ -126,16 +262,34 @@ func (tr *TestReport) addSut2Html(sut *SysUnderTest) string {
 // Add a test case data to HTML report.
 func (tr *TestReport) addTestCase2Html(tc *TestCase) string {
 	html := "<article>\n"
-	html += fmt.Sprintf("<h3>Test Case: %s</h3>", tc.Name)
+	html += fmt.Sprintf("<h3>Test Case: %s", tc.Name)
+	if tc.LogFile != "" {
+		html += fmt.Sprintf(" <small><a href=%q>log</a></small>", tc.LogFile)
+	}
+	if tc.Rerun {
+		html += " (rerun)"
+	}
+	if score, found := tr.Flakiness[tc.Name]; found && score > 0 {
+		html += fmt.Sprintf(" <small>flakiness: %.0f%%</small>", 100*score)
+	}
+	if tc.Quarantined {
+		html += " <small>(quarantined)</small>"
+	}
+	html += fmt.Sprintf(" <small>%s</small></h3>", tc.Duration)
+	if tc.Warning != "" {
+		html += fmt.Sprintf("<p class=%q>Warning: %s</p>\n", "nottested",
+			tc.Warning)
+	}
 	html += "<table>\n"
 	html += fmt.Sprintf("<tr><th class=%q>Name</th><th>Action</th>", "name")
 	html += fmt.Sprintf("<th class=%q>Expected Status</th>", "status")
-	html += fmt.Sprintf("<th class=%q>Status</th></tr>\n", "status")
+	html += fmt.Sprintf("<th class=%q>Status</th>", "status")
+	html += "<th>Duration</th></tr>\n"
     if tc.Setup != nil {
 	    html += fmt.Sprintf("<tr><td>Setup</td><td>%s</td><td>Pass</td>",
 		tc.Setup.String())
-	    html += fmt.Sprintf("<td class=%q>%s</td></tr>\n",
-		        resolveHtmlClass(tc.Setup), tc.Setup.Result)
+	    html += fmt.Sprintf("<td class=%q>%s</td><td>%s</td></tr>\n",
+		        resolveHtmlClass(tc.Setup), tc.Setup.Result, tc.Setup.Duration)
     }
 	for _, step := range tc.Steps {
 		html += tr.addStep2Html(step)
@@ -143,26 +297,161 @@ func (tr *TestReport) addTestCase2Html(tc *TestCase) string {
     if tc.Cleanup != nil {
 	    html += fmt.Sprintf("<tr><td>Cleanup</td><td>%s</td><td>Pass</td>",
 		        tc.Cleanup.String())
-	    html += fmt.Sprintf("<td class=%q>%s</td></tr>\n",
-		        resolveHtmlClass(tc.Cleanup), tc.Cleanup.Result)
+	    html += fmt.Sprintf("<td class=%q>%s</td><td>%s</td></tr>\n",
+		        resolveHtmlClass(tc.Cleanup), tc.Cleanup.Result,
+		        tc.Cleanup.Duration)
     }
 	html += fmt.Sprintln("</table><p />")
+	html += tr.addSutLog2Html(tc)
 	html += "</article>\n"
 	return html
 }
 
+// Add the SUT log messages received during the test case to HTML report.
+func (tr *TestReport) addSutLog2Html(tc *TestCase) string {
+	if len(tc.SutLog) == 0 {
+		return ""
+	}
+	html := fmt.Sprintf("<details><summary>SUT log (%d messages)</summary>\n",
+		len(tc.SutLog))
+	html += "<pre>"
+	for _, e := range tc.SutLog {
+		html += gohtml.EscapeString(e.String()) + "\n"
+	}
+	html += "</pre></details>\n"
+	return html
+}
+
 // Add a test step data to HTML report.
 func (tr *TestReport) addStep2Html(step *TestStep) string {
 	// let's see if step has passed and set the HTML class accordingly
     //fmt.Printf("DEBUG step: %s\n", step.String()) // DEBUG
 	class := resolveHtmlClass(step)
 	html := fmt.Sprintf("<tr><td>%s</td>", step.Name)
-	html += fmt.Sprintf("<td>%s</td><td>%s</td>",
-		step.Action.String(), step.Expected)
-	html += fmt.Sprintf("<td class=%q>%s</td></tr>\n", class, step.Status)
+	html += fmt.Sprintf("<td>%s", step.Action.String())
+	if step.ExpectLog != "" {
+		html += fmt.Sprintf("<br /><small>expects SUT log: %s</small>",
+			gohtml.EscapeString(step.ExpectLog))
+	}
+	html += fmt.Sprintf("</td><td>%s</td>", step.Expected)
+	html += fmt.Sprintf("<td class=%q>%s", class, step.Status)
+	if v := step.Verdict; v != nil {
+		html += fmt.Sprintf(" <small>(signed off by %s, %s)</small>",
+			v.Tester, v.Time.Format(time.RFC3339))
+	}
+	html += fmt.Sprintf("</td><td>%s</td></tr>\n", step.Duration)
+	return html
+}
+
+// The number of the slowest test cases and steps listed in the reports.
+const SlowestCount = 10
+
+// Returns (at most) N slowest test cases, the slowest first.
+func (tr *TestReport) SlowestCases(n int) []*TestCase {
+	cases := make([]*TestCase, 0)
+	if tr.TestSet != nil {
+		cases = append(cases, tr.TestSet.Cases...)
+	}
+	sort.SliceStable(cases, func(i, j int) bool {
+		return cases[i].Duration > cases[j].Duration
+	})
+	if len(cases) > n {
+		cases = cases[:n]
+	}
+	return cases
+}
+
+// Add a list of the slowest test cases to HTML report.
+func (tr *TestReport) addSlowest2Html(n int) string {
+	cases := tr.SlowestCases(n)
+	if len(cases) == 0 {
+		return ""
+	}
+	html := "<article>\n"
+	html += fmt.Sprintf("<h3>Slowest Test Cases</h3>\n")
+	html += "<table>\n"
+	html += fmt.Sprintf("<tr><th class=%q>Name</th>", "name")
+	html += fmt.Sprintf("<th class=%q>Status</th><th>Duration</th>", "status")
+	html += "<th>Budget</th></tr>\n"
+	for _, tc := range cases {
+		if tc.LogFile != "" {
+			html += fmt.Sprintf("<tr><td><a href=%q>%s</a></td>", tc.LogFile,
+				tc.Name)
+		} else {
+			html += fmt.Sprintf("<tr><td>%s</td>", tc.Name)
+		}
+		html += fmt.Sprintf("<td class=%q>%s</td>",
+			resolveResultClass(tc.Status), tc.Status)
+		html += fmt.Sprintf("<td>%s</td><td>%s</td></tr>\n", tc.Duration,
+			tc.Budget)
+	}
+	html += fmt.Sprintln("</table><p />")
+	html += "</article>\n"
 	return html
 }
 
+// Create a plain text representation of the TestReport: a summary of the
+// execution, the results of all test cases and steps with their durations and
+// the list of the slowest test cases.
+func (tr *TestReport) Text() (string, error) {
+	if tr.TestSet == nil {
+		return "", nil
+	}
+	s := fmt.Sprintf("Test Report: %s\n", tr.TestSet.Name)
+	s += fmt.Sprintf("Execution Started:  %s\n", tr.Started.Format(time.RFC3339))
+	if tr.InProgress {
+		s += "Execution Finished: in progress\n"
+	} else {
+		s += fmt.Sprintf("Execution Finished: %s\n",
+			tr.Finished.Format(time.RFC3339))
+		s += fmt.Sprintf("Duration:           %s\n", tr.Duration())
+	}
+	if tr.Aborted {
+		s += "Execution Status:   aborted\n"
+	}
+	if tr.Initiator != "" {
+		s += fmt.Sprintf("Initiated By:       %s\n", tr.Initiator)
+	}
+	if tr.Host != "" {
+		s += fmt.Sprintf("Host:               %s\n", tr.Host)
+	}
+	if tr.Version != "" {
+		s += fmt.Sprintf("GoATF Version:      %s\n", tr.Version)
+	}
+	if tr.ConfigHash != "" {
+		s += fmt.Sprintf("Config Hash:        %s\n", tr.ConfigHash)
+	}
+	if tr.TestSet.Sut != nil {
+		s += fmt.Sprintf("System Under Test:  %s %s\n", tr.TestSet.Sut.Name,
+			tr.TestSet.Sut.Version)
+	}
+	s += "\n"
+	for _, tc := range tr.TestSet.Cases {
+		s += fmt.Sprintf("%-10s %-12s %s\n", tc.Status, tc.Duration, tc.Name)
+		if tc.Warning != "" {
+			s += fmt.Sprintf("%23s warning: %s\n", "", tc.Warning)
+		}
+		for _, step := range tc.Steps {
+			s += fmt.Sprintf("  %-8s %-12s   %s\n", step.Status,
+				step.Duration, step.Name)
+			if v := step.Verdict; v != nil {
+				s += fmt.Sprintf("%26s signed off by %s, %s\n", "",
+					v.Tester, v.Time.Format(time.RFC3339))
+			}
+		}
+		if n := len(tc.SutLog); n > 0 {
+			s += fmt.Sprintf("%23s SUT log: %d messages\n", "", n)
+		}
+	}
+	if cases := tr.SlowestCases(SlowestCount); len(cases) > 0 {
+		s += "\nSlowest test cases:\n"
+		for _, tc := range cases {
+			s += fmt.Sprintf("  %-12s %s\n", tc.Duration, tc.Name)
+		}
+	}
+	return s, nil
+}
+
 // Takes a structure and determines which CSS class should be used in HTML 
 // report. Only 'Action' (for setup and cleanup actions) and 'TestStep' types 
 // are evaluated. The CSS classes are used to define background color according
@@ -172,29 +461,92 @@ func resolveHtmlClass(structure interface{}) (cls string) {
 	switch t := structure.(type) {
 
 	case *Action:
-		switch t.Result {
-		case "Pass":
-			cls = "passed"
-		case "Fail":
-			cls = "failed"
-		case "NotTested":
-			cls = "nottested"
-		}
+		cls = resolveResultClass(t.Result)
 
 	case *TestStep:
-		switch t.Status {
-		case "Pass":
-			cls = "passed"
-		case "Fail":
-			cls = "failed"
-		case "NotTested":
-			cls = "nottested"
-		}
+		cls = resolveResultClass(t.Status)
+	}
+	return cls
+}
+
+// Determines which CSS class should be used in HTML report for given test
+// result.
+func resolveResultClass(result TestResult) (cls string) {
+	switch result {
+	case "Pass":
+		cls = "passed"
+	case "Fail":
+		cls = "failed"
+	case "NotTested":
+		cls = "nottested"
 	}
 	return cls
 }
 
 // Creates a new TestSet instance.
 func CreateTestReport(ts *TestSet) *TestReport {
-	return &TestReport{ts, "", ""}
+	return &TestReport{ts, time.Time{}, time.Time{}, false, false, nil, "", "",
+		"", ""}
+}
+
+// The timestamp of the saved report: RFC 3339 or, in the reports saved by the
+// older versions, the local time in utils.NowFmt layout.
+type savedTime time.Time
+
+// Implementation of the encoding.TextUnmarshaler interface.
+func (t *savedTime) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*t = savedTime(time.Time{})
+		return nil
+	}
+	tm, err := time.Parse(time.RFC3339, string(text))
+	if err != nil {
+		tm, err = time.ParseInLocation(utils.NowFmt, string(text), time.Local)
+	}
+	if err != nil {
+		return err
+	}
+	*t = savedTime(tm)
+	return nil
+}
+
+// Load a previously saved TestReport from file. The report format is
+// determined by the file extension: both JSON and XML reports are supported.
+// Since the actions' flags are not a part of the saved report, they are
+// restored from the actions' contents; execution results are left intact.
+func LoadTestReport(filename string) (*TestReport, error) {
+
+	text, err := utils.ReadTextFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// the timestamps are decoded separately, so the reports saved with the
+	// old timestamps can be loaded, too
+	type report TestReport
+	tr := new(TestReport)
+	saved := struct {
+		*report
+		Started  savedTime
+		Finished savedTime
+	}{report: (*report)(tr)}
+	switch path.Ext(filename) {
+	case ".json":
+		err = json.Unmarshal([]byte(text), &saved)
+	case ".xml":
+		err = xml.Unmarshal([]byte(text), &saved)
+	default:
+		err = ATFError_Unknown_Report_Type
+	}
+	if err != nil {
+		return nil, err
+	}
+	tr.Started = time.Time(saved.Started)
+	tr.Finished = time.Time(saved.Finished)
+	if tr.TestSet == nil {
+		return nil, fmt.Errorf("Report %q does not contain a test set.",
+			filename)
+	}
+	tr.TestSet.restoreFlags()
+	return tr, nil
 }
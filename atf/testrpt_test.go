@@ -0,0 +1,88 @@
+package atf
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Creates a report with the test cases of given durations (in seconds),
+// named a, b, c...
+func durationReport(seconds ...int) *TestReport {
+	ts := &TestSet{Name: "set"}
+	for i, n := range seconds {
+		ts.Cases = append(ts.Cases, &TestCase{Name: string(rune('a' + i)),
+			Status: "Pass", Duration: time.Duration(n) * time.Second})
+	}
+	start := time.Date(2026, 10, 26, 8, 0, 0, 0, time.UTC)
+	return &TestReport{TestSet: ts, Started: start,
+		Finished: start.Add(time.Hour)}
+}
+
+func TestSlowestCases(t *testing.T) {
+	tests := []struct {
+		seconds  []int
+		n        int
+		expected string
+	}{
+		{[]int{1, 3, 2}, 10, "bca"},
+		{[]int{1, 3, 2, 5}, 2, "db"},
+		{[]int{2, 2, 1}, 2, "ab"}, // the equal ones keep their order
+		{[]int{}, 10, ""},
+	}
+	for _, test := range tests {
+		names := ""
+		for _, tc := range durationReport(test.seconds...).SlowestCases(
+			test.n) {
+			names += tc.Name
+		}
+		if names != test.expected {
+			t.Errorf("%v/%d: got %q, expected %q", test.seconds, test.n,
+				names, test.expected)
+		}
+	}
+	if n := len((&TestReport{}).SlowestCases(10)); n != 0 {
+		t.Errorf("empty report: got %d cases", n)
+	}
+}
+
+func TestReportDuration(t *testing.T) {
+	tr := durationReport()
+	if d := tr.Duration(); d != time.Hour {
+		t.Errorf("got %s, expected %s", d, time.Hour)
+	}
+	tr.Finished = time.Time{}
+	if d := tr.Duration(); d != 0 {
+		t.Errorf("unfinished: got %s, expected 0", d)
+	}
+}
+
+func TestReportTextDurations(t *testing.T) {
+	tr := durationReport(1, 90)
+	tr.TestSet.Cases[1].Budget = "1m"
+	tr.TestSet.Cases[1].checkBudget()
+	text, err := tr.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"Duration:           1h0m0s\n",
+		"Pass       1m30s        b\n",
+		"warning: duration 1m30s exceeds budget 1m0s\n",
+		"Slowest test cases:\n  1m30s        b\n  1s           a\n",
+	}
+	for _, s := range expected {
+		if !strings.Contains(text, s) {
+			t.Errorf("%q: missing in\n%s", s, text)
+		}
+	}
+
+	html, err := tr.Html()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html, "<h3>Slowest Test Cases</h3>") ||
+		!strings.Contains(html, "<td>1m30s</td><td>1m</td>") {
+		t.Errorf("slowest test cases missing in HTML report")
+	}
+}
@@ -18,9 +18,11 @@
 package atf
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"time"
     "bitbucket.org/miranr/goatf/atf/utils"
 )
 
@@ -74,11 +76,17 @@ func (ts *TestSet) ToTestPlan() *TestPlan {
 func (ts *TestSet) Initialize() {
 
     // Create empty actions for setup & cleanup, when empty
+    // (actions defined in config file must be initialized, otherwise they
+    // are never executed)
     if ts.Setup == nil {
         ts.Setup = CreateEmptyAction()
+    } else {
+        ts.Setup.Init()
     }
     if ts.Cleanup == nil {
         ts.Cleanup = CreateEmptyAction()
+    } else {
+        ts.Cleanup.Init()
     }
 
     for _, tcase := range ts.Cases {
@@ -86,6 +94,29 @@ func (ts *TestSet) Initialize() {
     }
 }
 
+// Restore the flags of all actions in the test set, without touching the
+// execution results. Used when test set is loaded from a saved report.
+func (ts *TestSet) restoreFlags() {
+
+    for _, act := range []*Action{ts.Setup, ts.Cleanup} {
+        if act != nil {
+            act.setFlags()
+        }
+    }
+    for _, tc := range ts.Cases {
+        for _, act := range []*Action{tc.Setup, tc.Cleanup} {
+            if act != nil {
+                act.setFlags()
+            }
+        }
+        for _, step := range tc.Steps {
+            if step.Action != nil {
+                step.Action.setFlags()
+            }
+        }
+    }
+}
+
 // Returns a plain text representation of the TestSet instance.
 func (ts *TestSet) String() string {
 	s := fmt.Sprintf("TestSet: %q", ts.Name)
@@ -141,6 +172,19 @@ func (ts *TestSet) Append(set ...*TestCase) {
     ts.Cases = append(ts.Cases, set...)
 }
 
+// Keep only the test cases with given names, preserving their order; all the
+// other test cases are removed from the test set. Setup and cleanup actions
+// of the test set are left intact.
+func (ts *TestSet) Select(names []string) {
+    selected := make([]*TestCase, 0, len(names))
+    for _, tc := range ts.Cases {
+        if containsString(names, tc.Name) {
+            selected = append(selected, tc)
+        }
+    }
+    ts.Cases = selected
+}
+
 // Performs a clenaup of data when execution of the setup action fails.
 func (ts *TestSet) CleanupAfterTsetSetupFail() string {
 	o := "Setup has FAILED\n"
@@ -151,49 +195,50 @@ func (ts *TestSet) CleanupAfterTsetSetupFail() string {
 			step.Status = "NotTested"
 		}
 	}
-	o += fmt.Sprintln("<<< Leaving test set %q", ts.Name)
 	return o
 }
 
-// Executes the entire TestSet.
-func (ts *TestSet) Execute(display *ExecDisplayFnCback) {
-
-	output := ""
+// Executes the entire TestSet; the progress is published onto the event bus.
+// When the context is cancelled, the execution is aborted: the running test
+// case is stopped, the remaining cases are skipped and only the cleanup
+// actions are executed (unless disabled, see SkipCleanupOnAbort()).
+func (ts *TestSet) Execute(ctx context.Context, events *EventBus) {
 
-	// define function from function pointer
-	disp := *display
+	events.Publish(&SetStarted{Set: ts})
+	start := time.Now()
 
-	// execute the cleanup action
-	disp("notice", fmt.Sprintf(">>> Entering Test Set %q\n", ts.Name))
-	if ts.Setup != nil && ts.Setup.IsExecutable() {
-		disp("notice", fmt.Sprintf("Executing setup script: %q\n",
-                ts.Setup.String()))
-		output = ts.Setup.Execute()
-		disp("info", FmtOutput(output))
+	// execute the setup action
+	if executeAction(ctx, nil, "setup", ts.Setup, events) &&
+		ts.Setup.Result == "Fail" {
 		// if setup script has failed, there's no need to proceed...
-		if ts.Setup.Result == "Fail" {
-			disp("error", ts.CleanupAfterTsetSetupFail())
-		}
-	} else {
-		disp("notice", fmt.Sprintln("Setup action is not defined."))
+		events.Message("error", ts.CleanupAfterTsetSetupFail())
 	}
 
-	// execute test cases
-	if ts.Cases != nil {
-		for _, tc := range ts.Cases {
-			tc.Execute(display)
+	// execute test cases; the cases already completed in the previous
+	// (interrupted) run are skipped, and so are all the remaining cases when
+	// the execution is aborted
+	for _, tc := range ts.Cases {
+		switch {
+		case tc.completed:
+			events.Publish(&CaseSkipped{Case: tc,
+				Reason: "already completed"})
+		case ctx.Err() != nil:
+			tc.Status = "NotTested"
+			for _, step := range tc.Steps {
+				step.Status = "NotTested"
+			}
+			events.Publish(&CaseSkipped{Case: tc, Reason: "aborted"})
+		default:
+			tc.Execute(ctx, events)
 		}
 	}
 
 	// execute the cleanup action
-	if ts.Cleanup != nil && ts.Cleanup.IsExecutable() {
-		disp("notice", fmt.Sprintf("Executing cleanup script: %q\n",
-                ts.Cleanup.String()))
-		disp("info", FmtOutput(ts.Cleanup.Execute()))
-	} else {
-		disp("notice", fmt.Sprintln("Cleanup action is not defined:"))
+	if cctx, ok := cleanupContext(ctx); ok {
+		executeAction(cctx, nil, "cleanup", ts.Cleanup, events)
 	}
-	disp("notice", fmt.Sprintf("<<< Leaving test set %q\n", ts.Name))
+	events.Publish(&SetFinished{Set: ts, Duration: time.Since(start),
+		Aborted: ctx.Err() != nil})
 }
 
 // Create a new instance of the TestSet type.
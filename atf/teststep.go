@@ -8,14 +8,19 @@
  * History:
  *  1   Apr10 MR Initial version, limited testing
  *  2   May14 MR Improved version, action and status handling is now accurate.
+ *  3   Oct26 MR The verdicts of the manual steps record the tester
+ *  4   Oct26 MR Steps can expect the SUT to log a message (ExpectLog)
  */
 
 package atf
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"regexp"
+	"time"
 )
 
 // Represents a single test step (action with additional data).
@@ -32,6 +37,25 @@ type TestStep struct {
 
 	/* every test step needs an action: either manual or executable */
 	Action *Action      `xml:"Action"`
+
+	/* execution duration of the step */
+	Duration time.Duration
+
+	/* the verdict of the tester, for manual steps only */
+	Verdict *Verdict `xml:",omitempty" json:",omitempty"`
+
+	/* a regular expression the SUT log must match while the step is
+	 * executed (see SutLog); otherwise the step fails */
+	ExpectLog string `xml:"expectlog,attr,omitempty" json:",omitempty"`
+}
+
+// Represents the verdict of the manual test step: who has tested it, when and
+// with what result.
+type Verdict struct {
+	Tester  string
+	Result  TestResult
+	Comment string `xml:",omitempty" json:",omitempty"`
+	Time    time.Time
 }
 
 // Returns a string representation of the TestStep instance.
@@ -109,25 +133,44 @@ func (ts *TestStep) Initialize() {
     }
 }
 
-// Execute the TestStep.
-func (ts *TestStep) Execute(display *ExecDisplayFnCback) {
+// Execute the TestStep; the progress is published onto the event bus. When the
+// context is cancelled, the running action is killed.
+func (ts *TestStep) Execute(ctx context.Context, events *EventBus) {
+	ts.execute(ctx, nil, events)
+}
+
+// Execute the TestStep that belongs to the given test case.
+func (ts *TestStep) execute(ctx context.Context, tc *TestCase,
+	events *EventBus) {
 
-	// we turn the function ptr back to function 
-	disp := *display
 
-	// and start the execution
-	disp("info", fmt.Sprintf(">>> Entering test step %q\n", ts.Name))
+	// start the execution
+	events.Publish(&StepStarted{Case: tc, Step: ts})
+	start := time.Now()
 
 	// we execute the action when it's not empty
+	output := ""
 	if ts.Action != nil && ts.Action.IsExecutable() {
-	    disp("notice", fmt.Sprintf("Executing test step action: %q\n",
-                ts.Action.String()))
-		disp("info", FmtOutput(ts.Action.Execute()))
+		ctx = WithLineHandler(ctx, func(line string) {
+			events.Publish(&ActionOutput{Case: tc, Step: ts, Line: line})
+		})
+		output = ts.Action.Execute(ctx)
 	} else {
-		disp("error", fmt.Sprintln("Action is EMPTY?????"))
+		events.Message("error", fmt.Sprintln("Action is EMPTY?????"))
 	}
 
-	// let's evaluate expectations and final status of the step
+	ts.evaluate()
+	if ts.ExpectLog != "" {
+		ts.checkLog(ctx, start, events)
+	}
+	ts.Duration = time.Since(start)
+	events.Publish(&StepFinished{Case: tc, Step: ts, Result: ts.Status,
+		Duration: ts.Duration, Output: output})
+}
+
+// Evaluate the final status of the step from its expected status and the
+// result of its action.
+func (ts *TestStep) evaluate() {
 	switch ts.Expected {
 	case "Pass":
 		if ts.Action.Result == "Pass" {
@@ -145,12 +188,67 @@ func (ts *TestStep) Execute(display *ExecDisplayFnCback) {
 		//only Pass & XFail are allowed as expected status 
 		ts.Status = "NotTested"
 	}
-	disp("notice", fmt.Sprintf("Test step evaluated to %q\n", ts.Status))
-    disp("info", fmt.Sprintf("<<< Leaving test step %q\n", ts.Name))
+}
+
+// Check that the SUT has logged the expected message since the step has been
+// started; waits a bit for the late messages (see SutLogGrace). The step that
+// passed fails when the message is missing; when the SUT log is not captured,
+// the step cannot be evaluated.
+func (ts *TestStep) checkLog(ctx context.Context, start time.Time,
+	events *EventBus) {
+
+	re, err := regexp.Compile(ts.ExpectLog)
+	if err != nil {
+		events.Message("error", fmt.Sprintf(
+			"Step %q: invalid log expectation: %s\n", ts.Name, err))
+		ts.Status = "Fail"
+		return
+	}
+	// the step that has not passed keeps its status
+	if ts.Status != "Pass" {
+		return
+	}
+	l, _ := ctx.Value(sutLogKey).(*SutLog)
+	if l == nil {
+		events.Message("warning", fmt.Sprintf(
+			"Step %q: SUT log is not captured, cannot check %q\n",
+			ts.Name, ts.ExpectLog))
+		ts.Status = "NotTested"
+		return
+	}
+	if !l.waitFor(ctx, re, start, time.Now().Add(SutLogGrace)) {
+		events.Message("error", fmt.Sprintf(
+			"Step %q: SUT has not logged %q\n", ts.Name, ts.ExpectLog))
+		ts.Status = "Fail"
+	}
+}
+
+// Record the verdict of the tester for the manual step: the result is either
+// "Pass" or "Fail" and the tester must be allowed to run the tests. The
+// status of the step is evaluated again.
+func (ts *TestStep) SetVerdict(tester *User, result TestResult,
+	comment string) error {
+
+	if ts.Action == nil || !ts.Action.IsManual() {
+		return ATFError_Invalid_Value
+	}
+	if result != "Pass" && result != "Fail" {
+		return ATFError_Invalid_Test_Result
+	}
+	if !tester.HasPermission(RunPermission) {
+		return ATFError_Permission_Denied
+	}
+	ts.Verdict = &Verdict{tester.Username, result, comment, time.Now()}
+	ts.Action.Result = result
+	if ts.Expected == "" {
+		ts.Expected = "Pass"
+	}
+	ts.evaluate()
+	return nil
 }
 
 // Create a new TestStep instance.
 func CreateTestStep(name string, descr string, expected TestResult,
 	status TestResult, act *Action) *TestStep {
-	return &TestStep{name, expected, status, act}
+	return &TestStep{name, expected, status, act, 0, nil, ""}
 }
@@ -0,0 +1,271 @@
+/*
+ * token.go - API tokens: the non-interactive credentials of the users
+ *
+ * An API token is issued to a user; it is scoped to a role (the same as or
+ * less privileged than the user's role), it may expire and it can be revoked.
+ * The token itself is displayed only once, when it is created: it consists
+ * of the token ID and the secret ("goatf_<id>_<secret>"), while only the
+ * bcrypt hash of the secret is stored (see HashPassword()).
+ */
+
+package atf
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"bitbucket.org/miranr/goatf/atf/utils"
+)
+
+// The prefix of the API tokens.
+const tokenPrefix = "goatf_"
+
+// ApiToken defines a single API token.
+type ApiToken struct {
+	ID       string
+	Username string     // the owner of the token
+	Role     string     // the role the token is scoped to
+	Hash     string     // bcrypt hash of the secret
+	Descr    string     `json:",omitempty"`
+	Created  time.Time
+	Expires  *time.Time `json:",omitempty"` // nil: never expires
+	Revoked  *time.Time `json:",omitempty"`
+}
+
+// Returns a plain text representation of the ApiToken instance.
+func (t *ApiToken) String() string {
+	return fmt.Sprintf("ApiToken %s: user=%s, role=%s", t.ID, t.Username,
+		t.Role)
+}
+
+// Returns random bytes encoded as hex string.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic("Cannot read random bytes.")
+	}
+	return hex.EncodeToString(b)
+}
+
+// Creates a new API token for the user. The token is scoped to given role
+// (the user's role when empty), which must not be more privileged than the
+// user's role. The token expires after ttl (never, if zero). Returns the new
+// token and its plain-text value; the latter cannot be retrieved later.
+func NewApiToken(u *User, role string, ttl time.Duration,
+	descr string) (*ApiToken, string, error) {
+
+	if role == "" {
+		role = u.Role
+	}
+	t := &ApiToken{ID: randomHex(6), Username: u.Username, Descr: descr,
+		Created: time.Now()}
+	// SetRole() of a temporary user validates (and normalizes) the role
+	scope := &User{}
+	if err := scope.SetRole(role); err != nil {
+		return nil, "", err
+	}
+	if roleRank(scope.Role) < roleRank(u.Role) {
+		return nil, "", ATFError_Permission_Denied
+	}
+	t.Role = scope.Role
+	if ttl > 0 {
+		expires := t.Created.Add(ttl)
+		t.Expires = &expires
+	}
+	secret := randomHex(24)
+	t.Hash = HashPassword(secret)
+	return t, tokenPrefix + t.ID + "_" + secret, nil
+}
+
+// Checks whether the token is valid at given time: it is not revoked and it
+// has not expired yet.
+func (t *ApiToken) Valid(now time.Time) bool {
+	return t.Revoked == nil && (t.Expires == nil || now.Before(*t.Expires))
+}
+
+// Revokes the token; the revoked token cannot be used anymore.
+func (t *ApiToken) Revoke() {
+	if t.Revoked == nil {
+		now := time.Now()
+		t.Revoked = &now
+	}
+}
+
+// Splits the plain-text token into the ID and the secret.
+func parseToken(token string) (id, secret string, ok bool) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(token[len(tokenPrefix):], "_")
+	return
+}
+
+// Authenticates the user using the plain-text API token. The returned user
+// has the role the token is scoped to (or the user's current role, if it is
+// less privileged), so the permissions are granted accordingly.
+func AuthenticateToken(users UserStore, tokens TokenStore,
+	token string) (*User, *ApiToken, error) {
+
+	id, secret, ok := parseToken(token)
+	if !ok {
+		return nil, nil, ATFError_Authentication_Failed
+	}
+	t, err := tokens.Get(id)
+	if err == ATFError_Token_Not_Found {
+		return nil, nil, ATFError_Authentication_Failed
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !t.Valid(time.Now()) || !ComparePasswords(t.Hash, secret) {
+		return nil, nil, ATFError_Authentication_Failed
+	}
+	u, err := users.Get(t.Username)
+	if err == ATFError_User_Not_Found {
+		return nil, nil, ATFError_Authentication_Failed
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if roleRank(t.Role) > roleRank(u.Role) {
+		u.Role = t.Role
+	}
+	return u, t, nil
+}
+
+// TokenStore interface defines the operations on the stored API tokens.
+type TokenStore interface {
+
+	// returns the token with given ID
+	Get(id string) (*ApiToken, error)
+
+	// returns all the tokens, ordered by creation time
+	List() ([]*ApiToken, error)
+
+	// adds a new token
+	Add(t *ApiToken) error
+
+	// updates the existing token (e.g. when revoked)
+	Update(t *ApiToken) error
+}
+
+// A file-backed TokenStore: the tokens are stored as a JSON list in a single
+// file that is read on every operation (see FileUserStore).
+type FileTokenStore struct {
+	filename string
+	mutex    sync.Mutex
+}
+
+// Opens the token store in given file; the file is created when the first
+// token is added.
+func OpenFileTokenStore(filename string) *FileTokenStore {
+	return &FileTokenStore{filename: filename}
+}
+
+// Returns a plain text representation of the FileTokenStore instance.
+func (s *FileTokenStore) String() string {
+	return "FileTokenStore: " + s.filename
+}
+
+// Reads all the tokens from the file.
+func (s *FileTokenStore) load() (map[string]*ApiToken, error) {
+	tokens := make(map[string]*ApiToken)
+	b, err := os.ReadFile(s.filename)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*ApiToken, 0)
+	if err = json.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+	for _, t := range list {
+		tokens[t.ID] = t
+	}
+	return tokens, nil
+}
+
+// Writes all the tokens into the file; only the owner can read it.
+func (s *FileTokenStore) save(tokens map[string]*ApiToken) error {
+	b, err := json.MarshalIndent(sortTokens(tokens), "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(s.filename, string(b), 0600)
+}
+
+// Returns the tokens ordered by creation time.
+func sortTokens(tokens map[string]*ApiToken) []*ApiToken {
+	list := make([]*ApiToken, 0, len(tokens))
+	for _, t := range tokens {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.Before(list[j].Created)
+	})
+	return list
+}
+
+// Returns the token with given ID.
+func (s *FileTokenStore) Get(id string) (*ApiToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	t, found := tokens[id]
+	if !found {
+		return nil, ATFError_Token_Not_Found
+	}
+	return t, nil
+}
+
+// Returns all the tokens, ordered by creation time.
+func (s *FileTokenStore) List() ([]*ApiToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return sortTokens(tokens), nil
+}
+
+// Adds a new token.
+func (s *FileTokenStore) Add(t *ApiToken) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, found := tokens[t.ID]; found {
+		return ATFError_Invalid_Value
+	}
+	tokens[t.ID] = t
+	return s.save(tokens)
+}
+
+// Updates the existing token.
+func (s *FileTokenStore) Update(t *ApiToken) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, found := tokens[t.ID]; !found {
+		return ATFError_Token_Not_Found
+	}
+	tokens[t.ID] = t
+	return s.save(tokens)
+}
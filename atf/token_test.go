@@ -0,0 +1,118 @@
+package atf
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewApiTokenScope(t *testing.T) {
+	tests := []struct {
+		user, scope, expected string
+		err                   error
+	}{
+		{"admin", "", "admin", nil},
+		{"admin", "guest", "guest", nil},
+		{"user", "user", "user", nil},
+		{"user", "admin", "", ATFError_Permission_Denied},
+		{"guest", "user", "", ATFError_Permission_Denied},
+	}
+	for _, test := range tests {
+		u := &User{Username: "alice", Role: test.user}
+		token, _, err := NewApiToken(u, test.scope, 0, "")
+		if err != test.err {
+			t.Errorf("%s/%q: got error %v, expected %v", test.user,
+				test.scope, err, test.err)
+			continue
+		}
+		if err == nil && token.Role != test.expected {
+			t.Errorf("%s/%q: got role %q, expected %q", test.user,
+				test.scope, token.Role, test.expected)
+		}
+	}
+	u := &User{Username: "alice", Role: "user"}
+	if _, _, err := NewApiToken(u, "root", 0, ""); err == nil {
+		t.Errorf("invalid role accepted")
+	}
+}
+
+func TestApiTokenValid(t *testing.T) {
+	u := &User{Username: "alice", Role: "user"}
+	token, _, err := NewApiToken(u, "", time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forever, _, err := NewApiToken(u, "", 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := token.Created
+	tests := []struct {
+		name     string
+		token    *ApiToken
+		at       time.Time
+		expected bool
+	}{
+		{"fresh", token, now, true},
+		{"before expiry", token, now.Add(59 * time.Minute), true},
+		{"at expiry", token, now.Add(time.Hour), false},
+		{"expired", token, now.Add(2 * time.Hour), false},
+		{"never expires", forever, now.Add(24 * 365 * time.Hour), true},
+	}
+	for _, test := range tests {
+		if got := test.token.Valid(test.at); got != test.expected {
+			t.Errorf("%q: got %t, expected %t", test.name, got,
+				test.expected)
+		}
+	}
+	forever.Revoke()
+	if forever.Valid(now) {
+		t.Errorf("revoked token is valid")
+	}
+}
+
+func TestAuthenticateTokenDowngrade(t *testing.T) {
+	dir := t.TempDir()
+	users := OpenFileUserStore(filepath.Join(dir, "users.json"))
+	tokens := OpenFileTokenStore(filepath.Join(dir, "tokens.json"))
+	u := &User{Username: "alice", Role: "admin"}
+	if err := users.Add(u); err != nil {
+		t.Fatal(err)
+	}
+	token, secret, err := NewApiToken(u, "user", 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tokens.Add(token); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct{ role, expected string }{
+		{"admin", "user"},  // the token is scoped to a less privileged role
+		{"guest", "guest"}, // the user has been demoted since
+	}
+	for _, test := range tests {
+		u.Role = test.role
+		if err = users.Update(u); err != nil {
+			t.Fatal(err)
+		}
+		authenticated, _, err := AuthenticateToken(users, tokens, secret)
+		if err != nil {
+			t.Fatalf("%s: %s", test.role, err)
+		}
+		if authenticated.Role != test.expected {
+			t.Errorf("%s: got role %q, expected %q", test.role,
+				authenticated.Role, test.expected)
+		}
+	}
+
+	token.Revoke()
+	if err = tokens.Update(token); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = AuthenticateToken(users, tokens, secret)
+	if err != ATFError_Authentication_Failed {
+		t.Errorf("revoked token: got error %v, expected %v", err,
+			ATFError_Authentication_Failed)
+	}
+}
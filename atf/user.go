@@ -27,6 +27,48 @@ type User struct {
 // A list of allowed user roles
 var AllowedRoles = []string{"admin", "user", "guest"}
 
+// Permission defines what a user is allowed to do.
+type Permission int
+
+const (
+    // view the runs and their reports
+    ViewPermission Permission = iota
+
+    // start and cancel the runs
+    RunPermission
+
+    // manage users and other administrative tasks
+    AdminPermission
+)
+
+// The permissions granted to the user roles.
+var RolePermissions = map[string][]Permission{
+    "admin": {ViewPermission, RunPermission, AdminPermission},
+    "user":  {ViewPermission, RunPermission},
+    "guest": {ViewPermission},
+}
+
+// Check whether the user's role grants the given permission.
+func (u *User) HasPermission(p Permission) bool {
+    for _, granted := range RolePermissions[u.Role] {
+        if granted == p {
+            return true
+        }
+    }
+    return false
+}
+
+// Returns the rank of the role: the lower the rank, the more privileged the
+// role is. Unknown roles have the lowest privileges.
+func roleRank(role string) int {
+    for i, r := range AllowedRoles {
+        if role == r {
+            return i
+        }
+    }
+    return len(AllowedRoles)
+}
+
 // String representation of the User 
 func (u *User) String() (s string) {
 	s = fmt.Sprintf("%s [%s]: %s %q", u.Username, u.Email, u.Password, u.Role)
@@ -62,19 +104,27 @@ func (u *User) SetRole(role string) error {
 
 // Create a new user with username, password and role as mandatory information.
 // This one is used to create a non-existing user (in some sort of DB), so role
-// is a vital information about the user.
+// is a vital information about the user. The password is hashed.
 func CreateNewUser(username, password, role string) (*User, error) {
-	p := new(Password)
-	p.Set(password)
-    u := &User{username, p.Get(), "", "user", ""}
+    u := CreateUser(username, password)
     if err := u.SetRole(role); err != nil { return nil, err }
 	return u, nil
 }
 
-// Create a user with username and password. This one is used to authenticate
-// the existing user (role is stored in some DB...)
+// Create a user with username and (hashed) password and the default "user"
+// role. Note that the existing users are not authenticated by creating them
+// anew (every hash of the same password is different), use CheckPassword()
+// or Authenticate() instead.
 func CreateUser(username, password string) *User {
-	p := new(Password)
-	p.Set(password)
-    return &User{username, p.Get(), "", "user", ""}
+    return &User{username, HashPassword(password), "", "user", ""}
+}
+
+// Check the plain-text password against the user's hashed password.
+func (u *User) CheckPassword(password string) bool {
+    return ComparePasswords(u.Password, password)
+}
+
+// Set the new password; it is hashed, of course.
+func (u *User) SetPassword(password string) {
+    u.Password = HashPassword(password)
 }
@@ -0,0 +1,204 @@
+/*
+ * userstore.go - the storage of the users
+ *
+ * The UserStore interface defines the operations on the stored users; the
+ * FileUserStore implements it using a single JSON file (a list of users with
+ * bcrypt-hashed passwords). Users are authenticated against the store, and
+ * they can change their passwords after they are authenticated.
+ */
+
+package atf
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"bitbucket.org/miranr/goatf/atf/utils"
+)
+
+// UserStore interface defines the operations on the stored users.
+type UserStore interface {
+
+	// returns the user with given username
+	Get(username string) (*User, error)
+
+	// returns all the users, ordered by username
+	List() ([]*User, error)
+
+	// adds a new user; fails if the user already exists
+	Add(u *User) error
+
+	// updates the existing user; fails if the user does not exist
+	Update(u *User) error
+
+	// deletes the user with given username
+	Delete(username string) error
+}
+
+// Authenticate the user with given username and plain-text password against
+// the store. Returns the authenticated user.
+func Authenticate(s UserStore, username, password string) (*User, error) {
+	u, err := s.Get(username)
+	if err == ATFError_User_Not_Found {
+		// do not reveal whether the user exists or not
+		return nil, ATFError_Authentication_Failed
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !u.CheckPassword(password) {
+		return nil, ATFError_Authentication_Failed
+	}
+	return u, nil
+}
+
+// Change the password of the user; the old password must be given, so the
+// user is authenticated first.
+func ChangePassword(s UserStore, username, oldpwd, newpwd string) error {
+	u, err := Authenticate(s, username, oldpwd)
+	if err != nil {
+		return err
+	}
+	u.SetPassword(newpwd)
+	return s.Update(u)
+}
+
+// A file-backed UserStore: the users are stored as a JSON list in a single
+// file. The file is read on every operation, so the changes made by other
+// processes (e.g. 'goatf user' CLI while the server is running) are visible
+// immediately.
+type FileUserStore struct {
+	filename string
+	mutex    sync.Mutex
+}
+
+// Opens the user store in given file; the file is created when the first
+// user is added.
+func OpenFileUserStore(filename string) *FileUserStore {
+	return &FileUserStore{filename: filename}
+}
+
+// Returns a plain text representation of the FileUserStore instance.
+func (s *FileUserStore) String() string {
+	return "FileUserStore: " + s.filename
+}
+
+// Reads all the users from the file.
+func (s *FileUserStore) load() (map[string]*User, error) {
+	users := make(map[string]*User)
+	b, err := os.ReadFile(s.filename)
+	if os.IsNotExist(err) {
+		return users, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*User, 0)
+	if err = json.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+	for _, u := range list {
+		users[u.Username] = u
+	}
+	return users, nil
+}
+
+// Writes all the users into the file; only the owner can read it, since it
+// contains the password hashes.
+func (s *FileUserStore) save(users map[string]*User) error {
+	b, err := json.MarshalIndent(sortUsers(users), "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(s.filename, string(b), 0600)
+}
+
+// Returns the users ordered by username.
+func sortUsers(users map[string]*User) []*User {
+	list := make([]*User, 0, len(users))
+	for _, u := range users {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Username < list[j].Username
+	})
+	return list
+}
+
+// Returns the user with given username.
+func (s *FileUserStore) Get(username string) (*User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	users, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	u, found := users[username]
+	if !found {
+		return nil, ATFError_User_Not_Found
+	}
+	return u, nil
+}
+
+// Returns all the users, ordered by username.
+func (s *FileUserStore) List() ([]*User, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	users, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return sortUsers(users), nil
+}
+
+// Adds a new user; the role of the user must be valid.
+func (s *FileUserStore) Add(u *User) error {
+	if u.Username == "" || u.SetRole(u.Role) != nil {
+		return ATFError_Invalid_Value
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	users, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, found := users[u.Username]; found {
+		return ATFError_User_Exists
+	}
+	users[u.Username] = u
+	return s.save(users)
+}
+
+// Updates the existing user; the role of the user must be valid.
+func (s *FileUserStore) Update(u *User) error {
+	if u.SetRole(u.Role) != nil {
+		return ATFError_Invalid_Value
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	users, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, found := users[u.Username]; !found {
+		return ATFError_User_Not_Found
+	}
+	users[u.Username] = u
+	return s.save(users)
+}
+
+// Deletes the user with given username.
+func (s *FileUserStore) Delete(username string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	users, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, found := users[username]; !found {
+		return ATFError_User_Not_Found
+	}
+	delete(users, username)
+	return s.save(users)
+}
@@ -0,0 +1,170 @@
+package atf
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Opens a new user store with the users "alice" (admin) and "bob" (user).
+func userStoreFixture(t *testing.T) (*FileUserStore, string) {
+	filename := filepath.Join(t.TempDir(), "users.json")
+	s := OpenFileUserStore(filename)
+	for _, u := range []struct{ name, password, role string }{
+		{"alice", "secret1", "admin"},
+		{"bob", "secret2", "user"},
+	} {
+		user, err := CreateNewUser(u.name, u.password, u.role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = s.Add(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s, filename
+}
+
+func TestFileUserStore(t *testing.T) {
+	s, _ := userStoreFixture(t)
+	tests := []struct {
+		name     string
+		op       func() error
+		expected error
+	}{
+		{"duplicate", func() error {
+			return s.Add(CreateUser("bob", "other"))
+		}, ATFError_User_Exists},
+		{"no username", func() error {
+			return s.Add(CreateUser("", "other"))
+		}, ATFError_Invalid_Value},
+		{"invalid role", func() error {
+			return s.Add(&User{Username: "carol", Role: "root"})
+		}, ATFError_Invalid_Value},
+		{"update missing", func() error {
+			return s.Update(CreateUser("carol", "other"))
+		}, ATFError_User_Not_Found},
+		{"delete", func() error { return s.Delete("bob") }, nil},
+		{"delete again", func() error {
+			return s.Delete("bob")
+		}, ATFError_User_Not_Found},
+		{"get deleted", func() error {
+			_, err := s.Get("bob")
+			return err
+		}, ATFError_User_Not_Found},
+		{"add deleted", func() error {
+			return s.Add(CreateUser("bob", "other"))
+		}, nil},
+	}
+	for _, test := range tests {
+		if err := test.op(); err != test.expected {
+			t.Errorf("%q: got error %v, expected %v", test.name, err,
+				test.expected)
+		}
+	}
+	users, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Username != "alice" ||
+		users[1].Username != "bob" {
+		t.Errorf("got users %v, expected alice and bob", users)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	s, _ := userStoreFixture(t)
+	tests := []struct {
+		username, password string
+		expected           error
+	}{
+		{"alice", "secret1", nil},
+		{"alice", "secret2", ATFError_Authentication_Failed},
+		{"alice", "", ATFError_Authentication_Failed},
+		{"carol", "secret1", ATFError_Authentication_Failed},
+	}
+	for _, test := range tests {
+		u, err := Authenticate(s, test.username, test.password)
+		if err != test.expected {
+			t.Errorf("%s/%q: got error %v, expected %v", test.username,
+				test.password, err, test.expected)
+			continue
+		}
+		if err == nil && u.Username != test.username {
+			t.Errorf("%s/%q: got user %q", test.username, test.password,
+				u.Username)
+		}
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	s, filename := userStoreFixture(t)
+	if err := ChangePassword(s, "bob", "wrong", "new"); err !=
+		ATFError_Authentication_Failed {
+		t.Errorf("wrong old password: got error %v, expected %v", err,
+			ATFError_Authentication_Failed)
+	}
+	if err := ChangePassword(s, "bob", "secret2", "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the change is persisted: a store reloaded from the file sees it
+	reloaded := OpenFileUserStore(filename)
+	tests := []struct {
+		password string
+		expected error
+	}{
+		{"secret2", ATFError_Authentication_Failed},
+		{"new", nil},
+	}
+	for _, test := range tests {
+		if _, err := Authenticate(reloaded, "bob", test.password); err !=
+			test.expected {
+			t.Errorf("%q: got error %v, expected %v", test.password, err,
+				test.expected)
+		}
+	}
+	u, err := reloaded.Get("alice")
+	if err != nil || u.Role != "admin" {
+		t.Errorf("alice: got %v (%v), expected admin", u, err)
+	}
+
+	// the file contains the password hashes, so only the owner can read it
+	if fi, err := os.Stat(filename); err != nil {
+		t.Fatal(err)
+	} else if perm := fi.Mode().Perm(); perm&0077 != 0 &&
+		runtime.GOOS != "windows" {
+		t.Errorf("got permissions %o, expected 0600", perm)
+	}
+}
+
+func TestUserPermissions(t *testing.T) {
+	tests := []struct {
+		role             string
+		view, run, admin bool
+	}{
+		{"admin", true, true, true},
+		{"user", true, true, false},
+		{"guest", true, false, false},
+	}
+	for _, test := range tests {
+		u := &User{Username: "alice", Role: test.role}
+		got := []bool{u.HasPermission(ViewPermission),
+			u.HasPermission(RunPermission), u.HasPermission(AdminPermission)}
+		expected := []bool{test.view, test.run, test.admin}
+		for i := range got {
+			if got[i] != expected[i] {
+				t.Errorf("%s: permission %d: got %t, expected %t", test.role,
+					i, got[i], expected[i])
+			}
+		}
+	}
+	if _, err := CreateNewUser("alice", "secret", "root"); err == nil {
+		t.Errorf("invalid role accepted")
+	}
+	if u, err := CreateNewUser("alice", "secret", "Administrator"); err !=
+		nil || u.Role != "admin" {
+		t.Errorf("got %v (%v), expected admin", u, err)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -89,6 +90,52 @@ func WriteTextFile(path string, contents string) (err error) {
 	return
 }
 
+/*
+ * WriteTextFileAtomic - write a text file with given path atomically
+ *
+ * The contents are written into a temporary file in the same directory first,
+ * which is then renamed to the given path. The readers of the file therefore
+ * always see either the old or the new contents, never a partially written
+ * file.
+ */
+func WriteTextFileAtomic(path string, contents string) (err error) {
+	return WriteFileAtomic(path, contents, 0644)
+}
+
+/*
+ * WriteFileAtomic - atomically replace the file with the given contents and
+ * permissions (see WriteTextFileAtomic)
+ */
+func WriteFileAtomic(path string, contents string,
+	perm os.FileMode) (err error) {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, "."+name+".tmp")
+	if err != nil {
+		return
+	}
+	tmp := f.Name()
+	_, err = f.Write([]byte(contents))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return
+}
+
 /*
  * CopyFile - copy a file from source 'src' to destination (dst)
  *
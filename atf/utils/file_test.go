@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "report.json")
+	if err := os.WriteFile(filename, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(filename, "new", 0600); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := ReadTextFile(filename); s != "new" {
+		t.Errorf("got %q, expected %q", s, "new")
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+		t.Errorf("got permissions %o, expected 600", fi.Mode().Perm())
+	}
+	// the temporary file has been renamed
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("got %d files in the directory, expected 1", len(entries))
+	}
+
+	// the file is not created when the directory is missing
+	missing := filepath.Join(dir, "none", "report.json")
+	if err = WriteTextFileAtomic(missing, "new"); err == nil {
+		t.Errorf("%q: no error", missing)
+	}
+	if FileExists(missing) {
+		t.Errorf("%q: file created", missing)
+	}
+}
+
+func TestWriteFileAtomicFailure(t *testing.T) {
+	dir := t.TempDir()
+	// a directory cannot be replaced by a file: the rename fails
+	target := filepath.Join(dir, "report.json")
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteTextFileAtomic(target, "new"); err == nil {
+		t.Fatalf("%q: no error", target)
+	}
+	if !IsDir(target) {
+		t.Errorf("%q: the original has been replaced", target)
+	}
+	// and the temporary file is removed
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("got %d files in the directory, expected 1", len(entries))
+	}
+}
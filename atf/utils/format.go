@@ -0,0 +1,157 @@
+/*
+ * format.go - formatting of the log messages
+ *
+ * The text log handlers (file, console, per-case files) format the messages
+ * using the Formatter. The TemplateFormatter uses a simple template with the
+ * named fields in braces, e.g. "{time} {severity} [{case}] {message}":
+ *
+ *   {time}      the timestamp, formatted using the time layout
+ *   {severity}  the severity name, e.g. "NOTICE"
+ *   {source}    the source of the messages, e.g. "goatf"
+ *   {context}   the test context: "set/case/step" (only the known parts)
+ *   {set}       the test set being executed
+ *   {case}      the test case being executed
+ *   {step}      the test step being executed
+ *   {message}   the message itself
+ */
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The default log format and time layout.
+const (
+	DefaultLogFormat  = "{time} {severity} {message}"
+	DefaultTimeLayout = NowFmt
+)
+
+// LogRecord is the log message with all its attributes, as passed to the
+// formatter.
+type LogRecord struct {
+	Time     time.Time
+	Severity Severity
+	Source   string
+	Context  LogContext
+	Msg      string
+}
+
+// Formatter formats the log record into the line of text (with the trailing
+// newline).
+type Formatter interface {
+	Format(r *LogRecord) string
+}
+
+// A part of the template: either the literal text or the field name.
+type templatePart struct {
+	text  string
+	field bool
+}
+
+// The fields known to the TemplateFormatter.
+var templateFields = map[string]bool{"time": true, "severity": true,
+	"source": true, "context": true, "set": true, "case": true, "step": true,
+	"message": true}
+
+// TemplateFormatter formats the records according to the template with the
+// named fields (see above).
+type TemplateFormatter struct {
+	template   string
+	parts      []templatePart
+	TimeLayout string // the layout of the {time} field (see time.Format)
+	Source     string // the value of the {source} field
+}
+
+// Creates a new template formatter; the unknown fields, unbalanced braces and
+// the templates without any field are reported as errors. The empty time layout means the
+// default one.
+func NewTemplateFormatter(template, layout string) (*TemplateFormatter,
+	error) {
+	if layout == "" {
+		layout = DefaultTimeLayout
+	}
+	f := &TemplateFormatter{template: template, TimeLayout: layout,
+		parts: make([]templatePart, 0)}
+	rest := template
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			if strings.IndexByte(rest, '}') >= 0 {
+				return nil, fmt.Errorf("log format %q: unbalanced '}'",
+					template)
+			}
+			f.parts = append(f.parts, templatePart{rest, false})
+			break
+		}
+		if open > 0 {
+			f.parts = append(f.parts, templatePart{rest[:open], false})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("log format %q: unbalanced '{'", template)
+		}
+		name := rest[open+1 : open+end]
+		if !templateFields[name] {
+			return nil, fmt.Errorf("log format %q: unknown field {%s}",
+				template, name)
+		}
+		f.parts = append(f.parts, templatePart{name, true})
+		rest = rest[open+end+1:]
+	}
+	for _, p := range f.parts {
+		if p.field {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("log format %q: no fields", template)
+}
+
+// Returns the template of the formatter.
+func (f *TemplateFormatter) String() string { return f.template }
+
+// Formats the record; the message is always terminated by a single newline.
+func (f *TemplateFormatter) Format(r *LogRecord) string {
+	var b strings.Builder
+	for _, p := range f.parts {
+		if !p.field {
+			b.WriteString(p.text)
+			continue
+		}
+		switch p.text {
+		case "time":
+			b.WriteString(r.Time.Format(f.TimeLayout))
+		case "severity":
+			b.WriteString(r.Severity.String())
+		case "source":
+			b.WriteString(f.Source)
+		case "context":
+			parts := make([]string, 0, 3)
+			for _, s := range []string{r.Context.TestSet, r.Context.TestCase,
+				r.Context.TestStep} {
+				if s != "" {
+					parts = append(parts, s)
+				}
+			}
+			b.WriteString(strings.Join(parts, "/"))
+		case "set":
+			b.WriteString(r.Context.TestSet)
+		case "case":
+			b.WriteString(r.Context.TestCase)
+		case "step":
+			b.WriteString(r.Context.TestStep)
+		case "message":
+			b.WriteString(strings.TrimRight(r.Msg, "\n"))
+		}
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// The formatter used when the format given to the handler is not valid.
+func defaultFormatter() *TemplateFormatter {
+	f, _ := NewTemplateFormatter(DefaultLogFormat, DefaultTimeLayout)
+	return f
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTemplateFormatter(t *testing.T) {
+	r := &LogRecord{time.Date(2026, 10, 26, 8, 30, 0, 0, time.UTC), Warning,
+		"", LogContext{"set", "case", ""}, "message\n"}
+	tests := []struct{ template, layout, expected string }{
+		{DefaultLogFormat, "", "2026-10-26 08:30:00 WARNING message\n"},
+		{"{time} [{context}] {message}", "15:04",
+			"08:30 [set/case] message\n"},
+		{"{source}:{severity}:{set}:{case}:{step}:{message}", "",
+			"goatf:WARNING:set:case::message\n"},
+	}
+	for _, test := range tests {
+		f, err := NewTemplateFormatter(test.template, test.layout)
+		if err != nil {
+			t.Fatalf("%q: %s", test.template, err)
+		}
+		f.Source = "goatf"
+		if s := f.Format(r); s != test.expected {
+			t.Errorf("%q: got %q, expected %q", test.template, s,
+				test.expected)
+		}
+	}
+	for _, template := range []string{"{time} {sev}", "{time", "time}",
+		"%s %s %s", ""} {
+		if _, err := NewTemplateFormatter(template, ""); err == nil {
+			t.Errorf("%q: invalid template accepted", template)
+		}
+	}
+}
@@ -9,13 +9,29 @@
  *                  Severity is now used instead. The second is introduction of
  *                  concurency: log can now run as goroutine and messages are
  *                  sent over a channel.
+ *  3   Oct26   MR  The log context: what is being executed when the message
+ *                  is logged (used by syslog handler)
+ *  4   Oct26   MR  The common handler core: no more busy-looping goroutines,
+ *                  the buffered messages are flushed on close, configurable
+ *                  buffer size and overflow policy.
+ *  5   Oct26   MR  JSON file handler and per-case log files.
+ *  6   Oct26   MR  Log file rotation (see rotate.go).
+ *  7   Oct26   MR  The text handlers use the formatters (see format.go).
  */
 
 package utils
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,27 +41,105 @@ type LogHandler interface {
     Severity() Severity
     SetSeverity(Severity)
     Format() string
-    SetFormat(fmt string)
+    SetFormat(fmt string) error
+    SetFormatter(f Formatter)
 	String() string
+    SetBufferSize(n int)
+    SetOverflow(p OverflowPolicy)
+    SetFlushTimeout(d time.Duration)
+    Dropped() uint64
     Start() error
 	Close()
     Send(Severity, string)
 }
 
 /************************** logHandler ***********************************/
-// a private struct that defines log handler data structures
+// OverflowPolicy defines what happens when a message is sent to the handler
+// whose buffer is full.
+type OverflowPolicy int
+
+const (
+	// the sender waits until there is room in the buffer (no message is lost)
+	OverflowBlock OverflowPolicy = iota
+
+	// the oldest buffered message is dropped to make room for the new one,
+	// so the sender never waits
+	OverflowDropOldest
+)
+
+// Returns the name of the overflow policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	}
+	return "unknown"
+}
+
+// Returns the overflow policy with the given name: "block" or "drop-oldest".
+func OverflowPolicyFromString(s string) (OverflowPolicy, error) {
+	switch strings.ToLower(s) {
+	case "block":
+		return OverflowBlock, nil
+	case "drop-oldest", "drop":
+		return OverflowDropOldest, nil
+	}
+	return OverflowBlock, fmt.Errorf("invalid overflow policy %q", s)
+}
+
+// The defaults of the handler buffer size (in messages) and the time the
+// handler is given to write the buffered messages when it is closed.
+const (
+	DefaultBufferSize   = 100
+	DefaultFlushTimeout = 5 * time.Second
+)
+
+// a private struct that defines log handler data structures; it implements
+// the common core of the handlers: the messages are sent over the buffered
+// channel to the handler goroutine that writes them.
 type logHandler struct {
     // set severity for this handler 
 	sev  Severity
 
-    // a formatter for this handler 
-	format string
+    // a format (template) and the formatter for this handler
+	format    string
+	formatter Formatter
+
+    // the size of the buffer, the overflow policy and the flush timeout
+	bufsize      int
+	overflow     OverflowPolicy
+	flushTimeout time.Duration
 
     // a handler's channel onto which log messages are sent
     msgch chan *logmsg
 
-    // a channel to signal when to stop the handler goroutine
-    stop chan int
+    // closed when the handler goroutine has written all the messages
+    done chan struct{}
+
+    // closed when the flush timeout expires: the blocked senders give up
+    abort chan struct{}
+
+    // the number of messages dropped due to the overflow
+    dropped atomic.Uint64
+
+    // protects the channel against sending after it has been closed
+    mutex   sync.RWMutex
+    closed  bool
+    closing sync.Once
+
+    // is writing the log failing? (used by the handler goroutine only)
+    failing bool
+}
+
+// Report the failed write of the log on STDERR: only the first of the
+// consecutive failures is reported, the messages are lost anyway.
+func (l *logHandler) checkWrite(name string, err error) {
+	if err != nil && !l.failing {
+		fmt.Fprintf(os.Stderr, "log %s: %s, messages lost\n", name, err)
+	}
+	l.failing = err != nil
 }
 
 // Return the severity value.
@@ -57,19 +151,176 @@ func (l *logHandler) SetSeverity(s Severity) { l.sev = s }
 // Return the log message format value.
 func (l *logHandler) Format() string { return l.format }
 
-// Set the log message format.
-func (l *logHandler) SetFormat(fmt string) { l.format = fmt }
+// Set the log message format: the template of the TemplateFormatter using
+// the default time layout.
+func (l *logHandler) SetFormat(fmt string) error {
+	f, err := NewTemplateFormatter(fmt, "")
+	if err != nil {
+		return err
+	}
+	l.format, l.formatter = fmt, f
+	return nil
+}
+
+// Set the formatter of the log messages.
+func (l *logHandler) SetFormatter(f Formatter) {
+	l.format, l.formatter = fmt.Sprint(f), f
+}
+
+// Format the message using the handler's formatter.
+func (l *logHandler) line(m *logmsg) string {
+	return l.formatter.Format(&LogRecord{m.time, m.sev, "", m.ctx, m.msg})
+}
 
-// Create a new log handler instance.
+// Set the size of the message buffer; must be set before the handler is
+// started.
+func (l *logHandler) SetBufferSize(n int) { l.bufsize = n }
+
+// Set the policy applied when the message buffer is full.
+func (l *logHandler) SetOverflow(p OverflowPolicy) { l.overflow = p }
+
+// Set how long the handler may take to write the buffered messages when it is
+// closed.
+func (l *logHandler) SetFlushTimeout(d time.Duration) { l.flushTimeout = d }
+
+// Return the number of messages dropped due to the buffer overflow.
+func (l *logHandler) Dropped() uint64 { return l.dropped.Load() }
+
+// Create a new log handler instance; when the format is not valid, the
+// default one is used.
 func newLogHandler(fmt string, sev Severity) *logHandler {
-	return &logHandler{sev, fmt, nil, nil}
+	l := &logHandler{sev: sev, bufsize: DefaultBufferSize,
+		flushTimeout: DefaultFlushTimeout}
+	if l.SetFormat(fmt) != nil {
+		l.format, l.formatter = DefaultLogFormat, defaultFormatter()
+	}
+	return l
+}
+
+// Start the handler goroutine that writes the messages using the given
+// function until the handler is closed.
+func (l *logHandler) start(write func(m *logmsg)) {
+	if l.bufsize < 1 {
+		l.bufsize = 1
+	}
+	l.msgch = make(chan *logmsg, l.bufsize)
+	l.done = make(chan struct{})
+	l.abort = make(chan struct{})
+	go func(msgch <-chan *logmsg) {
+		defer close(l.done)
+		for m := range msgch {
+			write(m)
+		}
+	}(l.msgch)
+}
+
+// Send the message to the handler goroutine. The messages sent before the
+// handler is started or after it has been closed are ignored.
+func (l *logHandler) send(m *logmsg) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if l.msgch == nil || l.closed {
+		return
+	}
+	if l.overflow == OverflowBlock {
+		select {
+		case l.msgch <- m:
+		case <-l.abort:
+			l.dropped.Add(1)
+		}
+		return
+	}
+	for {
+		select {
+		case l.msgch <- m:
+			return
+		default:
+		}
+		// the buffer is full: drop the oldest message, unless the handler
+		// goroutine has just taken it
+		select {
+		case <-l.msgch:
+			l.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+// Stop the handler: the messages already sent are written (flushed) before it
+// returns, unless that takes longer than the flush timeout; returns false in
+// that case. It is safe to call it more than once.
+func (l *logHandler) stop() bool {
+	flushed := true
+	l.closing.Do(func() {
+		if l.msgch == nil {
+			return
+		}
+		// the senders blocked by the stuck handler give up on timeout, so
+		// the lock can be taken
+		timer := time.AfterFunc(l.flushTimeout, func() { close(l.abort) })
+		defer timer.Stop()
+
+		l.mutex.Lock()
+		l.closed = true
+		close(l.msgch)
+		l.mutex.Unlock()
+
+		select {
+		case <-l.done:
+		case <-l.abort:
+			flushed = false
+		}
+	})
+	return flushed
 }
 
 /************************** Log ***********************************/
-// helper private struct that defines a log message: severity and message text
+// helper private struct that defines a log message: severity, message text,
+// the log context and the time when the message has been logged
 type logmsg struct {
-    sev Severity
-    msg string
+    sev  Severity
+    msg  string
+    ctx  LogContext
+    time time.Time
+}
+
+// Create a new log message, logged now.
+func newLogmsg(sev Severity, msg string, ctx LogContext) *logmsg {
+    return &logmsg{sev, msg, ctx, time.Now()}
+}
+
+// LogContext defines what is being executed when the message is logged; the
+// handlers may add it to the messages (e.g. syslog structured data).
+type LogContext struct {
+    TestSet  string
+    TestCase string
+    TestStep string
+}
+
+// The handlers that make use of the log context implement this interface.
+type contextHandler interface {
+    SetContext(LogContext)
+}
+
+// The current log context of the handler; the handlers using the context
+// embed it, the context is sent with every message.
+type logContext struct {
+	ctx   LogContext
+	mutex sync.Mutex
+}
+
+// Set the log context of the subsequent messages.
+func (c *logContext) SetContext(ctx LogContext) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.ctx = ctx
+}
+
+// Return the current log context.
+func (c *logContext) context() LogContext {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.ctx
 }
 
 // A slice of different Log handlers that can be added at will
@@ -192,6 +443,16 @@ func (l *Log) Emergency(msg string) {
     }
 }
 
+// Set the log context (test set, case and step) of the subsequent messages;
+// the handlers that do not record the context ignore it.
+func (l *Log) SetContext(ctx LogContext) {
+    for _, h := range l.Handlers {
+        if ch, ok := h.(contextHandler); ok {
+            ch.SetContext(ctx)
+        }
+    }
+}
+
 // Clean and close the log.
 func (l *Log) Close() {
 	for _, h := range l.Handlers {
@@ -219,79 +480,59 @@ func (l *Log) Start() error {
     return nil
 }
 
-/************************** Formatter  ***********************************/
-// an interface defining the generic formatter
-type Formatter interface {
-	Format(string)
+/************************** FileHandler ***********************************/
+// The log file the file handlers write into: either the plain file or the
+// rotating one (see RotatingFile).
+type logFile interface {
+	io.Writer
+	Name() string
+	Close() error
 }
 
-/************************** FileHandler ***********************************/
 //  Handler that writes messages to local log file
 type FileHandler struct {
     // all handlers share common data structures
 	*logHandler
 
-    // file descriptor for the file log handler  
-	file *os.File
+    // the current log context
+	logContext
+
+    // the log file of the file log handler
+	file logFile
 }
 
-// Write a messages with given severity to a logfile.
-func (f *FileHandler) write(sev Severity, msg string) {
-	if f.Severity() >= sev {
-		fmt.Fprintf(f.file, f.Format(), Now(), sev, msg)
+// Write a message to a logfile, if its severity is high enough.
+func (f *FileHandler) write(m *logmsg) {
+	if f.Severity() >= m.sev {
+		_, err := io.WriteString(f.file, f.line(m))
+		f.checkWrite(f.file.Name(), err)
 	}
 }
 
-// Close the file handler
+// Close the file handler; the buffered messages are written first.
 func (f *FileHandler) Close() {
-
-    // send a signal to quit goroutine
-    if f.stop != nil {
-        close(f.logHandler.msgch)
-        f.stop <- 1
-    }
-
+	if !f.stop() {
+		fmt.Fprintf(os.Stderr, "log %s: flush timeout, messages lost\n",
+			f.file.Name())
+	}
 	if f.file != nil { f.file.Close() }
 }
 
 func (f *FileHandler) String() string {
-	return fmt.Sprintf("  FileHandler: fmt=%q, lvl=%-10s, fd=%d\n",
-		f.Format(), f.Severity(), f.file.Fd())
+	return fmt.Sprintf("  FileHandler: fmt=%q, lvl=%-10s, file=%q\n",
+		f.Format(), f.Severity(), f.file.Name())
 }
 
 
 // Send a log message onto an internal channel.
 func (f *FileHandler) Send(sev Severity, msg string) {
-    if f.logHandler.msgch != nil {
-        f.logHandler.msgch <- &logmsg{ sev, msg }
-    }
+	f.send(newLogmsg(sev, msg, f.context()))
 }
 
 // Run handler as a goroutine.
 func (f *FileHandler) Start() error {
-    // open logger channels 
-    f.logHandler.msgch = make(chan *logmsg, 10)  // message channel (buffered)
-    f.logHandler.stop  = make(chan int, 1)          // stop channel
-    // now start a new goroutine
-    go func(f *FileHandler) {
-
-        for {
-            select {
-            // when message is received over channel, write it
-            case m, ok :=<-f.logHandler.msgch:
-                //fmt.Printf("DEBUG, file logger: msg=%v\n", m) // DEBUG
-                if ok { f.write(m.sev, m.msg) }
-
-            // when data is received over stop channel, just exit the goroutine
-            case <- f.logHandler.stop:
-                return
-
-            default: // do nothing
-            }
-        }
-    }(f)
-
-    return nil
+	f.start(f.write)
+	return nil
 }
 
 // Creates a new file handler.
@@ -300,7 +541,26 @@ func NewFileHandler(filename string,
 	// open log file
 	//f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0755)
 	f, err := os.Create(filename)
-	return &FileHandler{ newLogHandler(fmt, sev), f }, err
+	return &FileHandler{logHandler: newLogHandler(fmt, sev), file: f}, err
+}
+
+
+// Creates a new file handler that appends the messages to the (existing)
+// log file.
+func NewAppendFileHandler(filename string,
+	fmt string, sev Severity) (*FileHandler, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	return &FileHandler{logHandler: newLogHandler(fmt, sev), file: f}, err
+}
+
+// Creates a new file handler writing into the rotating log file.
+func NewRotatingFileHandler(filename string, fmt string, sev Severity,
+	cfg RotateConfig) (*FileHandler, error) {
+	f, err := OpenRotatingFile(filename, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &FileHandler{logHandler: newLogHandler(fmt, sev), file: f}, nil
 }
 
 
@@ -308,10 +568,10 @@ func NewFileHandler(filename string,
 // a handler that writes messages to STDOUT (console)
 type StreamHandler FileHandler
 
-// Write a message with given severity to STDOUT.
-func (s *StreamHandler) write(sev Severity, msg string) {
-	if s.Severity() >= sev {
-		fmt.Printf(s.Format(), Now(), sev, msg)
+// Write a message to STDOUT, if its severity is high enough.
+func (s *StreamHandler) write(m *logmsg) {
+	if s.Severity() >= m.sev {
+		io.WriteString(s.file, s.line(m))
 	}
 }
 
@@ -320,136 +580,317 @@ func (s *StreamHandler) String() string {
 		s.Format(), s.Severity())
 }
 
-// Close the stream handler.
+// Close the stream handler; the buffered messages are written first.
 func (s *StreamHandler) Close() {
-	// send a signal to quit goroutine
-    if s.stop != nil {
-        close(s.logHandler.msgch)
-        s.stop <- 1
-    }
+	s.stop()
 }
 
 // Send a log message onto internal channel.
 func (s *StreamHandler) Send(sev Severity, msg string) {
-    if s.logHandler.msgch != nil {
-        s.logHandler.msgch <- &logmsg{ sev, msg }
-    }
+	s.send(newLogmsg(sev, msg, s.context()))
 }
 
 // Run handler as a goroutine.
 func (s *StreamHandler) Start() error {
+	s.start(s.write)
+	return nil
+}
 
-    // open logger channels 
-    s.logHandler.msgch = make(chan *logmsg, 10)  // message channel (buffered)
-    s.logHandler.stop  = make(chan int, 1)       // stop channel
 
-    // now start a new goroutine
-    go func(s *StreamHandler) {
+// Creates a new stream handler
+func NewStreamHandler(fmt string, sev Severity) *StreamHandler {
+	return &StreamHandler{logHandler: newLogHandler(fmt, sev), file: os.Stdout}
+}
 
-        for {
-            select {
+/************************** JsonFileHandler *******************************/
+// A handler that writes the messages to the log file as JSON objects, one per
+// line, including the log context; meant for the log ingestion tools.
+type JsonFileHandler struct {
+    // all handlers share common data structures
+	*logHandler
 
-            // when message is received over channel, write it
-            case m, ok := <-s.logHandler.msgch:
-                //fmt.Printf("DEBUG, logger: msg=%v\n", m) // DEBUG
-                if ok { s.write(m.sev, m.msg) }
+    // the current log context
+	logContext
 
-            // when data is received over stop channel, just exit the goroutine
-            case <- s.logHandler.stop:
-                return
+    // the log file of the JSON file handler
+	file logFile
+}
 
-            default: // do nothing
-            }
-        }
-    }(s)
+// A single line of the JSON log file.
+type jsonLogEntry struct {
+	Time     time.Time
+	Severity string
+	TestSet  string `json:",omitempty"`
+	TestCase string `json:",omitempty"`
+	TestStep string `json:",omitempty"`
+	Msg      string
+}
 
-    return nil
+// Write a message with its context to the logfile, if its severity is high
+// enough.
+func (j *JsonFileHandler) write(m *logmsg) {
+	if j.Severity() < m.sev {
+		return
+	}
+	b, err := json.Marshal(&jsonLogEntry{m.time, m.sev.String(),
+		m.ctx.TestSet, m.ctx.TestCase, m.ctx.TestStep,
+		strings.TrimRight(m.msg, "\n")})
+	if err == nil {
+		_, err = j.file.Write(append(b, '\n'))
+		j.checkWrite(j.file.Name(), err)
+	}
 }
 
+func (j *JsonFileHandler) String() string {
+	return fmt.Sprintf("JsonFileHandler: lvl=%-10s, file=%q\n", j.Severity(),
+		j.file.Name())
+}
 
-// Creates a new stream handler
-func NewStreamHandler(fmt string, sev Severity) *StreamHandler {
-	return &StreamHandler{ newLogHandler(fmt, sev), os.Stdout }
+// Close the JSON file handler; the buffered messages are written first.
+func (j *JsonFileHandler) Close() {
+	if !j.stop() {
+		fmt.Fprintf(os.Stderr, "log %s: flush timeout, messages lost\n",
+			j.file.Name())
+	}
+	if j.file != nil { j.file.Close() }
+}
+
+// Send a log message onto an internal channel; the current log context is
+// sent, too.
+func (j *JsonFileHandler) Send(sev Severity, msg string) {
+	j.send(newLogmsg(sev, msg, j.context()))
+}
+
+// Run handler as a goroutine.
+func (j *JsonFileHandler) Start() error {
+	j.start(j.write)
+	return nil
+}
+
+// Creates a new JSON file handler writing into the rotating log file; the
+// format is not used.
+func NewJsonFileHandler(filename string, sev Severity,
+	cfg RotateConfig) (*JsonFileHandler, error) {
+	f, err := OpenRotatingFile(filename, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &JsonFileHandler{logHandler: newLogHandler("", sev), file: f}, nil
+}
+
+/************************** CaseFileHandler *******************************/
+// The directory (in the working directory) of the per-case log files.
+const CaseLogDir = "cases"
+
+// Returns the name of the log file of the test case, relative to the working
+// directory: the characters unsafe in the filenames are replaced.
+func CaseLogName(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+	return path.Join(CaseLogDir, safe+".log")
+}
+
+// A handler that writes the messages logged during every test case into the
+// separate file in the working directory (see CaseLogName()); the messages
+// logged outside of the test cases are ignored.
+type CaseFileHandler struct {
+    // all handlers share common data structures
+	*logHandler
+
+    // the current log context
+	logContext
+
+    // the working directory
+	dir string
+
+    // the test case whose log file is open and its file descriptor
+	tc   string
+	file *os.File
+}
+
+// Write a message with given severity to the log file of the test case; the
+// file is opened (for appending) when the test case changes.
+func (c *CaseFileHandler) write(m *logmsg) {
+	ctx := m.ctx
+	if c.Severity() < m.sev || ctx.TestCase == "" {
+		return
+	}
+	if ctx.TestCase != c.tc || c.file == nil {
+		c.closeFile()
+		filename := path.Join(c.dir, CaseLogName(ctx.TestCase))
+		err := os.MkdirAll(path.Dir(filename), 0755)
+		if err == nil {
+			c.file, err = os.OpenFile(filename,
+				os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "log %s: %s\n", filename, err)
+			return
+		}
+		c.tc = ctx.TestCase
+	}
+	io.WriteString(c.file, c.line(m))
+}
+
+// Close the log file of the current test case.
+func (c *CaseFileHandler) closeFile() {
+	if c.file != nil {
+		c.file.Close()
+		c.file = nil
+	}
+}
+
+func (c *CaseFileHandler) String() string {
+	return fmt.Sprintf("CaseFileHandler: fmt=%q, lvl=%-10s, dir=%q\n",
+		c.Format(), c.Severity(), path.Join(c.dir, CaseLogDir))
+}
+
+// Close the case file handler; the buffered messages are written first.
+func (c *CaseFileHandler) Close() {
+	if !c.stop() {
+		fmt.Fprintf(os.Stderr, "log %s: flush timeout, messages lost\n",
+			c.dir)
+		return // the handler goroutine may still be using the file
+	}
+	c.closeFile()
+}
+
+// Send a log message onto an internal channel; the current log context is
+// sent, too.
+func (c *CaseFileHandler) Send(sev Severity, msg string) {
+	c.send(newLogmsg(sev, msg, c.context()))
+}
+
+// Run handler as a goroutine.
+func (c *CaseFileHandler) Start() error {
+	c.start(c.write)
+	return nil
+}
+
+// Creates a new case file handler writing the per-case log files into the
+// given working directory.
+func NewCaseFileHandler(dir, fmt string, sev Severity) *CaseFileHandler {
+	return &CaseFileHandler{logHandler: newLogHandler(fmt, sev), dir: dir}
 }
 
 /************************** SyslogHandler ***********************************/
-// A handler that sends the log messages to standard syslog port (UDP 514)
+// A handler that sends the log messages to the syslog server; by default, the
+// messages are formatted according to RFC 5424 and sent over UDP to the
+// standard port (514).
 type SyslogHandler struct {
     // all handlers share common data structures
 	*logHandler
 
-    // IP address of the syslog server
-	IP string
+    // the syslog server: "host[:port]"
+	Server string
+
+    // the transport: "udp" (default), "tcp" or "tls"
+	Proto string
+
+    // TLS configuration for the "tls" transport (nil: the defaults)
+	TLSConfig *tls.Config
 
-    // a syslog message built according to RFC
+    // the format of the messages: RFC 5424 (default) or RFC 3164
+	MsgFormat SyslogFormat
+
+    // a template of the syslog messages: facility, hostname, app name...
 	*SyslogMsg
+
+    // the persistent connection to the server
+	conn *SyslogConn
+
+    // the current log context
+	logContext
 }
 
-// Write a log message with given severity to wire.
-func (s *SyslogHandler) write(level Severity, msg string) error {
-	if s.Severity() >= level {
-		s.Fac = FacLocal0
-		s.Sev = level
-		s.Msg = fmt.Sprintf("%s %s", level.String(), msg)
-		t := time.Now()
-		s.SetTimestamp(t)
-		err := s.SyslogMsg.Send(s.IP)
-		if err != nil { return err }
+// Write a log message with given severity and context to wire.
+func (s *SyslogHandler) write(level Severity, msg string,
+	ctx LogContext) error {
+	if s.Severity() < level {
+		return nil
 	}
-	return nil
+	m := *s.SyslogMsg
+	m.Sev = level
+	m.SetTimestamp(time.Now())
+	m.Msg = strings.TrimRight(msg, "\n")
+	if s.MsgFormat == RFC3164 {
+		m.Msg = fmt.Sprintf("%s %s", level.String(), m.Msg)
+	} else if ctx != (LogContext{}) {
+		// the test case (or the test set) is the message ID, the complete
+		// context is in structured data
+		m.MsgId = ctx.TestCase
+		if m.MsgId == "" {
+			m.MsgId = ctx.TestSet
+		}
+		params := make(map[string]string)
+		for name, v := range map[string]string{"set": ctx.TestSet,
+			"case": ctx.TestCase, "step": ctx.TestStep} {
+			if v != "" {
+				params[name] = v
+			}
+		}
+		m.Data = []*SDElement{{SDGoatfID, params}}
+	}
+	return s.conn.Write(m.Text(s.MsgFormat))
 }
 
 func (s *SyslogHandler) String() string {
-	return fmt.Sprintf("SyslogHandler: fmt=%q, lvl=%-10s, Server=%q %s\n",
-		s.Format(), s.Severity(), s.IP)
+	proto := s.Proto
+	if proto == "" {
+		proto = "udp"
+	}
+	return fmt.Sprintf("SyslogHandler: fmt=%q, lvl=%-10s, Server=%q (%s)\n",
+		s.Format(), s.Severity(), s.Server, proto)
 }
 
-// Close the syslog handler.
+// Close the syslog handler; the buffered messages are sent first.
 func (s *SyslogHandler) Close() {
-    // send a signal to quit goroutine
-    if s.stop != nil {
-        close(s.logHandler.msgch)
-        s.logHandler.stop <- 1
+    if !s.stop() {
+        fmt.Fprintf(os.Stderr, "syslog %s: flush timeout, messages lost\n",
+            s.conn)
+    }
+    if s.conn != nil {
+        s.conn.Close()
     }
 }
 
-// Send a log message onto internal channel.
+// Send a log message onto internal channel; the current log context is sent,
+// too.
 func (s *SyslogHandler) Send(sev Severity, msg string) {
-    if s.logHandler.msgch != nil {
-        s.logHandler.msgch <- &logmsg{ sev, msg }
-    }
+    s.send(newLogmsg(sev, msg, s.context()))
 }
 
 // Run handler as a goroutine.
 func (s *SyslogHandler) Start() error {
 
-    // open logger channels 
-    s.logHandler.msgch = make(chan *logmsg, 10)  // message channel (buffered)
-    s.logHandler.stop  = make(chan int, 1)          // stop channel
-
-    // now start a new goroutine
-    go func(s *SyslogHandler) {
-
-        for {
-            select {
-
-            // when message is received over channel, write it
-            case m, ok := <-s.logHandler.msgch:
-                if ok { s.write(m.sev, m.msg) }
-
-            // when data is received over stop channel, just exit the goroutine
-            case <- s.logHandler.stop:
-                return
+    if s.MsgFormat != RFC5424 && s.MsgFormat != RFC3164 {
+        return fmt.Errorf("syslog: invalid format %d", s.MsgFormat)
+    }
+    s.conn = DialSyslog(s.Proto, s.Server, s.TLSConfig)
 
-            default: // do nothing
-            }
+    // the errors cannot be logged, so they are displayed
+    s.start(func(m *logmsg) {
+        if err := s.write(m.sev, m.msg, m.ctx); err != nil {
+            fmt.Fprintf(os.Stderr, "syslog %s: %s\n", s.conn, err)
         }
-    }(s)
-
+    })
     return nil
 }
 
-// Create a new sysloh handler.
-func NewSyslogHandler(ip, fmt string, sev Severity) *SyslogHandler {
-    return &SyslogHandler{ newLogHandler(fmt, sev), ip, NewSyslogMsg() }
+// Create a new syslog handler sending the messages to the given server
+// ("host[:port]"); the transport and the format can be changed before the
+// handler is started.
+func NewSyslogHandler(server, fmt string, sev Severity) *SyslogHandler {
+    m := NewSyslogMsg()
+    m.Hostname = localHostname()
+    m.AppName = "goatf"
+    m.ProcId = strconv.Itoa(os.Getpid())
+    return &SyslogHandler{logHandler: newLogHandler(fmt, sev), Server: server,
+        SyslogMsg: m}
 }
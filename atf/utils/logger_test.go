@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Counts the lines of the file.
+func countLines(t *testing.T, filename string) int {
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); n++ {
+	}
+	return n
+}
+
+// All the messages sent concurrently before the handler is closed are
+// written to the file, even with the smallest buffer.
+func TestFileHandlerNoLoss(t *testing.T) {
+	const senders, count = 8, 500
+	for _, bufsize := range []int{1, 10, DefaultBufferSize} {
+		filename := filepath.Join(t.TempDir(), "test.log")
+		h, err := NewFileHandler(filename, DefaultLogFormat, Debug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.SetBufferSize(bufsize)
+		h.Start()
+		var wg sync.WaitGroup
+		for i := 0; i < senders; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < count; j++ {
+					h.Send(Notice, fmt.Sprintf("sender %d message %d", i, j))
+				}
+			}(i)
+		}
+		wg.Wait()
+		h.Close()
+
+		if n := countLines(t, filename); n != senders*count {
+			t.Errorf("buffer %d: %d messages written, expected %d", bufsize,
+				n, senders*count)
+		}
+		if h.Dropped() != 0 {
+			t.Errorf("buffer %d: %d messages dropped", bufsize, h.Dropped())
+		}
+	}
+}
+
+// Sending the messages while the handler is being closed (or after it has
+// been closed) does not panic.
+func TestSendWhileClosing(t *testing.T) {
+	h, err := NewFileHandler(filepath.Join(t.TempDir(), "test.log"),
+		DefaultLogFormat, Debug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetBufferSize(1)
+	h.Start()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				h.Send(Notice, "message")
+			}
+		}()
+	}
+	h.Close()
+	wg.Wait()
+	h.Close() // closing twice is harmless
+}
+
+// A test handler whose writes are blocked until the gate is opened.
+func newGatedHandler(bufsize int, p OverflowPolicy) (*logHandler,
+	chan struct{}, *[]string, *sync.Mutex) {
+
+	h := newLogHandler("", Debug)
+	h.SetBufferSize(bufsize)
+	h.SetOverflow(p)
+	gate := make(chan struct{})
+	written := make([]string, 0)
+	mutex := new(sync.Mutex)
+	h.start(func(m *logmsg) {
+		<-gate
+		mutex.Lock()
+		written = append(written, m.msg)
+		mutex.Unlock()
+	})
+	return h, gate, &written, mutex
+}
+
+// With drop-oldest policy, the sender is never blocked: the oldest messages
+// are dropped and the newest ones are kept.
+func TestDropOldest(t *testing.T) {
+	const count = 100
+	h, gate, written, _ := newGatedHandler(5, OverflowDropOldest)
+	sent := make(chan struct{})
+	go func() {
+		for i := 0; i < count; i++ {
+			h.send(newLogmsg(Notice, fmt.Sprint(i), LogContext{}))
+		}
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sender blocked")
+	}
+	close(gate)
+	if !h.stop() {
+		t.Fatal("flush timeout")
+	}
+	if n := len(*written) + int(h.Dropped()); n != count {
+		t.Errorf("%d messages written or dropped, expected %d", n, count)
+	}
+	if last := (*written)[len(*written)-1]; last != fmt.Sprint(count-1) {
+		t.Errorf("the newest message was not written: %q", last)
+	}
+}
+
+// With block policy, the sender waits until there is room in the buffer.
+func TestBlock(t *testing.T) {
+	h, gate, written, mutex := newGatedHandler(2, OverflowBlock)
+	sent := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			h.send(newLogmsg(Notice, fmt.Sprint(i), LogContext{}))
+		}
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("sender not blocked on full buffer")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(gate)
+	<-sent
+	if !h.stop() {
+		t.Fatal("flush timeout")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(*written) != 10 || h.Dropped() != 0 {
+		t.Errorf("%d messages written, %d dropped", len(*written),
+			h.Dropped())
+	}
+	for i, m := range *written {
+		if m != fmt.Sprint(i) {
+			t.Errorf("message %d out of order: %q", i, m)
+		}
+	}
+}
+
+// When the handler is stuck, closing gives up after the flush timeout; the
+// blocked senders are released, too.
+func TestFlushTimeout(t *testing.T) {
+	h, gate, _, _ := newGatedHandler(1, OverflowBlock)
+	defer close(gate)
+	h.SetFlushTimeout(100 * time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.send(newLogmsg(Notice, "message", LogContext{}))
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	if h.stop() {
+		t.Error("stuck handler flushed")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("closing took %s", d)
+	}
+	wg.Wait()
+}
+
+// The messages sent before the handler is started are ignored.
+func TestSendBeforeStart(t *testing.T) {
+	h := newLogHandler("", Debug)
+	h.send(newLogmsg(Notice, "message", LogContext{}))
+	if !h.stop() {
+		t.Error("stopping the handler that has not been started failed")
+	}
+}
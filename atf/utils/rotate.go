@@ -0,0 +1,276 @@
+/*
+ * rotate.go - a log file with size- and time-based rotation
+ *
+ * When the file grows over the maximum size (or gets older than the maximum
+ * age), it is renamed to "<name>.1" (the older backups are shifted to ".2",
+ * ".3"...) and a new file is started. The rotated files are optionally
+ * gzipped ("<name>.1.gz") and only the given number of the newest backups is
+ * kept.
+ */
+
+package utils
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateConfig defines when the log file is rotated and what happens with
+// the rotated files. The zero value never rotates and truncates the file when
+// it is opened.
+type RotateConfig struct {
+
+	// rotate when the file would grow over this size (bytes); 0: never
+	MaxSize int64
+
+	// rotate when the file is older than this; 0: never
+	MaxAge time.Duration
+
+	// keep at most this many rotated files; 0: keep all of them
+	MaxBackups int
+
+	// gzip the rotated files
+	Compress bool
+
+	// append to the existing file instead of truncating it
+	Append bool
+}
+
+// RotatingFile is a file that rotates itself according to the config; it is
+// safe for concurrent use.
+type RotatingFile struct {
+	filename string
+	cfg      RotateConfig
+	file     *os.File
+	size     int64     // the current size of the file
+	opened   time.Time // when the current file has been started
+	closed   bool
+	mutex    sync.Mutex
+}
+
+// Opens (or creates) the rotating file.
+func OpenRotatingFile(filename string, cfg RotateConfig) (*RotatingFile,
+	error) {
+	f := &RotatingFile{filename: filename, cfg: cfg}
+	if err := f.open(cfg.Append); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Opens the file, either truncated or for appending.
+func (f *RotatingFile) open(append bool) error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if append {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(f.filename, flags, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), time.Now()
+	if f.size > 0 {
+		f.opened = f.started(info)
+	}
+	return nil
+}
+
+// Returns when the existing file has been started: when the newest backup
+// has been rotated (its modification time is kept by renaming) or, if it has
+// never been rotated, when it has been created. When the OS does not record
+// the creation time, the modification time is used.
+func (f *RotatingFile) started(info os.FileInfo) time.Time {
+	if backups := f.backups(); len(backups) > 0 {
+		if b, err := os.Stat(backups[0].name); err == nil {
+			return b.ModTime()
+		}
+	}
+	if created, ok := fileCreated(info); ok {
+		return created
+	}
+	return info.ModTime()
+}
+
+// Returns the name of the file.
+func (f *RotatingFile) Name() string { return f.filename }
+
+// Returns a plain text representation of the RotatingFile instance.
+func (f *RotatingFile) String() string {
+	return fmt.Sprintf("RotatingFile: %q size=%d age=%s backups=%d gzip=%t",
+		f.filename, f.cfg.MaxSize, f.cfg.MaxAge, f.cfg.MaxBackups,
+		f.cfg.Compress)
+}
+
+// Writes the data into the file; the file is rotated first when needed.
+func (f *RotatingFile) Write(b []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	// the new file may have failed to open when it was rotated
+	if f.file == nil {
+		if err := f.open(true); err != nil {
+			return 0, err
+		}
+	}
+	full := f.cfg.MaxSize > 0 && f.size > 0 &&
+		f.size+int64(len(b)) > f.cfg.MaxSize
+	old := f.cfg.MaxAge > 0 && time.Since(f.opened) >= f.cfg.MaxAge
+	if full || old {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(b)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotates the file immediately.
+func (f *RotatingFile) Rotate() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if f.file == nil {
+		if err := f.open(true); err != nil {
+			return err
+		}
+	}
+	return f.rotate()
+}
+
+// A rotated file: its index and the name.
+type backup struct {
+	index int
+	name  string
+}
+
+// Returns the existing backups, the newest (lowest index) first.
+func (f *RotatingFile) backups() []backup {
+	names, _ := filepath.Glob(f.filename + ".*")
+	backups := make([]backup, 0, len(names))
+	for _, name := range names {
+		suffix := strings.TrimSuffix(name[len(f.filename)+1:], ".gz")
+		if i, err := strconv.Atoi(suffix); err == nil && i > 0 {
+			backups = append(backups, backup{i, name})
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].index < backups[j].index
+	})
+	return backups
+}
+
+// Closes the current file, shifts the backups, removes the ones over the
+// limit and starts the new file.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	backups := f.backups()
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+		if f.cfg.MaxBackups > 0 && b.index >= f.cfg.MaxBackups {
+			os.Remove(b.name)
+			continue
+		}
+		suffix := strings.TrimPrefix(b.name[len(f.filename):],
+			"."+strconv.Itoa(b.index))
+		os.Rename(b.name, fmt.Sprintf("%s.%d%s", f.filename, b.index+1,
+			suffix))
+	}
+	// whatever happens, the logging goes on with the (new) file; when it
+	// cannot be opened, it is retried by the next write
+	rotated := f.filename + ".1"
+	if err := os.Rename(f.filename, rotated); err != nil {
+		f.open(true)
+		return err
+	}
+	var err error
+	if f.cfg.Compress {
+		err = gzipFile(rotated)
+	}
+	if oerr := f.open(false); err == nil {
+		err = oerr
+	}
+	return err
+}
+
+// Compresses the file into "<name>.gz" and removes the original.
+func gzipFile(filename string) error {
+	in, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(filename+".gz",
+		os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err == nil {
+		err = zw.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(filename + ".gz")
+		return err
+	}
+	return os.Remove(filename)
+}
+
+// Closes the file.
+func (f *RotatingFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.closed = true
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// Parses the size with an optional unit suffix: "K", "M" or "G" (powers of
+// 1024, "B" may follow), e.g. "10M" or "512KB".
+func ParseSize(size string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B")
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return n * mult, nil
+}
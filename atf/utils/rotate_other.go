@@ -0,0 +1,18 @@
+//go:build !windows
+
+/*
+ * rotate_other.go - the parts of the rotating file for the OSes that do not
+ * report the creation time of the files (through os.FileInfo)
+ */
+
+package utils
+
+import (
+	"os"
+	"time"
+)
+
+// Returns the creation time of the file; not known here.
+func fileCreated(info os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Reads the (optionally gzipped) file.
+func readLogFile(t *testing.T, filename string) string {
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if filepath.Ext(filename) == ".gz" {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRotatingFileBackups(t *testing.T) {
+	tests := []struct {
+		backups  int
+		compress bool
+		expected []string // the backups, the newest first
+	}{
+		{0, false, []string{".1", ".2", ".3", ".4"}},
+		{2, false, []string{".1", ".2"}},
+		{1, true, []string{".1.gz"}},
+		{3, true, []string{".1.gz", ".2.gz", ".3.gz"}},
+	}
+	for _, test := range tests {
+		filename := filepath.Join(t.TempDir(), "test.log")
+		f, err := OpenRotatingFile(filename, RotateConfig{MaxSize: 10,
+			MaxBackups: test.backups, Compress: test.compress})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// every line fills the file, so the next one rotates it
+		for i := 1; i <= 5; i++ {
+			if _, err = fmt.Fprintf(f, "message %d\n", i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f.Close()
+
+		got, _ := filepath.Glob(filename + ".*")
+		if len(got) != len(test.expected) {
+			t.Errorf("%d/%t: got backups %q, expected %q", test.backups,
+				test.compress, got, test.expected)
+			continue
+		}
+		if s := readLogFile(t, filename); s != "message 5\n" {
+			t.Errorf("%d/%t: current file: got %q, expected %q",
+				test.backups, test.compress, s, "message 5\n")
+		}
+		for i, suffix := range test.expected {
+			expected := fmt.Sprintf("message %d\n", 4-i)
+			if s := readLogFile(t, filename+suffix); s != expected {
+				t.Errorf("%d/%t: %s: got %q, expected %q", test.backups,
+					test.compress, suffix, s, expected)
+			}
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size     string
+		expected int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512KB", 512 << 10},
+		{"10M", 10 << 20},
+		{" 1g ", 1 << 30},
+		{"-1", -1},
+		{"10X", -1},
+		{"", -1},
+	}
+	for _, test := range tests {
+		n, err := ParseSize(test.size)
+		if test.expected < 0 {
+			if err == nil {
+				t.Errorf("%q: invalid size accepted", test.size)
+			}
+			continue
+		}
+		if err != nil || n != test.expected {
+			t.Errorf("%q: got %d (%v), expected %d", test.size, n, err,
+				test.expected)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+/*
+ * rotate_windows.go - Windows specific parts of the rotating file
+ */
+
+package utils
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// Returns the creation time of the file.
+func fileCreated(info os.FileInfo) (time.Time, bool) {
+	if d, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		return time.Unix(0, d.CreationTime.Nanoseconds()), true
+	}
+	return time.Time{}, false
+}
@@ -1,12 +1,30 @@
 
+/*
+ * syslog.go - syslog messages and transports
+ *
+ * The messages are formatted according to RFC 5424 (the default) or to the
+ * old BSD syslog format (RFC 3164). They are sent over UDP, TCP or TLS; the
+ * stream transports use the octet-counting framing (RFC 6587, RFC 5425).
+ *
+ * History:
+ *  1   Jul11   MR  The initial version
+ *  2   Oct26   MR  RFC 5424 format, TCP & TLS transports, persistent
+ *                  connection
+ */
+
 package utils
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
-    "strings"
 )
 
 type Severity int
@@ -103,12 +121,92 @@ const (
 )
 
 const (
-	// Define a standard syslog message timestamp format
+	// Define a standard syslog message timestamp format (RFC 3164)
 	TimestampFmt = "Jan _2 15:04:05"
-	// Standard UDP port for syslog is 514
+	// The RFC 5424 timestamp format: RFC 3339 with microseconds
+	Timestamp5424Fmt = "2006-01-02T15:04:05.000000Z07:00"
+	// Standard UDP (and TCP) port for syslog is 514
 	SyslogPort = 514
+	// Standard port for syslog over TLS (RFC 5425)
+	SyslogTlsPort = 6514
+)
+
+// The format of the syslog messages.
+type SyslogFormat int
+
+const (
+	RFC5424 SyslogFormat = iota
+	RFC3164
 )
 
+// Converts the format given as string ("5424", "rfc5424", "3164"...) into
+// SyslogFormat value.
+func SyslogFormatFromString(f string) (SyslogFormat, error) {
+	switch strings.TrimPrefix(strings.ToLower(f), "rfc") {
+	case "5424", "":
+		return RFC5424, nil
+	case "3164", "bsd":
+		return RFC3164, nil
+	}
+	return RFC5424, fmt.Errorf("syslog: invalid format %q", f)
+}
+
+// The ID of the structured data elements defined by GoATF; 32473 is the
+// enterprise number reserved for documentation (RFC 5612).
+const SDGoatfID = "goatf@32473"
+
+/*
+ * SDElement - an RFC 5424 structured data element
+ */
+type SDElement struct {
+	ID     string
+	Params map[string]string
+}
+
+// Returns the structured data element as string; the parameters are ordered
+// by names and the values are escaped.
+func (e *SDElement) String() string {
+	names := make([]string, 0, len(e.Params))
+	for name := range e.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	s := "[" + sdName(e.ID)
+	for _, name := range names {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(
+			e.Params[name])
+		s += fmt.Sprintf(` %s="%s"`, sdName(name), v)
+	}
+	return s + "]"
+}
+
+// Returns the header field value: printable US-ASCII characters only, at most
+// maxlen of them; the empty value is the NILVALUE ("-").
+func headerField(v string, maxlen int) string {
+	b := make([]byte, 0, len(v))
+	for i := 0; i < len(v) && len(b) < maxlen; i++ {
+		if v[i] < 33 || v[i] > 126 {
+			b = append(b, '_')
+		} else {
+			b = append(b, v[i])
+		}
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
+
+// Returns the SD-NAME: the header field without '=', ']', '"' and spaces.
+func sdName(v string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, headerField(v, 32))
+}
+
 /*
  * SyslogMsg 
  */
@@ -117,6 +215,17 @@ type SyslogMsg struct {
 	Fac                 Facility
 	timestamp, Hostname string
 	Msg                 string
+
+	// RFC 5424 header fields; in RFC 3164 format, the app name is the tag
+	AppName string
+	ProcId  string
+	MsgId   string
+
+	// RFC 5424 structured data
+	Data []*SDElement
+
+	// the timestamp of the message
+	time time.Time
 }
 
 func (s *SyslogMsg) Priority() string {
@@ -127,6 +236,7 @@ func (s *SyslogMsg) Priority() string {
 func (s *SyslogMsg) TimeStamp() string { return s.timestamp }
 
 func (s *SyslogMsg) SetTimestamp(stamp time.Time) {
+	s.time = stamp
 	s.timestamp = stamp.Format(TimestampFmt)
 }
 
@@ -139,31 +249,193 @@ func (s *SyslogMsg) SSetTimestamp(stamp string) error {
 	return nil
 }
 
-func (s *SyslogMsg) Get() string {
-	format := "%s%s %s %s"
-	return fmt.Sprintf(format, s.Priority(), s.timestamp, s.Hostname, s.Msg)
+// Returns the message formatted according to RFC 3164 (for compatibility).
+func (s *SyslogMsg) Get() string { return s.Text(RFC3164) }
+
+// Returns the message in given format.
+func (s *SyslogMsg) Text(f SyslogFormat) string {
+	if f == RFC3164 {
+		return s.rfc3164()
+	}
+	return s.rfc5424()
 }
 
-func (s *SyslogMsg) Send(ip string) error {
-	var addr net.IP
-	// local IP address overrides the Hostname field
-	if ip != "" {
-		s.Hostname = ip
+// Returns the message formatted according to RFC 3164:
+// <PRI>TIMESTAMP HOSTNAME TAG[PID]: MSG
+func (s *SyslogMsg) rfc3164() string {
+	msg := s.Msg
+	if s.AppName != "" {
+		tag := s.AppName
+		if s.ProcId != "" {
+			tag += "[" + s.ProcId + "]"
+		}
+		msg = tag + ": " + msg
 	}
-	addr = net.ParseIP(s.Hostname)
-	// let's make an UDP connection and send the message
-	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{addr, SyslogPort, ""})
-	if err != nil {
-		return err
+	return fmt.Sprintf("%s%s %s %s", s.Priority(), s.timestamp,
+		headerField(s.Hostname, 255), msg)
+}
+
+// Returns the message formatted according to RFC 5424:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (s *SyslogMsg) rfc5424() string {
+	stamp := "-"
+	if !s.time.IsZero() {
+		stamp = s.time.Format(Timestamp5424Fmt)
 	}
-	defer conn.Close()
-	fmt.Fprintf(conn, s.Get())
-	return nil
+	sd := ""
+	for _, e := range s.Data {
+		sd += e.String()
+	}
+	if sd == "" {
+		sd = "-"
+	}
+	msg := fmt.Sprintf("%s1 %s %s %s %s %s %s", s.Priority(), stamp,
+		headerField(s.Hostname, 255), headerField(s.AppName, 48),
+		headerField(s.ProcId, 128), headerField(s.MsgId, 32), sd)
+	if s.Msg != "" {
+		msg += " " + s.Msg
+	}
+	return msg
+}
+
+// Sends the RFC 3164 message to the syslog server over UDP; the server is
+// given as "host[:port]" and the local IP address overrides the Hostname
+// field (for compatibility). Use SyslogConn to send the messages over the
+// persistent connection.
+func (s *SyslogMsg) Send(server string) error {
+	if server != "" {
+		s.Hostname = server
+	}
+	c := DialSyslog("udp", s.Hostname, nil)
+	defer c.Close()
+	return c.Write(s.Get())
 }
 
 /*
  * NewSyslogMsg - create new syslog message with default fields
  */
 func NewSyslogMsg() *SyslogMsg {
-	return &SyslogMsg{Informational, FacLocal0, "", "", ""}
+	return &SyslogMsg{Sev: Informational, Fac: FacLocal0}
+}
+
+// How long to wait before the connection to the syslog server is
+// established again after the failure.
+const syslogRedialDelay = 5 * time.Second
+
+/*
+ * SyslogConn - a persistent connection to the syslog server
+ *
+ * The connection is established when the first message is written and it is
+ * established again when writing fails; the failed message is sent once more
+ * over the new connection.
+ */
+type SyslogConn struct {
+	proto  string // "udp", "tcp" or "tls"
+	addr   string // host:port of the server
+	config *tls.Config
+
+	conn     net.Conn
+	failed   time.Time // when the connection has failed last time
+	mutex    sync.Mutex
+}
+
+// Creates a new (not yet established) connection to the syslog server given
+// as "host[:port]" using given transport: "udp" (the default), "tcp" or "tls".
+// When the port is not given, the default port of the transport is used.
+func DialSyslog(proto, server string, config *tls.Config) *SyslogConn {
+	if proto == "" {
+		proto = "udp"
+	}
+	port := SyslogPort
+	if proto == "tls" {
+		port = SyslogTlsPort
+	}
+	return &SyslogConn{proto: proto, addr: SyslogAddr(server, port),
+		config: config}
+}
+
+// Returns the "host:port" address of the syslog server given as "host",
+// "host:port", IPv6 address or "[IPv6]:port".
+func SyslogAddr(server string, port int) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.Trim(server, "[]"), strconv.Itoa(port))
+}
+
+// Returns a plain text representation of the SyslogConn instance.
+func (c *SyslogConn) String() string {
+	return fmt.Sprintf("%s://%s", c.proto, c.addr)
+}
+
+// Establishes the connection.
+func (c *SyslogConn) dial() (err error) {
+	switch c.proto {
+	case "udp", "tcp":
+		c.conn, err = net.DialTimeout(c.proto, c.addr, 10*time.Second)
+	case "tls":
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		c.conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, c.config)
+	default:
+		err = fmt.Errorf("syslog: invalid transport %q", c.proto)
+	}
+	if err != nil {
+		c.conn = nil
+		c.failed = time.Now()
+	}
+	return err
+}
+
+// Writes the message to the server; over stream transports, the message is
+// framed using octet counting.
+func (c *SyslogConn) Write(msg string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.proto != "udp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		if c.conn == nil {
+			if time.Since(c.failed) < syslogRedialDelay {
+				return fmt.Errorf("syslog: %s is not available", c.addr)
+			}
+			if err := c.dial(); err != nil {
+				return err
+			}
+		}
+		c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		_, err := c.conn.Write([]byte(msg))
+		if err == nil {
+			return nil
+		}
+		// the connection is broken: establish it again and retry
+		c.conn.Close()
+		c.conn = nil
+		if attempt == 1 {
+			c.failed = time.Now()
+			return err
+		}
+	}
+	return nil
+}
+
+// Closes the connection.
+func (c *SyslogConn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Returns the name of the local host, used as the HOSTNAME field.
+func localHostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return name
 }
@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogRFC5424(t *testing.T) {
+	stamp := time.Date(2026, 10, 26, 8, 30, 0, 123456000, time.UTC)
+	long := strings.Repeat("x", 300)
+	tests := []struct {
+		name     string
+		msg      *SyslogMsg
+		expected string
+	}{
+		{"nil values", &SyslogMsg{Sev: Emergency, Fac: FacKernel},
+			"<0>1 - - - - - -"},
+		{"priority", &SyslogMsg{Sev: Notice, Fac: FacLocal0, Msg: "hi"},
+			"<133>1 - - - - - - hi"},
+		{"header", &SyslogMsg{Sev: Error, Fac: FacUser, time: stamp,
+			Hostname: "lab1", AppName: "goatf", ProcId: "42", MsgId: "RUN",
+			Msg: "started"},
+			"<11>1 2026-10-26T08:30:00.123456Z lab1 goatf 42 RUN - started"},
+		{"invalid characters", &SyslogMsg{Sev: Debug, Fac: FacLocal7,
+			Hostname: "my host", AppName: "gö"},
+			"<191>1 - my_host g__ - - -"},
+		{"truncated", &SyslogMsg{Fac: FacUser, Hostname: long,
+			AppName: long, ProcId: long, MsgId: long},
+			fmt.Sprintf("<8>1 - %s %s %s %s -", long[:255], long[:48],
+				long[:128], long[:32])},
+		{"structured data", &SyslogMsg{Sev: Informational, Fac: FacUser,
+			Data: []*SDElement{
+				&SDElement{SDGoatfID, map[string]string{"set": "s",
+					"case": `a "b"`}},
+				&SDElement{"x y=z", map[string]string{"v": `\]`}}},
+			Msg: "msg"},
+			`<14>1 - - - - - [goatf@32473 case="a \"b\"" set="s"]` +
+				`[x_y_z v="\\\]"] msg`},
+	}
+	for _, test := range tests {
+		if s := test.msg.Text(RFC5424); s != test.expected {
+			t.Errorf("%q: got %q, expected %q", test.name, s, test.expected)
+		}
+	}
+}
+
+func TestSyslogRFC3164(t *testing.T) {
+	m := &SyslogMsg{Sev: Warning, Fac: FacLocal0, Hostname: "lab1",
+		AppName: "goatf", ProcId: "42", Msg: "started"}
+	m.SetTimestamp(time.Date(2026, 10, 6, 8, 30, 0, 0, time.UTC))
+	expected := "<132>Oct  6 08:30:00 lab1 goatf[42]: started"
+	if s := m.Get(); s != expected {
+		t.Errorf("got %q, expected %q", s, expected)
+	}
+}
+
+// Creates the TLS config of the server with a self-signed certificate and the
+// client config trusting it.
+func testTLSConfigs(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1),
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl,
+		&key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server := &tls.Config{Certificates: []tls.Certificate{
+		tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return server, &tls.Config{RootCAs: pool}
+}
+
+// Reads the octet-counted frames ("<len> <msg>") from the connection.
+func readFrames(r *bufio.Reader, n int) ([]string, error) {
+	frames := make([]string, 0, n)
+	for len(frames) < n {
+		length, err := r.ReadString(' ')
+		if err != nil {
+			return frames, err
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil {
+			return frames, fmt.Errorf("invalid frame length %q", length)
+		}
+		b := make([]byte, size)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return frames, err
+		}
+		frames = append(frames, string(b))
+	}
+	return frames, nil
+}
+
+func TestSyslogConnFraming(t *testing.T) {
+	serverTLS, clientTLS := testTLSConfigs(t)
+	// the messages may contain spaces and newlines: only the length
+	// delimits them
+	msgs := []string{"<14>1 - - - - - - first message",
+		"<14>1 - - - - - - multi\nline", "<14>1 - - - - - -"}
+	for _, proto := range []string{"tcp", "tls"} {
+		var l net.Listener
+		var err error
+		if proto == "tls" {
+			l, err = tls.Listen("tcp", "127.0.0.1:0", serverTLS)
+		} else {
+			l, err = net.Listen("tcp", "127.0.0.1:0")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		received := make(chan []string, 1)
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				received <- nil
+				return
+			}
+			defer conn.Close()
+			frames, err := readFrames(bufio.NewReader(conn), len(msgs))
+			if err != nil {
+				t.Errorf("%s: %s", proto, err)
+			}
+			received <- frames
+		}()
+
+		c := DialSyslog(proto, l.Addr().String(), clientTLS)
+		for _, msg := range msgs {
+			if err := c.Write(msg); err != nil {
+				t.Fatalf("%s: %s", proto, err)
+			}
+		}
+		select {
+		case frames := <-received:
+			for i, msg := range msgs {
+				if i >= len(frames) || frames[i] != msg {
+					t.Errorf("%s: got frames %q, expected %q", proto,
+						frames, msgs)
+					break
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s: no messages received", proto)
+		}
+		c.Close()
+		l.Close()
+	}
+}
+
+func TestSyslogConnUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	c := DialSyslog("udp", pc.LocalAddr().String(), nil)
+	defer c.Close()
+	msg := "<14>1 - - - - - - datagram"
+	if err = c.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b := make([]byte, 1024)
+	n, _, err := pc.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the datagrams are not framed
+	if string(b[:n]) != msg {
+		t.Errorf("got %q, expected %q", b[:n], msg)
+	}
+}
+
+func TestSyslogAddr(t *testing.T) {
+	tests := []struct{ server, expected string }{
+		{"lab1", "lab1:514"},
+		{"lab1:1514", "lab1:1514"},
+		{"::1", "[::1]:514"},
+		{"[::1]", "[::1]:514"},
+		{"[::1]:1514", "[::1]:1514"},
+	}
+	for _, test := range tests {
+		if addr := SyslogAddr(test.server, SyslogPort); addr != test.expected {
+			t.Errorf("%q: got %q, expected %q", test.server, addr,
+				test.expected)
+		}
+	}
+}
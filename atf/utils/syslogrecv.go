@@ -0,0 +1,309 @@
+/*
+ * syslogrecv.go - a simple syslog receiver
+ *
+ * The receiver listens on UDP and/or TCP and passes every received message
+ * (parsed into SyslogMsg) to the handler. Both RFC 5424 and RFC 3164 messages
+ * are accepted; over TCP, both octet-counting and newline-delimited framing
+ * is supported (RFC 6587).
+ */
+
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Returns the timestamp of the message (zero if unknown).
+func (s *SyslogMsg) Time() time.Time { return s.time }
+
+// Parses the syslog message in RFC 5424 or RFC 3164 format. The messages
+// without the priority are accepted, too: the priority defaults to
+// user.notice (RFC 3164, 4.3.3).
+func ParseSyslogMsg(text string) (*SyslogMsg, error) {
+	m := &SyslogMsg{Sev: Notice, Fac: FacUser}
+	text = strings.TrimRight(text, "\r\n\x00")
+	if strings.HasPrefix(text, "<") {
+		end := strings.IndexByte(text, '>')
+		if end < 2 || end > 4 {
+			return nil, fmt.Errorf("syslog: invalid priority")
+		}
+		pri, err := strconv.Atoi(text[1:end])
+		if err != nil || pri > 191 {
+			return nil, fmt.Errorf("syslog: invalid priority")
+		}
+		m.Sev, m.Fac = Severity(pri%8), Facility(pri/8)
+		text = text[end+1:]
+	}
+	if strings.HasPrefix(text, "1 ") {
+		return m, m.parse5424(text[2:])
+	}
+	m.parse3164(text)
+	return m, nil
+}
+
+// Parses the rest of the RFC 5424 message (after the version).
+func (m *SyslogMsg) parse5424(text string) error {
+	fields := strings.SplitN(text, " ", 6)
+	if len(fields) < 6 {
+		return fmt.Errorf("syslog: invalid RFC 5424 header")
+	}
+	nilvalue := func(v string) string {
+		if v == "-" {
+			return ""
+		}
+		return v
+	}
+	if t, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+		m.SetTimestamp(t)
+	}
+	m.Hostname = nilvalue(fields[1])
+	m.AppName = nilvalue(fields[2])
+	m.ProcId = nilvalue(fields[3])
+	m.MsgId = nilvalue(fields[4])
+	rest := fields[5]
+	if strings.HasPrefix(rest, "-") {
+		rest = rest[1:]
+	} else {
+		var err error
+		if m.Data, rest, err = parseSD(rest); err != nil {
+			return err
+		}
+	}
+	m.Msg = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff")
+	return nil
+}
+
+// Parses the structured data elements; returns the rest of the text.
+func parseSD(text string) ([]*SDElement, string, error) {
+	elements := make([]*SDElement, 0)
+	for strings.HasPrefix(text, "[") {
+		end, quoted, escaped := -1, false, false
+		for i := 1; i < len(text) && end < 0; i++ {
+			switch {
+			case escaped:
+				escaped = false
+			case text[i] == '\\':
+				escaped = true
+			case text[i] == '"':
+				quoted = !quoted
+			case text[i] == ']' && !quoted:
+				end = i
+			}
+		}
+		if end < 0 {
+			return nil, "", fmt.Errorf("syslog: invalid structured data")
+		}
+		elements = append(elements, parseSDElement(text[1:end]))
+		text = text[end+1:]
+	}
+	return elements, text, nil
+}
+
+// Parses the contents of the single structured data element.
+func parseSDElement(text string) *SDElement {
+	id, params, _ := strings.Cut(text, " ")
+	e := &SDElement{ID: id, Params: make(map[string]string)}
+	for params != "" {
+		name, rest, ok := strings.Cut(strings.TrimLeft(params, " "), `="`)
+		if !ok {
+			break
+		}
+		value := ""
+		i := 0
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+			}
+			value += string(rest[i])
+		}
+		e.Params[name] = value
+		if i >= len(rest) {
+			break
+		}
+		params = rest[i+1:]
+	}
+	return e
+}
+
+// Parses the rest of the RFC 3164 message (after the priority): the
+// timestamp and hostname are optional, the tag is recognized.
+func (m *SyslogMsg) parse3164(text string) {
+	if len(text) >= 16 && text[15] == ' ' {
+		if t, err := time.Parse(TimestampFmt, text[:15]); err == nil {
+			now := time.Now()
+			m.SetTimestamp(t.AddDate(now.Year(), 0, 0))
+			text = text[16:]
+			if host, rest, ok := strings.Cut(text, " "); ok {
+				m.Hostname, text = host, rest
+			}
+		}
+	}
+	// TAG[PID]: MSG
+	if tag, msg, ok := strings.Cut(text, ": "); ok &&
+		!strings.ContainsAny(tag, " \t") && len(tag) <= 48 {
+		if i := strings.IndexByte(tag, '['); i > 0 &&
+			strings.HasSuffix(tag, "]") {
+			m.ProcId = tag[i+1 : len(tag)-1]
+			tag = tag[:i]
+		}
+		m.AppName, text = tag, msg
+	}
+	m.Msg = text
+}
+
+// A function that handles the received syslog message.
+type SyslogMsgHandler func(m *SyslogMsg, from net.Addr)
+
+/*
+ * SyslogReceiver - a syslog receiver listening on UDP and/or TCP
+ */
+type SyslogReceiver struct {
+	udp     net.PacketConn
+	tcp     net.Listener
+	handler SyslogMsgHandler
+
+	conns map[net.Conn]bool // open TCP connections
+	mutex sync.Mutex
+	wg    sync.WaitGroup
+}
+
+// Starts the syslog receiver listening on given address (e.g. ":5514") using
+// given transport: "udp", "tcp" or "both". The received messages are passed
+// to the handler; the handler may be called concurrently.
+func ListenSyslog(proto, addr string,
+	handler SyslogMsgHandler) (*SyslogReceiver, error) {
+
+	r := &SyslogReceiver{handler: handler, conns: make(map[net.Conn]bool)}
+	var err error
+	if proto == "udp" || proto == "both" {
+		if r.udp, err = net.ListenPacket("udp", addr); err != nil {
+			return nil, err
+		}
+		r.wg.Add(1)
+		go r.serveUdp()
+	}
+	if proto == "tcp" || proto == "both" {
+		if r.tcp, err = net.Listen("tcp", addr); err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.wg.Add(1)
+		go r.serveTcp()
+	}
+	if r.udp == nil && r.tcp == nil {
+		return nil, fmt.Errorf("syslog: invalid transport %q", proto)
+	}
+	return r, nil
+}
+
+// Returns a plain text representation of the SyslogReceiver instance.
+func (r *SyslogReceiver) String() string {
+	s := "SyslogReceiver:"
+	if r.udp != nil {
+		s += " udp://" + r.udp.LocalAddr().String()
+	}
+	if r.tcp != nil {
+		s += " tcp://" + r.tcp.Addr().String()
+	}
+	return s
+}
+
+// Receives the UDP datagrams: one message per datagram.
+func (r *SyslogReceiver) serveUdp() {
+	defer r.wg.Done()
+	buf := make([]byte, 64*1024)
+	for {
+		n, from, err := r.udp.ReadFrom(buf)
+		if err != nil {
+			return // closed
+		}
+		if m, err := ParseSyslogMsg(string(buf[:n])); err == nil {
+			r.handler(m, from)
+		}
+	}
+}
+
+// Accepts the TCP connections.
+func (r *SyslogReceiver) serveTcp() {
+	defer r.wg.Done()
+	for {
+		conn, err := r.tcp.Accept()
+		if err != nil {
+			return // closed
+		}
+		r.mutex.Lock()
+		r.conns[conn] = true
+		r.mutex.Unlock()
+		r.wg.Add(1)
+		go r.serveConn(conn)
+	}
+}
+
+// Receives the messages from the TCP connection; every message is either
+// octet-counted ("LEN MSG") or terminated by a newline.
+func (r *SyslogReceiver) serveConn(conn net.Conn) {
+	defer r.wg.Done()
+	defer func() {
+		r.mutex.Lock()
+		delete(r.conns, conn)
+		r.mutex.Unlock()
+		conn.Close()
+	}()
+	rd := bufio.NewReader(conn)
+	for {
+		b, err := rd.Peek(1)
+		if err != nil {
+			return
+		}
+		var text string
+		if b[0] >= '1' && b[0] <= '9' {
+			length, err := rd.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(length))
+			if err != nil || n > 1024*1024 {
+				return // garbage: drop the connection
+			}
+			msg := make([]byte, n)
+			if _, err = io.ReadFull(rd, msg); err != nil {
+				return
+			}
+			text = string(msg)
+		} else {
+			if text, err = rd.ReadString('\n'); err != nil && text == "" {
+				return
+			}
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if m, err := ParseSyslogMsg(text); err == nil {
+			r.handler(m, conn.RemoteAddr())
+		}
+	}
+}
+
+// Stops the receiver: the listeners and all the connections are closed.
+func (r *SyslogReceiver) Close() error {
+	if r.udp != nil {
+		r.udp.Close()
+	}
+	if r.tcp != nil {
+		r.tcp.Close()
+	}
+	r.mutex.Lock()
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mutex.Unlock()
+	r.wg.Wait()
+	return nil
+}
@@ -13,13 +13,16 @@ import (
 	"strings"
 	"time"
 )
+// The layout of the timestamps returned by Now().
+const NowFmt = "2006-01-02 15:04:05"
+
 /*
     Return current timestamp as a string with the following format: 
     "2006-01-02 15:04:05".
  */
 func Now() string {
 	t := time.Now()
-	return t.Format("2006-01-02 15:04:05")
+	return t.Format(NowFmt)
 }
 
 /*
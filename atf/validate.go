@@ -0,0 +1,134 @@
+/*
+ * validate.go - validation of the test set configuration
+ *
+ * The config is checked before it is executed, so the mistakes (missing
+ * names, invalid expected results, unknown script types, typos in budgets and
+ * SUT log expressions...) are found without running the test set that may
+ * take hours.
+ */
+
+package atf
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Validates the test set as it has been read from the config (see
+// LoadTestSet()). Returns the descriptions of the problems found (none, if the
+// test set is valid).
+func (ts *TestSet) Validate() []string {
+	problems := make([]string, 0)
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if ts.Name == "" {
+		report("test set: missing name")
+	}
+	if len(ts.Cases) == 0 {
+		report("test set: no test cases")
+	}
+	for _, p := range validateAction(ts.Setup) {
+		report("test set setup: %s", p)
+	}
+	for _, p := range validateAction(ts.Cleanup) {
+		report("test set cleanup: %s", p)
+	}
+
+	cases := make(map[string]bool)
+	for i, tc := range ts.Cases {
+		where := fmt.Sprintf("case %d", i+1)
+		if tc.Name == "" {
+			report("%s: missing name", where)
+		} else {
+			where = fmt.Sprintf("case %q", tc.Name)
+			if cases[tc.Name] {
+				report("%s: duplicate name", where)
+			}
+			cases[tc.Name] = true
+		}
+		for _, p := range tc.validate() {
+			report("%s: %s", where, p)
+		}
+	}
+	return problems
+}
+
+// Validates the test case and its steps.
+func (tc *TestCase) validate() []string {
+	problems := make([]string, 0)
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if tc.Expected != "Pass" && tc.Expected != "XFail" {
+		report("invalid expected result %q (Pass or XFail)", tc.Expected)
+	}
+	if tc.Budget != "" {
+		if _, err := time.ParseDuration(tc.Budget); err != nil {
+			report("invalid budget %q", tc.Budget)
+		}
+	}
+	if tc.OnBudget != "" && tc.OnBudget != "warn" && tc.OnBudget != "fail" {
+		report("invalid budget policy %q (warn or fail)", tc.OnBudget)
+	}
+	for _, p := range validateAction(tc.Setup) {
+		report("setup: %s", p)
+	}
+	for _, p := range validateAction(tc.Cleanup) {
+		report("cleanup: %s", p)
+	}
+	if len(tc.Steps) == 0 {
+		report("no test steps")
+	}
+
+	steps := make(map[string]bool)
+	for i, step := range tc.Steps {
+		where := fmt.Sprintf("step %d", i+1)
+		if step.Name == "" {
+			report("%s: missing name", where)
+		} else {
+			where = fmt.Sprintf("step %q", step.Name)
+			if steps[step.Name] {
+				report("%s: duplicate name", where)
+			}
+			steps[step.Name] = true
+		}
+		if step.Expected != "Pass" && step.Expected != "XFail" {
+			report("%s: invalid expected result %q (Pass or XFail)", where,
+				step.Expected)
+		}
+		if step.Action == nil {
+			report("%s: missing action", where)
+		} else if step.Action.setFlags(); !step.Action.IsExecutable() &&
+			!step.Action.IsManual() {
+			report("%s: action with neither script nor description", where)
+		}
+		for _, p := range validateAction(step.Action) {
+			report("%s: %s", where, p)
+		}
+		if step.ExpectLog != "" {
+			if _, err := regexp.Compile(step.ExpectLog); err != nil {
+				report("%s: invalid SUT log expression: %s", where, err)
+			}
+		}
+	}
+	return problems
+}
+
+// Validates the action (if defined): the type of the script must be known.
+// The empty actions are valid: they do nothing.
+func validateAction(a *Action) []string {
+	problems := make([]string, 0)
+	if a == nil {
+		return problems
+	}
+	a.setFlags()
+	if a.IsExecutable() && determineType(a.Script) == UnknownScript {
+		problems = append(problems, fmt.Sprintf("unknown script type %q",
+			a.Script))
+	}
+	return problems
+}
@@ -0,0 +1,85 @@
+package atf
+
+import (
+	"strings"
+	"testing"
+)
+
+// Creates a valid test set with a single case of a single step.
+func validTestSet() *TestSet {
+	return &TestSet{Name: "set", Cases: []*TestCase{&TestCase{Name: "a",
+		Expected: "Pass", Budget: "1m", OnBudget: "fail",
+		Steps: []*TestStep{&TestStep{Name: "step", Expected: "Pass",
+			Action: &Action{Script: "check.py"}, ExpectLog: "link up"}}}}}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(ts *TestSet)
+		expected string // the problem; none if empty
+	}{
+		{"valid", func(ts *TestSet) {}, ""},
+		{"manual step", func(ts *TestSet) {
+			ts.Cases[0].Steps[0].Action = &Action{Description: "check it"}
+		}, ""},
+		{"no set name", func(ts *TestSet) { ts.Name = "" },
+			"test set: missing name"},
+		{"no cases", func(ts *TestSet) { ts.Cases = nil },
+			"test set: no test cases"},
+		{"set setup", func(ts *TestSet) {
+			ts.Setup = &Action{Script: "setup.xyz"}
+		}, `test set setup: unknown script type "setup.xyz"`},
+		{"no case name", func(ts *TestSet) { ts.Cases[0].Name = "" },
+			"case 1: missing name"},
+		{"duplicate case", func(ts *TestSet) {
+			ts.Cases = append(ts.Cases, ts.Cases[0])
+		}, `case "a": duplicate name`},
+		{"case expected", func(ts *TestSet) { ts.Cases[0].Expected = "Fail" },
+			`case "a": invalid expected result "Fail"`},
+		{"budget", func(ts *TestSet) { ts.Cases[0].Budget = "1 minute" },
+			`case "a": invalid budget "1 minute"`},
+		{"budget policy", func(ts *TestSet) { ts.Cases[0].OnBudget = "skip" },
+			`case "a": invalid budget policy "skip"`},
+		{"case cleanup", func(ts *TestSet) {
+			ts.Cases[0].Cleanup = &Action{Script: "clean.sh2"}
+		}, `case "a": cleanup: unknown script type "clean.sh2"`},
+		{"no steps", func(ts *TestSet) { ts.Cases[0].Steps = nil },
+			`case "a": no test steps`},
+		{"no step name", func(ts *TestSet) { ts.Cases[0].Steps[0].Name = "" },
+			`case "a": step 1: missing name`},
+		{"duplicate step", func(ts *TestSet) {
+			tc := ts.Cases[0]
+			tc.Steps = append(tc.Steps, &TestStep{Name: "step",
+				Expected: "Pass", Action: &Action{Script: "true"}})
+		}, `case "a": step "step": duplicate name`},
+		{"step expected", func(ts *TestSet) {
+			ts.Cases[0].Steps[0].Expected = ""
+		}, `case "a": step "step": invalid expected result ""`},
+		{"no action", func(ts *TestSet) { ts.Cases[0].Steps[0].Action = nil },
+			`case "a": step "step": missing action`},
+		{"empty action", func(ts *TestSet) {
+			ts.Cases[0].Steps[0].Action = &Action{}
+		}, `case "a": step "step": action with neither script nor`},
+		{"SUT log", func(ts *TestSet) {
+			ts.Cases[0].Steps[0].ExpectLog = "link (up"
+		}, `case "a": step "step": invalid SUT log expression`},
+	}
+	for _, test := range tests {
+		ts := validTestSet()
+		test.modify(ts)
+		problems := ts.Validate()
+		if test.expected == "" {
+			if len(problems) > 0 {
+				t.Errorf("%q: got %q, expected no problems", test.name,
+					problems)
+			}
+			continue
+		}
+		if len(problems) != 1 ||
+			!strings.HasPrefix(problems[0], test.expected) {
+			t.Errorf("%q: got %q, expected %q", test.name, problems,
+				test.expected)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * audit.go - the 'audit' subcommand: display and verify the audit log
+ *
+ * Usage: goatf audit list [-root dir] [-f text|json]
+ *        goatf audit verify [-root dir]
+ *
+ * The verification fails (exit status 1) when the hash chain of the audit log
+ * is broken or any of the recorded reports has been modified.
+ */
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+	"bitbucket.org/miranr/goatf/atf"
+)
+
+/*
+ * auditCmd - dispatch the 'audit' subcommands
+ */
+func auditCmd(args []string) int {
+	if len(args) < 1 || (args[0] != "list" && args[0] != "verify") {
+		fmt.Fprintln(os.Stderr, "Usage: goatf audit list|verify [options]")
+		return 1
+	}
+	fs := flag.NewFlagSet("audit "+args[0], flag.ExitOnError)
+	root := fs.String("root", defaultRootDir(), "root of the working dirs")
+	format := "text"
+	if args[0] == "list" {
+		fs.StringVar(&format, "f", "text", "output format: text or json")
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: goatf audit %s [options]\n", args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+
+	log := atf.OpenAuditLog(*root)
+	if args[0] == "verify" {
+		problems, err := log.Verify()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot read audit log: %s\n", err)
+			return 1
+		}
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if len(problems) > 0 {
+			fmt.Printf("%s: %d problem(s) found\n", log.String(),
+				len(problems))
+			return 1
+		}
+		fmt.Printf("%s: OK\n", log.String())
+		return 0
+	}
+
+	entries, err := log.Entries()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot read audit log: %s\n", err)
+		return 1
+	}
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(string(b))
+	case "text":
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "SEQ\tTIME\tUSER\tHOST\tACTION\tSUBJECT")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", e.Seq,
+				e.Time.Local().Format(time.RFC3339), e.User, e.Host, e.Action,
+				e.Subject)
+		}
+		w.Flush()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown output format %q\n", format)
+		return 1
+	}
+	return 0
+}
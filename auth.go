@@ -0,0 +1,399 @@
+/*
+ * auth.go - the authentication of the 'goatf serve' clients
+ *
+ * The clients authenticate in one of the following ways:
+ *
+ *   - API token (automation clients, e.g. CI): 'Authorization: Bearer <token>'
+ *     header; the tokens are created by 'goatf token' or over the API
+ *   - session cookie (browser users): the session is created by logging in
+ *     (POST /api/login) and destroyed by logging out (POST /api/logout)
+ *   - HTTP basic authentication: username and password
+ *
+ * The API to manage the tokens of the authenticated user:
+ *
+ *   POST   /api/tokens                create a token; optional query
+ *                                     parameters: role, expires (duration,
+ *                                     e.g. 720h) and descr
+ *   GET    /api/tokens                list the tokens (all, for admins)
+ *   DELETE /api/tokens/{id}           revoke the token
+ *
+ * The logins, token management and runs are recorded into the audit log.
+ */
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"bitbucket.org/miranr/goatf/atf"
+	"bitbucket.org/miranr/goatf/atf/utils"
+)
+
+// The name of the session cookie.
+const sessionCookie = "goatf_session"
+
+// The default lifetime of the sessions.
+const defSessionTTL = 12 * time.Hour
+
+// the type of the context key holding the authenticated principal
+type userKey struct{}
+
+/*
+ * principal - the authenticated user and the way it was authenticated
+ */
+type principal struct {
+	user    *atf.User
+	via     string     // "password", "session" or "token <id>"
+	expires *time.Time // the expiration of the token, if any
+}
+
+/*
+ * session - a single login session of a browser user
+ */
+type session struct {
+	username string
+	expires  time.Time
+}
+
+/*
+ * sessions - the active sessions, keyed by the (random) session ID
+ */
+type sessions struct {
+	active map[string]*session
+	ttl    time.Duration
+	mutex  sync.Mutex
+}
+
+/*
+ * newSessions - create an empty set of sessions with given lifetime
+ */
+func newSessions(ttl time.Duration) *sessions {
+	return &sessions{active: make(map[string]*session), ttl: ttl}
+}
+
+/*
+ * sessions.create - create a new session for the user; returns the ID
+ */
+func (ss *sessions) create(username string) (string, time.Time) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	// drop the expired sessions while we're here
+	now := time.Now()
+	for id, sess := range ss.active {
+		if now.After(sess.expires) {
+			delete(ss.active, id)
+		}
+	}
+	id := randomId()
+	expires := now.Add(ss.ttl)
+	ss.active[id] = &session{username, expires}
+	return id, expires
+}
+
+/*
+ * sessions.lookup - return the username of the valid session
+ */
+func (ss *sessions) lookup(id string) (string, bool) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	sess, found := ss.active[id]
+	if !found || time.Now().After(sess.expires) {
+		return "", false
+	}
+	return sess.username, true
+}
+
+/*
+ * sessions.destroy - destroy the session
+ */
+func (ss *sessions) destroy(id string) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	delete(ss.active, id)
+}
+
+/*
+ * randomId - return a new random session ID
+ */
+func randomId() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("Cannot read random bytes.")
+	}
+	return hex.EncodeToString(b)
+}
+
+/*
+ * Server.authenticate - authenticate the client of the request; returns nil
+ * (and the error) when the authentication fails
+ */
+func (s *Server) authenticate(req *http.Request) (*principal, error) {
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth,
+		"Bearer ") {
+		u, t, err := atf.AuthenticateToken(s.users, s.tokens,
+			strings.TrimPrefix(auth, "Bearer "))
+		if err != nil {
+			if err == atf.ATFError_Authentication_Failed {
+				s.audit(req, nil, "failed token authentication")
+			}
+			return nil, err
+		}
+		return &principal{u, "token " + t.ID, t.Expires}, nil
+	}
+	if c, err := req.Cookie(sessionCookie); err == nil {
+		if username, ok := s.sessions.lookup(c.Value); ok {
+			// the user is re-read, so the changes take effect immediately
+			u, err := s.users.Get(username)
+			if err == atf.ATFError_User_Not_Found {
+				return nil, atf.ATFError_Authentication_Failed
+			}
+			if err != nil {
+				return nil, err
+			}
+			return &principal{u, "session", nil}, nil
+		}
+	}
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return nil, atf.ATFError_Authentication_Failed
+	}
+	u, err := atf.Authenticate(s.users, username, password)
+	if err != nil {
+		if err == atf.ATFError_Authentication_Failed {
+			s.audit(req, nil, "failed login as %q", username)
+		}
+		return nil, err
+	}
+	return &principal{u, "password", nil}, nil
+}
+
+/*
+ * Server.authorize - authenticate the client and check the permission before
+ * calling the handler
+ */
+func (s *Server) authorize(p atf.Permission,
+	h http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		who, err := s.authenticate(req)
+		if err == atf.ATFError_Authentication_Failed {
+			// the dashboard displays its own login form
+			if req.Header.Get("X-Requested-With") == "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="goatf"`)
+			}
+			httpError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		if err != nil {
+			httpError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !who.user.HasPermission(p) {
+			httpError(w, http.StatusForbidden, "permission denied")
+			return
+		}
+		h(w, req.WithContext(context.WithValue(req.Context(), userKey{}, who)))
+	}
+}
+
+/*
+ * currentUser - return the authenticated user of the request
+ */
+func currentUser(req *http.Request) *atf.User {
+	return req.Context().Value(userKey{}).(*principal).user
+}
+
+/*
+ * Server.audit - record the action of the user into the audit log; the user
+ * is nil when the request is not authenticated
+ */
+func (s *Server) audit(req *http.Request, who *principal, format string,
+	args ...interface{}) {
+
+	user := "-"
+	if who == nil {
+		who, _ = req.Context().Value(userKey{}).(*principal)
+	}
+	if who != nil {
+		user = fmt.Sprintf("%s (%s)", who.user.Username, who.via)
+	}
+	s.log.Notice(fmt.Sprintf("AUDIT %s from %s: %s\n", user, req.RemoteAddr,
+		fmt.Sprintf(format, args...)))
+}
+
+/*
+ * Server.login - log the user in: the username and password are sent as JSON
+ * or as form values; the session cookie is set
+ */
+func (s *Server) login(w http.ResponseWriter, req *http.Request) {
+	var creds struct{ Username, Password string }
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(req.Body).Decode(&creds); err != nil {
+			httpError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		creds.Username = req.FormValue("username")
+		creds.Password = req.FormValue("password")
+	}
+	u, err := atf.Authenticate(s.users, creds.Username, creds.Password)
+	if err == atf.ATFError_Authentication_Failed {
+		s.audit(req, nil, "failed login as %q", creds.Username)
+		httpError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	id, expires := s.sessions.create(u.Username)
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: id, Path: "/",
+		Expires: expires, HttpOnly: true, Secure: req.TLS != nil,
+		SameSite: http.SameSiteStrictMode})
+	s.audit(req, &principal{u, "password", nil}, "logged in")
+	u.Password = ""
+	writeJson(w, http.StatusOK, u)
+}
+
+/*
+ * Server.logout - log the user out: the session is destroyed
+ */
+func (s *Server) logout(w http.ResponseWriter, req *http.Request) {
+	if c, err := req.Cookie(sessionCookie); err == nil {
+		if username, ok := s.sessions.lookup(c.Value); ok {
+			s.audit(req, &principal{&atf.User{Username: username},
+				"session", nil}, "logged out")
+		}
+		s.sessions.destroy(c.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/",
+		MaxAge: -1, HttpOnly: true})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+ * Server.whoami - display the authenticated user
+ */
+func (s *Server) whoami(w http.ResponseWriter, req *http.Request) {
+	u := *currentUser(req)
+	u.Password = ""
+	writeJson(w, http.StatusOK, &u)
+}
+
+/*
+ * Server.createToken - create a new API token for the authenticated user;
+ * the token is displayed only in this reply. The new token expires no later
+ * than the token the client has authenticated with.
+ */
+func (s *Server) createToken(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	var ttl time.Duration
+	if e := q.Get("expires"); e != "" {
+		var err error
+		if ttl, err = time.ParseDuration(e); err != nil || ttl < 0 {
+			httpError(w, http.StatusBadRequest, "invalid expiration")
+			return
+		}
+	}
+	// the token created by the client authenticated by an expiring token
+	// must not outlive that one
+	who := req.Context().Value(userKey{}).(*principal)
+	if who.expires != nil {
+		left := time.Until(*who.expires)
+		if left <= 0 {
+			httpError(w, http.StatusUnauthorized, "token expired")
+			return
+		}
+		if ttl == 0 || ttl > left {
+			ttl = left
+		}
+	}
+	t, token, err := atf.NewApiToken(currentUser(req), q.Get("role"), ttl,
+		q.Get("descr"))
+	if err == atf.ATFError_Permission_Denied {
+		httpError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err = s.tokens.Add(t); err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.audit(req, nil, "created token %s (role %s)", t.ID, t.Role)
+	t.Hash = ""
+	writeJson(w, http.StatusCreated, map[string]interface{}{"Token": token,
+		"Info": t})
+}
+
+/*
+ * Server.listTokens - list the tokens of the user (all tokens for admins);
+ * the hashes are never displayed
+ */
+func (s *Server) listTokens(w http.ResponseWriter, req *http.Request) {
+	tokens, err := s.tokens.List()
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	u := currentUser(req)
+	result := make([]*atf.ApiToken, 0, len(tokens))
+	for _, t := range tokens {
+		if t.Username == u.Username || u.HasPermission(atf.AdminPermission) {
+			t.Hash = ""
+			result = append(result, t)
+		}
+	}
+	writeJson(w, http.StatusOK, result)
+}
+
+/*
+ * Server.revokeToken - revoke the token of the user (any token for admins)
+ */
+func (s *Server) revokeToken(w http.ResponseWriter, req *http.Request) {
+	t, err := s.tokens.Get(req.PathValue("id"))
+	u := currentUser(req)
+	if err == atf.ATFError_Token_Not_Found || (err == nil &&
+		t.Username != u.Username && !u.HasPermission(atf.AdminPermission)) {
+		httpError(w, http.StatusNotFound, "token not found")
+		return
+	}
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	t.Revoke()
+	if err = s.tokens.Update(t); err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.audit(req, nil, "revoked token %s of %s", t.ID, t.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+ * createServerLog - create and start the server log: the messages (including
+ * the audit records) are displayed and appended to the log file
+ */
+func createServerLog(logfile string) (*utils.Log, error) {
+	log := utils.NewLog()
+	format := utils.DefaultLogFormat
+	if logfile != "" {
+		f, err := utils.NewAppendFileHandler(logfile, format, defFileLevel)
+		if err != nil {
+			return nil, err
+		}
+		log.Handlers = log.AddHandler(f)
+	}
+	log.Handlers = log.AddHandler(utils.NewStreamHandler(format,
+		defStreamLevel))
+	return log, log.Start()
+}
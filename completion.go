@@ -0,0 +1,144 @@
+/*
+ * completion.go - the 'completion' subcommand: print the shell completion
+ * script
+ *
+ * The scripts complete the commands and their subcommands; the options are
+ * taken from the help of the command itself ('goatf <command> -h'), so they
+ * are always up to date. To enable the completion:
+ *
+ *   bash: source <(goatf completion bash)
+ *   zsh:  source <(goatf completion zsh)    (after compinit)
+ *
+ * Usage: goatf completion bash|zsh
+ */
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Extracts the option names from the help of the command (see
+// flag.PrintDefaults()).
+const completionFlags = `sed -n 's/^  \(-[A-Za-z0-9-]*\).*/\1/p'`
+
+/*
+ * completionSubs - the shell 'case' branches with the subcommands of the
+ * commands; 'help' is completed with the commands
+ */
+func completionSubs() string {
+	names := make([]string, 0, len(commands))
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	s := fmt.Sprintf("    help) subs=%q ;;\n", strings.Join(names, " "))
+	for _, c := range commands {
+		if len(c.subs) > 0 {
+			s += fmt.Sprintf("    %s) subs=%q ;;\n", c.name,
+				strings.Join(c.subs, " "))
+		}
+	}
+	return s
+}
+
+/*
+ * bashCompletion - the bash completion script
+ */
+func bashCompletion() string {
+	names := make([]string, 0, len(commands))
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	s := "# bash completion for goatf\n"
+	s += "_goatf() {\n"
+	s += "  local cur=\"${COMP_WORDS[COMP_CWORD]}\" cmd=\"${COMP_WORDS[1]}\"\n"
+	s += "  local subs=\"\" flags\n"
+	s += "  COMPREPLY=()\n"
+	s += "  if [ \"$COMP_CWORD\" -eq 1 ]; then\n"
+	s += fmt.Sprintf("    COMPREPLY=($(compgen -W %q -- \"$cur\"))\n",
+		strings.Join(names, " "))
+	s += "    return\n"
+	s += "  fi\n"
+	s += "  case \"$cmd\" in\n"
+	s += completionSubs()
+	s += "  esac\n"
+	s += "  if [ -n \"$subs\" ] && [ \"$COMP_CWORD\" -eq 2 ]; then\n"
+	s += "    COMPREPLY=($(compgen -W \"$subs\" -- \"$cur\"))\n"
+	s += "    return\n"
+	s += "  fi\n"
+	s += "  case \"$cur\" in\n"
+	s += "  -*)\n"
+	s += "    if [ -n \"$subs\" ]; then\n"
+	s += "      flags=$(\"${COMP_WORDS[0]}\" \"$cmd\" \"${COMP_WORDS[2]}\" -h 2>&1 | " +
+		completionFlags + ")\n"
+	s += "    else\n"
+	s += "      flags=$(\"${COMP_WORDS[0]}\" \"$cmd\" -h 2>&1 | " +
+		completionFlags + ")\n"
+	s += "    fi\n"
+	s += "    COMPREPLY=($(compgen -W \"$flags\" -- \"$cur\")) ;;\n"
+	s += "  *)\n"
+	s += "    COMPREPLY=($(compgen -f -- \"$cur\")) ;;\n"
+	s += "  esac\n"
+	s += "}\n"
+	s += "complete -o filenames -F _goatf goatf\n"
+	return s
+}
+
+/*
+ * zshCompletion - the zsh completion script
+ */
+func zshCompletion() string {
+	s := "#compdef goatf\n"
+	s += "# zsh completion for goatf\n"
+	s += "_goatf() {\n"
+	s += "  local -a cmds flags\n"
+	s += "  local subs=\"\"\n"
+	s += "  cmds=(\n"
+	for _, c := range commands {
+		s += fmt.Sprintf("    %q\n", c.name+":"+c.descr)
+	}
+	s += "  )\n"
+	s += "  if (( CURRENT == 2 )); then\n"
+	s += "    _describe 'command' cmds\n"
+	s += "    return\n"
+	s += "  fi\n"
+	s += "  case \"$words[2]\" in\n"
+	s += completionSubs()
+	s += "  esac\n"
+	s += "  if [[ -n \"$subs\" ]] && (( CURRENT == 3 )); then\n"
+	s += "    compadd -- ${=subs}\n"
+	s += "    return\n"
+	s += "  fi\n"
+	s += "  if [[ \"$PREFIX\" == -* ]]; then\n"
+	s += "    if [[ -n \"$subs\" ]]; then\n"
+	s += "      flags=(${(f)\"$(\"$words[1]\" \"$words[2]\" \"$words[3]\" -h 2>&1 | " +
+		completionFlags + ")\"})\n"
+	s += "    else\n"
+	s += "      flags=(${(f)\"$(\"$words[1]\" \"$words[2]\" -h 2>&1 | " +
+		completionFlags + ")\"})\n"
+	s += "    fi\n"
+	s += "    compadd -a flags\n"
+	s += "    return\n"
+	s += "  fi\n"
+	s += "  _files\n"
+	s += "}\n"
+	s += "compdef _goatf goatf\n"
+	return s
+}
+
+/*
+ * completionCmd - print the completion script for the given shell
+ */
+func completionCmd(args []string) int {
+	if len(args) != 1 || (args[0] != "bash" && args[0] != "zsh") {
+		fmt.Fprintln(os.Stderr, "Usage: goatf completion bash|zsh")
+		return 1
+	}
+	if args[0] == "bash" {
+		fmt.Print(bashCompletion())
+	} else {
+		fmt.Print(zshCompletion())
+	}
+	return 0
+}
@@ -0,0 +1,448 @@
+/*
+ * config.go - the runner configuration file and profiles
+ *
+ * The runner settings can be given in the JSON configuration file instead of
+ * the command line; the file can define named profiles (e.g. for different
+ * labs) that override the common settings:
+ *
+ *   {
+ *     "Workdir": "/var/goatf/runs/latest",
+ *     "Json": true,
+ *     "LogLevel": "debug",
+ *     "Interpreters": {"python": "python3"},
+ *     "Variables": {"SUT_USER": "admin"},
+ *     "Profiles": {
+ *       "lab2": {"Syslog": "syslog.lab2:514", "Variables": {"SUT": "10.2.0.1"}}
+ *     }
+ *   }
+ *
+ * The settings are taken from (the first one wins): the command line flags,
+ * the environment variables (GOATF_<SETTING>, e.g. GOATF_LOG_LEVEL, and
+ * GOATF_VAR_<NAME> for the variables), the selected profile, the common
+ * settings of the file and the defaults. The configuration file is given by
+ * '-config' (or GOATF_CONFIG), the profile by '-profile' (or GOATF_PROFILE).
+ *
+ * Only JSON is supported: YAML would need a third-party parser and GoATF
+ * depends on the standard library only.
+ *
+ * Usage: goatf config show [-f text|json] [runner options]
+ */
+package main
+
+import (
+	"bitbucket.org/miranr/goatf/atf"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+// The default name of the runner configuration file (in the current dir).
+const defaultConfigFile = "goatf.json"
+
+// The prefix of the environment variables with the runner settings.
+const envPrefix = "GOATF_"
+
+// The runner settings that can be configured: the key in the configuration
+// file and the corresponding command-line flag. The environment variable is
+// derived from the key (see envName()).
+var runnerSettings = []struct{ key, flag string }{
+	{"Input", "i"},
+	{"Workdir", "w"},
+	{"Root", "root"},
+	{"Report", "r"},
+	{"CSS", "c"},
+	{"Xml", "X"},
+	{"Json", "J"},
+	{"Text", "T"},
+	{"Incremental", "incremental"},
+	{"AbortCleanup", "abort-cleanup"},
+	{"Progress", "progress"},
+	{"History", "history"},
+	{"FlakyRuns", "flaky-runs"},
+	{"Quarantine", "quarantine"},
+	{"Parallel", "parallel"},
+	{"Debug", "d"},
+	{"LogFile", "l"},
+	{"LogFormat", "log-format"},
+	{"LogTimeFormat", "log-time-format"},
+	{"LogLevel", "log-level"},
+	{"ConsoleLevel", "console-level"},
+	{"SyslogLevel", "syslog-level"},
+	{"JsonLog", "json-log"},
+	{"CaseLogs", "case-logs"},
+	{"LogMaxSize", "log-max-size"},
+	{"LogMaxAge", "log-max-age"},
+	{"LogMaxBackups", "log-max-backups"},
+	{"LogCompress", "log-compress"},
+	{"LogAppend", "log-append"},
+	{"LogBuffer", "log-buffer"},
+	{"LogOverflow", "log-overflow"},
+	{"Syslog", "s"},
+	{"SyslogProto", "syslog-proto"},
+	{"SyslogFormat", "syslog-format"},
+	{"SyslogCA", "syslog-ca"},
+	{"SutLog", "sutlog"},
+	{"SutLogProto", "sutlog-proto"},
+}
+
+/*
+ * envName - the name of the environment variable of the setting: the key
+ * in upper case, words separated by underscores (e.g. "LogMaxSize" becomes
+ * GOATF_LOG_MAX_SIZE)
+ */
+func envName(key string) string {
+	name := envPrefix
+	runes := []rune(key)
+	for i, c := range runes {
+		if i > 0 && unicode.IsUpper(c) && unicode.IsLower(runes[i-1]) {
+			name += "_"
+		}
+		name += string(unicode.ToUpper(c))
+	}
+	return name
+}
+
+/*
+ * variablesFlag - the repeatable 'name=value' command-line flag
+ */
+type variablesFlag map[string]string
+
+func (v *variablesFlag) String() string {
+	if v == nil || *v == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*v))
+	for name, value := range *v {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+func (v *variablesFlag) Set(s string) error {
+	name, value, found := strings.Cut(s, "=")
+	if !found || name == "" {
+		return fmt.Errorf("expected name=value")
+	}
+	if *v == nil {
+		*v = make(map[string]string)
+	}
+	(*v)[name] = value
+	return nil
+}
+
+/*
+ * configSection - the settings of the configuration file (or its profile);
+ * the values are kept raw until they are applied to the flags
+ */
+type configSection struct {
+	Settings     map[string]json.RawMessage
+	Interpreters map[string]string
+	Variables    map[string]string
+}
+
+/*
+ * parseSection - parse the settings of the configuration file section; the
+ * unknown settings are reported
+ */
+func parseSection(raw map[string]json.RawMessage) (*configSection, error) {
+	known := make(map[string]bool)
+	for _, s := range runnerSettings {
+		known[s.key] = true
+	}
+	sec := &configSection{Settings: make(map[string]json.RawMessage)}
+	for key, value := range raw {
+		var err error
+		switch {
+		case key == "Interpreters":
+			err = json.Unmarshal(value, &sec.Interpreters)
+		case key == "Variables":
+			err = json.Unmarshal(value, &sec.Variables)
+		case known[key]:
+			sec.Settings[key] = value
+		default:
+			err = fmt.Errorf("unknown setting")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", key, err)
+		}
+	}
+	return sec, nil
+}
+
+/*
+ * loadConfig - load the runner configuration file: the common settings and
+ * the profiles
+ */
+func loadConfig(filename string) (*configSection,
+	map[string]*configSection, error) {
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return nil, nil, fmt.Errorf("%s: YAML is not supported, use JSON",
+			filename)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal(b, &raw); err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	profiles := make(map[string]*configSection)
+	if p, found := raw["Profiles"]; found {
+		var rawProfiles map[string]map[string]json.RawMessage
+		if err = json.Unmarshal(p, &rawProfiles); err != nil {
+			return nil, nil, fmt.Errorf("%s: Profiles: %s", filename, err)
+		}
+		for name, rp := range rawProfiles {
+			if profiles[name], err = parseSection(rp); err != nil {
+				return nil, nil, fmt.Errorf("%s: profile %q: %s", filename,
+					name, err)
+			}
+		}
+		delete(raw, "Profiles")
+	}
+	common, err := parseSection(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return common, profiles, nil
+}
+
+/*
+ * rawString - the JSON value as the flag value: strings are unquoted, the
+ * numbers and booleans are used as they are
+ */
+func rawString(value json.RawMessage) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(value, &v); err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool, float64:
+		return string(value), nil
+	}
+	return "", fmt.Errorf("expected string, number or boolean")
+}
+
+/*
+ * applyConfig - apply the environment and the configuration file (with the
+ * selected profile) to the runner flags that have not been set on the
+ * command line; returns the source of every setting (by flag name)
+ */
+func applyConfig(fs *flag.FlagSet, r *Runner) (map[string]string, error) {
+	sources := make(map[string]string)
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for _, s := range runnerSettings {
+		sources[s.flag] = "default"
+	}
+
+	// the configuration file is optional, unless it is given explicitly
+	if r.configFile == "" {
+		r.configFile = os.Getenv(envPrefix + "CONFIG")
+	}
+	if r.profile == "" {
+		r.profile = os.Getenv(envPrefix + "PROFILE")
+	}
+	layers := make([]*configSection, 0, 2)
+	names := make([]string, 0, 2)
+	filename := r.configFile
+	if filename == "" {
+		if _, err := os.Stat(defaultConfigFile); err == nil {
+			filename = defaultConfigFile
+		}
+	}
+	if filename != "" {
+		common, profiles, err := loadConfig(filename)
+		if err != nil {
+			return nil, err
+		}
+		r.configFile = filename
+		layers, names = append(layers, common), append(names, "config")
+		if r.profile != "" {
+			p, found := profiles[r.profile]
+			if !found {
+				return nil, fmt.Errorf("%s: profile %q not found", filename,
+					r.profile)
+			}
+			layers = append(layers, p)
+			names = append(names, "profile "+r.profile)
+		}
+	} else if r.profile != "" {
+		return nil, fmt.Errorf("Profile %q given, but no configuration file",
+			r.profile)
+	}
+
+	// the profile overrides the common settings, the environment overrides
+	// both of them
+	vars := make(map[string]string)
+	for i, layer := range layers {
+		for _, s := range runnerSettings {
+			value, found := layer.Settings[s.key]
+			if !found || explicit[s.flag] {
+				continue
+			}
+			v, err := rawString(value)
+			if err == nil {
+				err = fs.Set(s.flag, v)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %s", names[i], s.key, err)
+			}
+			sources[s.flag] = names[i]
+		}
+		for lang, exe := range layer.Interpreters {
+			r.interpreters[lang] = exe
+		}
+		for name, value := range layer.Variables {
+			vars[name] = value
+		}
+	}
+	for _, s := range runnerSettings {
+		value, found := os.LookupEnv(envName(s.key))
+		if !found || explicit[s.flag] {
+			continue
+		}
+		if err := fs.Set(s.flag, value); err != nil {
+			return nil, fmt.Errorf("%s: %s", envName(s.key), err)
+		}
+		sources[s.flag] = "env " + envName(s.key)
+	}
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, envPrefix+"VAR_") {
+			vars[strings.TrimPrefix(name, envPrefix+"VAR_")] = value
+		}
+	}
+
+	// the variables given on the command line win
+	for name, value := range r.variables {
+		vars[name] = value
+	}
+	r.variables = vars
+	for _, s := range runnerSettings {
+		if explicit[s.flag] {
+			sources[s.flag] = "flag"
+		}
+	}
+	return sources, nil
+}
+
+/*
+ * configCmd - the 'config' subcommand
+ */
+func configCmd(args []string) int {
+	if len(args) < 1 || args[0] != "show" {
+		fmt.Fprintln(os.Stderr,
+			"Usage: goatf config show [-f text|json] [runner options]")
+		return 1
+	}
+	r := NewRunner()
+	fs := flag.NewFlagSet("config show", flag.ExitOnError)
+	format := fs.String("f", "text", "output format: text or json")
+	runFlags(r, fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			"Usage: goatf config show [-f text|json] [runner options]")
+		fmt.Fprintln(os.Stderr,
+			"The runner configuration file is JSON (YAML is not supported).")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+	sources, err := applyConfig(fs, r)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for lang, exe := range r.interpreters {
+		if err := atf.SetInterpreter(lang, exe); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid interpreter %q\n", lang)
+			return 1
+		}
+	}
+	return showConfig(r, fs, sources, *format)
+}
+
+/*
+ * showConfig - print the effective configuration and the source of every
+ * setting
+ */
+func showConfig(r *Runner, fs *flag.FlagSet, sources map[string]string,
+	format string) int {
+
+	type setting struct {
+		Key    string
+		Flag   string
+		Value  string
+		Source string
+	}
+	settings := make([]setting, 0, len(runnerSettings))
+	for _, s := range runnerSettings {
+		settings = append(settings, setting{s.key, "-" + s.flag,
+			fs.Lookup(s.flag).Value.String(), sources[s.flag]})
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]interface{}{"Config": r.configFile,
+			"Profile": r.profile, "Settings": settings,
+			"Interpreters": atf.Interpreters(), "Variables": r.variables})
+	case "text":
+		fmt.Printf("Config file: %s\n", orNone(r.configFile))
+		fmt.Printf("Profile:     %s\n\n", orNone(r.profile))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SETTING\tFLAG\tVALUE\tSOURCE")
+		for _, s := range settings {
+			fmt.Fprintf(w, "%s\t%s\t%q\t%s\n", s.Key, s.Flag, s.Value,
+				s.Source)
+		}
+		w.Flush()
+		fmt.Println("\nInterpreters:")
+		printMap(atf.Interpreters())
+		fmt.Println("\nVariables:")
+		printMap(r.variables)
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid output format %q\n", format)
+		return 1
+	}
+	return 0
+}
+
+/*
+ * printMap - print the map sorted by keys, one "key = value" per line
+ */
+func printMap(m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("  %s = %s\n", k, m[k])
+	}
+	if len(keys) == 0 {
+		fmt.Println("  none")
+	}
+}
+
+/*
+ * orNone - the value or "none", if empty
+ */
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
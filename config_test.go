@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testConfig = `{
+  "Workdir": "common",
+  "Syslog": "common:514",
+  "LogLevel": "info",
+  "LogFormat": "{message}",
+  "Variables": {"SUT_USER": "admin", "SUT": "10.1.0.1", "PORT": "22"},
+  "Profiles": {
+    "lab2": {
+      "Workdir": "profile",
+      "Syslog": "profile:514",
+      "LogLevel": "warning",
+      "Variables": {"SUT": "10.2.0.1", "PORT": "2222"}
+    }
+  }
+}`
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "goatf.json")
+	if err := os.WriteFile(filename, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOATF_WORKDIR", "env")
+	t.Setenv("GOATF_LOG_LEVEL", "error")
+	t.Setenv("GOATF_VAR_PORT", "8022")
+
+	r := NewRunner()
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	runFlags(r, fs)
+	err := fs.Parse([]string{"-config", filename, "-profile", "lab2",
+		"-log-level", "debug", "-var", "SUT_USER=tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources, err := applyConfig(fs, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct{ flag, value, source string }{
+		{"log-level", "debug", "flag"},
+		{"w", "env", "env GOATF_WORKDIR"},
+		{"s", "profile:514", "profile lab2"},
+		{"log-format", "{message}", "config"},
+		{"l", "", "default"},
+	}
+	for _, test := range tests {
+		if v := fs.Lookup(test.flag).Value.String(); v != test.value {
+			t.Errorf("%q: got %q, expected %q", test.flag, v, test.value)
+		}
+		if sources[test.flag] != test.source {
+			t.Errorf("%q: got source %q, expected %q", test.flag,
+				sources[test.flag], test.source)
+		}
+	}
+
+	vars := []struct{ name, value string }{
+		{"SUT_USER", "tester"}, // flag
+		{"PORT", "8022"},       // env
+		{"SUT", "10.2.0.1"},    // profile
+	}
+	for _, v := range vars {
+		if r.variables[v.name] != v.value {
+			t.Errorf("variable %q: got %q, expected %q", v.name,
+				r.variables[v.name], v.value)
+		}
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "goatf.json")
+	if err := os.WriteFile(config, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	unknown := filepath.Join(dir, "unknown.json")
+	if err := os.WriteFile(unknown, []byte(`{"Foo": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"unknown profile", []string{"-config", config, "-profile", "lab9"}},
+		{"unknown setting", []string{"-config", unknown}},
+		{"missing file", []string{"-config", filepath.Join(dir, "none")}},
+		{"yaml", []string{"-config", filepath.Join(dir, "goatf.yaml")}},
+	}
+	for _, test := range tests {
+		r := NewRunner()
+		fs := flag.NewFlagSet("run", flag.ContinueOnError)
+		runFlags(r, fs)
+		if err := fs.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := applyConfig(fs, r); err == nil {
+			t.Errorf("%q: no error", test.name)
+		}
+	}
+}
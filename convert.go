@@ -0,0 +1,85 @@
+/*
+ * convert.go - the 'convert' subcommand: convert the test set config between
+ * JSON and XML
+ *
+ * Usage: goatf convert [-f json|xml] [-o file] config
+ */
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"bitbucket.org/miranr/goatf/atf"
+	"bitbucket.org/miranr/goatf/atf/utils"
+)
+
+/*
+ * convertCmd - load the test set config and write it in the other format to
+ * STDOUT or to a file; the format is given explicitly or by the extension of
+ * the output file
+ */
+func convertCmd(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	format := fs.String("f", "",
+		"output format: json or xml (default: by output file extension, "+
+			"or the other format than the input)")
+	output := fs.String("o", "", "output filename (default: STDOUT)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: goatf convert [options] config")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+	ts, err := atf.LoadTestSet(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot read %q: %s\n", fs.Arg(0), err)
+		return 1
+	}
+
+	if *format == "" {
+		*format = strings.TrimPrefix(path.Ext(*output), ".")
+	}
+	if *format == "" {
+		*format = "xml"
+		if path.Ext(fs.Arg(0)) == ".xml" {
+			*format = "json"
+		}
+	}
+	var text string
+	switch *format {
+	case "json":
+		var b []byte
+		if b, err = json.MarshalIndent(ts, "", "  "); err == nil {
+			text = string(b) + "\n"
+		}
+	case "xml":
+		if text, err = ts.Xml(); err == nil {
+			text = fmt.Sprintf("<?xml version=%q encoding=%q?>\n%s\n",
+				"1.0", "UTF-8", text)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown output format %q\n", *format)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot convert %q: %s\n", fs.Arg(0), err)
+		return 1
+	}
+
+	if *output == "" {
+		fmt.Print(text)
+		return 0
+	}
+	if err = utils.WriteTextFileAtomic(*output, text); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
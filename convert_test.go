@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bitbucket.org/miranr/goatf/atf"
+	"bitbucket.org/miranr/goatf/atf/utils"
+)
+
+func TestConvertCmd(t *testing.T) {
+	dir := commandConfigs(t)
+	valid := filepath.Join(dir, "valid.json")
+	xml := filepath.Join(dir, "valid.xml")
+	json := filepath.Join(dir, "back.json")
+	tests := []struct {
+		args     []string
+		output   string // the file to check, if any
+		expected string // the start of the output
+	}{
+		// the format is given by the output file extension...
+		{[]string{"-o", xml, valid}, xml, "<?xml"},
+		// ...and back
+		{[]string{"-o", json, xml}, json, "{"},
+		// explicit format wins
+		{[]string{"-f", "json", "-o", xml, json}, xml, "{"},
+	}
+	for _, test := range tests {
+		if code := convertCmd(test.args); code != 0 {
+			t.Fatalf("%q: got exit status %d", test.args, code)
+		}
+		text, err := utils.ReadTextFile(test.output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(text, test.expected) {
+			t.Errorf("%q: got %q, expected %q...", test.args, text,
+				test.expected)
+		}
+	}
+
+	// the converted config is the same test set
+	ts, err := atf.LoadTestSet(json)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts.Name != "quick" || len(ts.Cases) != 1 ||
+		len(ts.Cases[0].Steps) != 1 ||
+		ts.Cases[0].Steps[0].Action.Script != "true" {
+		t.Errorf("converted test set: got %+v", ts)
+	}
+	if problems := ts.Validate(); len(problems) > 0 {
+		t.Errorf("converted test set: %q", problems)
+	}
+
+	failures := [][]string{
+		{},
+		{valid, json},
+		{"-f", "yaml", valid},
+		{filepath.Join(dir, "none.json")},
+		{"-o", filepath.Join(dir, "none", "out.xml"), valid},
+	}
+	for _, args := range failures {
+		if code := convertCmd(args); code == 0 {
+			t.Errorf("%q: no error", args)
+		}
+	}
+}
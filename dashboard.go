@@ -0,0 +1,102 @@
+/*
+ * dashboard.go - the web dashboard served by 'goatf serve'
+ *
+ * The dashboard is a single-page web UI for browsing the runs found under the
+ * working dirs root: the list of runs (filtered by test set, SUT name/version
+ * and status), the drill-down of a single run to the case/step/action output
+ * and the history charts of the test cases. The static assets are embedded
+ * into the binary, and the UI uses the following API:
+ *
+ *   GET /api/reports                  list the runs under the root; optional
+ *                                     filters: set, sut, version, status
+ *   GET /api/reports/{dir}            fetch the JSON report of the run
+ *   GET /api/history                  query the history store; optional
+ *                                     filters: set, case, sut, version
+ */
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"bitbucket.org/miranr/goatf/atf"
+)
+
+//go:embed web
+var webAssets embed.FS
+
+/*
+ * Server.handleDashboard - register the dashboard handlers
+ */
+func (s *Server) handleDashboard(mux *http.ServeMux) {
+	assets, err := fs.Sub(webAssets, "web")
+	if err != nil {
+		panic(err) // the assets are embedded, this cannot happen
+	}
+	// the assets are public: the login form is displayed by the UI
+	mux.Handle("GET /", http.FileServerFS(assets))
+	mux.HandleFunc("GET /api/reports",
+		s.authorize(atf.ViewPermission, s.listReports))
+	mux.HandleFunc("GET /api/reports/{dir...}",
+		s.authorize(atf.ViewPermission, s.getRunReport))
+	mux.HandleFunc("GET /api/history",
+		s.authorize(atf.ViewPermission, s.queryHistory))
+}
+
+/*
+ * Server.listReports - list the runs under the root, filtered by the query
+ */
+func (s *Server) listReports(w http.ResponseWriter, req *http.Request) {
+	summaries, err := atf.ListReports(s.root)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	q := req.URL.Query()
+	matches := func(filter, value string) bool {
+		return filter == "" || filter == value
+	}
+	result := make([]*atf.ReportSummary, 0, len(summaries))
+	for _, sum := range summaries {
+		if matches(q.Get("set"), sum.TestSet) &&
+			matches(q.Get("sut"), sum.SutName) &&
+			matches(q.Get("version"), sum.SutVersion) &&
+			matches(q.Get("status"), sum.Status) {
+			result = append(result, sum)
+		}
+	}
+	writeJson(w, http.StatusOK, result)
+}
+
+/*
+ * Server.getRunReport - return the JSON report of the run in the given dir
+ * (relative to the root)
+ */
+func (s *Server) getRunReport(w http.ResponseWriter, req *http.Request) {
+	// the dir must not escape from the root
+	dir := filepath.Clean("/" + req.PathValue("dir"))
+	b, err := os.ReadFile(filepath.Join(s.root, dir, "report.json"))
+	if err != nil {
+		httpError(w, http.StatusNotFound, "report not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+/*
+ * Server.queryHistory - query the history store
+ */
+func (s *Server) queryHistory(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	records, err := atf.OpenHistory(s.root).Query(&atf.HistoryQuery{
+		TestSet: q.Get("set"), Case: q.Get("case"), SutName: q.Get("sut"),
+		SutVersion: q.Get("version")})
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJson(w, http.StatusOK, records)
+}
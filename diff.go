@@ -0,0 +1,82 @@
+/*
+ * diff.go - the 'diff' subcommand: compare two saved JSON test reports
+ *
+ * Usage: goatf diff [-f text|json|html] [-o file] [-t tolerance] old new
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"bitbucket.org/miranr/goatf/atf"
+	"bitbucket.org/miranr/goatf/atf/utils"
+)
+
+/*
+ * diffCmd - load two test reports, compare them and write the differences in
+ * the requested format to STDOUT or to a file
+ */
+func diffCmd(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	format := fs.String("f", "text", "output format: text, json or html")
+	output := fs.String("o", "", "output filename (default: STDOUT)")
+	tolerance := fs.Float64("t", 0.2,
+		"allowed duration increase before reporting a regression (0.2 = 20%)")
+	cssfile := fs.String("c", "cfg/report_def.css",
+		"custom CSS file for HTML output")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: goatf diff [options] old.json new.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 1
+	}
+
+	oldtr, err := atf.LoadTestReport(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot load report %q: %s\n", fs.Arg(0), err)
+		return 1
+	}
+	newtr, err := atf.LoadTestReport(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot load report %q: %s\n", fs.Arg(1), err)
+		return 1
+	}
+	d := atf.DiffReports(oldtr, newtr, *tolerance)
+
+	// create the requested output; HTML output is written as a complete
+	// page, together with the CSS files
+	var text string
+	switch *format {
+	case "text":
+		text = d.String()
+	case "json":
+		text, err = d.Json()
+	case "html":
+		text, err = d.Html()
+		if err == nil && *output != "" {
+			err = writeHtmlPage(*output, "diff "+d.TestSet, text, *cssfile)
+			text = ""
+		} else if err == nil {
+			text = createHtmlHeader("diff "+d.TestSet, *cssfile) +
+				"<body>\n" + text + "</body>\n</html>\n"
+		}
+	default:
+		err = atf.ATFError_Unknown_Report_Type
+	}
+	if err == nil && text != "" {
+		if *output != "" {
+			err = utils.WriteTextFile(*output, text)
+		} else {
+			fmt.Println(text)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot create diff: %s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,75 @@
+/*
+ * flaky.go - the 'flaky' subcommand: list the flakiest test cases and steps
+ *
+ * Usage: goatf flaky [-root dir] [-version v] [-last N] [-n N] [-steps]
+ *                    [-f text|json]
+ */
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"bitbucket.org/miranr/goatf/atf"
+)
+
+/*
+ * flakyCmd - compute the flakiness from the history store and display the
+ * worst offenders
+ */
+func flakyCmd(args []string) int {
+	fs := flag.NewFlagSet("flaky", flag.ExitOnError)
+	root := fs.String("root", defaultRootDir(), "root of the working dirs")
+	version := fs.String("version", "", "consider only given SUT version")
+	last := fs.Int("last", 10, "number of the most recent runs considered")
+	top := fs.Int("n", 20, "number of worst offenders listed (0: all)")
+	steps := fs.Bool("steps", false, "list test steps, too")
+	format := fs.String("f", "text", "output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: goatf flaky [options]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	records, err := atf.OpenHistory(*root).Query(
+		&atf.HistoryQuery{SutVersion: *version})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot read history: %s\n", err)
+		return 1
+	}
+	scores := make([]*atf.Flakiness, 0)
+	for _, f := range atf.ComputeFlakiness(records, *version, *last) {
+		if f.Score == 0 || (f.Step != "" && !*steps) {
+			continue
+		}
+		scores = append(scores, f)
+		if *top > 0 && len(scores) == *top {
+			break
+		}
+	}
+
+	switch *format {
+	case "json":
+		b, err := json.MarshalIndent(scores, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(string(b))
+	case "text":
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "SCORE\tTEST SET\tVERSION\tCASE\tSTEP\tFLIPS/RUNS\tLAST")
+		for _, f := range scores {
+			fmt.Fprintf(w, "%.2f\t%s\t%s\t%s\t%s\t%d/%d\t%s\n", f.Score,
+				f.TestSet, f.SutVersion, f.Case, f.Step, f.Flips, f.Runs,
+				f.LastStatus)
+		}
+		w.Flush()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown output format %q\n", *format)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,127 @@
+/*
+ * history.go - the 'history' subcommand: query the results history store
+ *
+ * Usage: goatf history [-root dir] [-set name] [-sut name] [-version v]
+ *                      [-case name] [-since timestamp] [-runs] [-f text|json]
+ */
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+	"bitbucket.org/miranr/goatf/atf"
+)
+
+/*
+ * historyCmd - query the history store and display the per-case trends (or
+ * the list of runs)
+ */
+func historyCmd(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	root := fs.String("root", defaultRootDir(), "root of the working dirs")
+	q := new(atf.HistoryQuery)
+	fs.StringVar(&q.TestSet, "set", "", "test set name")
+	fs.StringVar(&q.SutName, "sut", "", "SUT name")
+	fs.StringVar(&q.SutVersion, "version", "", "SUT version")
+	fs.StringVar(&q.Case, "case", "", "test case name")
+	since := fs.String("since", "",
+		"only runs started since date or RFC 3339 timestamp (e.g. 2014-05-01)")
+	runs := fs.Bool("runs", false, "list the runs instead of case trends")
+	format := fs.String("f", "text", "output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: goatf history [options]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *since != "" {
+		var err error
+		if q.Since, err = parseSince(*since); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid timestamp %q\n", *since)
+			return 1
+		}
+	}
+
+	records, err := atf.OpenHistory(*root).Query(q)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot read history: %s\n", err)
+		return 1
+	}
+
+	var result interface{} = atf.CaseTrends(records)
+	if *runs {
+		result = records
+	}
+	switch *format {
+	case "json":
+		b, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(string(b))
+	case "text":
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		if *runs {
+			displayRuns(w, records)
+		} else {
+			displayTrends(w, atf.CaseTrends(records))
+		}
+		w.Flush()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown output format %q\n", *format)
+		return 1
+	}
+	return 0
+}
+
+/*
+ * displayRuns - display the list of runs as a table
+ */
+func displayRuns(w *tabwriter.Writer, records []*atf.HistoryRecord) {
+	fmt.Fprintln(w, "STARTED\tTEST SET\tSUT\tVERSION\tDURATION\tPASS\tFAIL")
+	for _, rec := range records {
+		pass, fail := 0, 0
+		for _, c := range rec.Cases {
+			switch c.Status {
+			case "Pass":
+				pass++
+			case "Fail":
+				fail++
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\n",
+			rec.Started.Format(time.RFC3339),
+			rec.TestSet, rec.SutName, rec.SutVersion, rec.Duration, pass, fail)
+	}
+}
+
+/*
+ * displayTrends - display the per-case trends as a table
+ */
+func displayTrends(w *tabwriter.Writer, trends []*atf.CaseTrend) {
+	fmt.Fprintln(w,
+		"TEST SET\tCASE\tRUNS\tPASS RATE\tLAST FAILURE\tAVG DURATION\tLAST DURATION")
+	for _, t := range trends {
+		last := "never"
+		if t.LastFailure != nil {
+			last = t.LastFailure.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.1f%%\t%s\t%s\t%s\n", t.TestSet, t.Case,
+			t.Runs, 100*t.PassRate(), last, t.AvgDuration(), t.LastDuration())
+	}
+}
+
+/*
+ * parseSince - parse the timestamp given either as RFC 3339 timestamp or as
+ * a date (in local time)
+ */
+func parseSince(stamp string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, stamp); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", stamp, time.Local)
+}
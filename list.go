@@ -0,0 +1,113 @@
+/*
+ * list.go - the 'list' subcommand: list the test cases and steps of the test
+ * set
+ *
+ * Usage: goatf list [-steps] [-f text|json] config
+ */
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"bitbucket.org/miranr/goatf/atf"
+)
+
+// Represents the listed test step.
+type listedStep struct {
+	Name     string
+	Expected atf.TestResult
+	Kind     string // "script", "manual" or "none"
+	Action   string // the script and its args, or the description
+}
+
+// Represents the listed test case.
+type listedCase struct {
+	Name     string
+	Expected atf.TestResult
+	Budget   string        `json:",omitempty"`
+	Steps    []*listedStep `json:",omitempty"`
+}
+
+/*
+ * listAction - the kind of the action and its short description
+ */
+func listAction(a *atf.Action) (string, string) {
+	switch {
+	case a == nil:
+		return "none", ""
+	case a.IsExecutable():
+		return "script", strings.TrimSpace(a.Script + " " + a.Args)
+	case a.IsManual():
+		return "manual", a.Description
+	}
+	return "none", ""
+}
+
+/*
+ * listCmd - load the test set config and list its cases (and steps)
+ */
+func listCmd(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	steps := fs.Bool("steps", false, "list test steps, too")
+	format := fs.String("f", "text", "output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: goatf list [options] config")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+	ts, err := atf.LoadTestSet(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot read %q: %s\n", fs.Arg(0), err)
+		return 1
+	}
+	ts.Initialize()
+
+	cases := make([]*listedCase, 0, len(ts.Cases))
+	for _, tc := range ts.Cases {
+		c := &listedCase{Name: tc.Name, Expected: tc.Expected,
+			Budget: tc.Budget}
+		if *steps {
+			c.Steps = make([]*listedStep, 0, len(tc.Steps))
+			for _, step := range tc.Steps {
+				kind, action := listAction(step.Action)
+				c.Steps = append(c.Steps, &listedStep{step.Name,
+					step.Expected, kind, action})
+			}
+		}
+		cases = append(cases, c)
+	}
+
+	switch *format {
+	case "json":
+		b, err := json.MarshalIndent(cases, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(string(b))
+	case "text":
+		fmt.Printf("Test set %q: %d test cases\n\n", ts.Name, len(cases))
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "CASE\tSTEP\tEXPECTED\tKIND\tACTION")
+		for _, c := range cases {
+			fmt.Fprintf(w, "%s\t\t%s\t\t\n", c.Name, c.Expected)
+			for _, s := range c.Steps {
+				fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\n", s.Name, s.Expected,
+					s.Kind, s.Action)
+			}
+		}
+		w.Flush()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown output format %q\n", *format)
+		return 1
+	}
+	return 0
+}
@@ -4,55 +4,311 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 //	"bitbucket.org/miranr/goatf/atf"
 //	"bitbucket.org/miranr/goatf/atf/utils"
 )
 
 /************************************************
- * parseArgs - parge command-line arguments
- */
-func parseArgs(r *Runner) {
-	flag.StringVar(&r.input, "i", "", "Input configuration path")
-	flag.StringVar(&r.workdir, "w", "", "Working directory path")
-	flag.StringVar(&r.logfile, "l", "", "Logfile name")
-	flag.StringVar(&r.syslog, "s", "", "Syslog server IP")
-	flag.StringVar(&r.report, "r", "", "final report filename")
-	flag.StringVar(&r.cssfile, "c", "cfg/report_def.css",
+ * runFlags - define the runner command-line arguments on the flag set
+ */
+func runFlags(r *Runner, fs *flag.FlagSet) {
+	fs.StringVar(&r.configFile, "config", "",
+		"runner configuration file, JSON only (default: "+
+			defaultConfigFile+", if it exists)")
+	fs.StringVar(&r.profile, "profile", "",
+		"named profile of the runner configuration file")
+	fs.Var((*variablesFlag)(&r.variables), "var",
+		"variable passed to the scripts' environment: name=value "+
+			"(can be repeated)")
+	fs.StringVar(&r.input, "i", "", "Input configuration path")
+	fs.StringVar(&r.workdir, "w", "", "Working directory path")
+	fs.StringVar(&r.rootdir, "root", defaultRootDir(),
+		"root of the working dirs with the history store and audit log")
+	fs.StringVar(&r.logfile, "l", "", "Logfile name")
+	fs.StringVar(&r.logFormat, "log-format", r.logFormat,
+		"format of the text logs; fields: {time} {severity} {source} "+
+			"{context} {set} {case} {step} {message}")
+	fs.StringVar(&r.logTime, "log-time-format", r.logTime,
+		"time layout of the text logs (Go reference time layout)")
+	fs.StringVar(&r.fileLevel, "log-level", "",
+		"level of the file logs: debug, info, notice, warning, error... "+
+			"(default info)")
+	fs.StringVar(&r.consoleLevel, "console-level", "",
+		"level of the console log (default notice)")
+	fs.StringVar(&r.syslogLevel, "syslog-level", "",
+		"level of the syslog messages (default notice)")
+	fs.StringVar(&r.jsonlog, "json-log", "",
+		"JSON log filename (one JSON object per line)")
+	fs.BoolVar(&r.caseLogs, "case-logs", false,
+		"write a separate log file for every test case")
+	fs.StringVar(&r.logMaxSize, "log-max-size", "",
+		"rotate the log files over this size, e.g. 10M (default: never)")
+	fs.DurationVar(&r.logMaxAge, "log-max-age", 0,
+		"rotate the log files older than this, e.g. 24h (default: never)")
+	fs.IntVar(&r.logMaxBackups, "log-max-backups", 0,
+		"number of rotated log files to keep (0: all)")
+	fs.BoolVar(&r.logCompress, "log-compress", false,
+		"gzip the rotated log files")
+	fs.BoolVar(&r.logAppend, "log-append", false,
+		"append to the existing log files instead of truncating them")
+	fs.IntVar(&r.logBuffer, "log-buffer", r.logBuffer,
+		"size of the log handler buffers (messages)")
+	fs.StringVar(&r.logOverflow, "log-overflow", r.logOverflow,
+		"when the log buffer is full: block or drop-oldest")
+	fs.StringVar(&r.syslog, "s", "", "Syslog server host[:port]")
+	fs.StringVar(&r.syslogProto, "syslog-proto", "udp",
+		"syslog transport: udp, tcp or tls")
+	fs.StringVar(&r.syslogFormat, "syslog-format", "5424",
+		"syslog message format: 5424 or 3164 (BSD)")
+	fs.StringVar(&r.syslogCA, "syslog-ca", "",
+		"CA certificate(s) file to verify the syslog server over TLS")
+	fs.StringVar(&r.sutlog, "sutlog", "",
+		"receive the SUT syslog messages on [host]:port during the run")
+	fs.StringVar(&r.sutlogProto, "sutlog-proto", "udp",
+		"SUT syslog transport: udp, tcp or both")
+	fs.StringVar(&r.report, "r", "", "final report filename")
+	fs.StringVar(&r.cssfile, "c", "cfg/report_def.css",
 		"custom CSS file for HTML report")
-	flag.BoolVar(&r.xml, "X", false, "create XML report (beside HTML report)")
-	flag.BoolVar(&r.json, "J", false, "create JSON report (beside HTML report)")
-	flag.BoolVar(&r.debug, "d", false,
+	fs.StringVar(&r.rerun, "rerun-failed", "",
+		"previous JSON report; execute only the cases that failed there")
+	fs.StringVar(&r.resume, "resume", "",
+		"working directory of the interrupted run to resume")
+	fs.BoolVar(&r.incremental, "incremental", true,
+		"update reports after every finished test case")
+	fs.BoolVar(&r.abortCleanup, "abort-cleanup", true,
+		"execute cleanup actions when the execution is aborted")
+	fs.BoolVar(&r.progress, "progress", false,
+		"display the live progress instead of the console log")
+	fs.BoolVar(&r.history, "history", true,
+		"record the results into history store in the working dirs root")
+	fs.IntVar(&r.flakyRuns, "flaky-runs", 10,
+		"number of previous runs used to compute flakiness (0: disabled)")
+	fs.Float64Var(&r.quarantine, "quarantine", 0,
+		"quarantine cases with flakiness above threshold (0..1, 0: never)")
+	fs.BoolVar(&r.xml, "X", false, "create XML report (beside HTML report)")
+	fs.BoolVar(&r.json, "J", false, "create JSON report (beside HTML report)")
+	fs.BoolVar(&r.text, "T", false,
+		"create plain text report (beside HTML report)")
+	fs.BoolVar(&r.par, "parallel", false,
+		"run the test cases in parallel (not supported yet)")
+	fs.BoolVar(&r.debug, "d", false,
 		"enable debug mode (for testing purposes)")
-	//
-	flag.Parse()
 }
 
 /*
- * main -
+ * command - a GoATF subcommand: its name, a short description (displayed by
+ * 'goatf help') and the implementation; the subcommands of the command (if
+ * any) are listed for the shell completion
  */
-func main() {
-//	    atf.RunBats() // for testing purposes : test/bats.go
+type command struct {
+	name  string
+	descr string
+	subs  []string
+	run   func(args []string) int
+}
+
+/*
+ * commands - the GoATF subcommands; defined in init(), since 'help' and
+ * 'completion' refer to them
+ */
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"run", "execute the test set", nil, runCmd},
+		{"validate", "check the test set configs without executing them",
+			nil, validateCmd},
+		{"list", "list the test cases and steps of the test set", nil,
+			listCmd},
+		{"report", "regenerate the reports from a saved test report", nil,
+			reportCmd},
+		{"convert", "convert the test set config between JSON and XML", nil,
+			convertCmd},
+		{"merge", "merge the saved test reports", nil, mergeCmd},
+		{"diff", "compare two saved test reports", nil, diffCmd},
+		{"verdict", "sign off a manual test step", nil, verdictCmd},
+		{"history", "display the results of the previous runs", nil,
+			historyCmd},
+		{"flaky", "list the flaky test cases", nil, flakyCmd},
+		{"audit", "list or verify the audit log",
+			[]string{"list", "verify"}, auditCmd},
+		{"serve", "start the HTTP server (REST API and dashboard)", nil,
+			serveCmd},
+		{"user", "manage the server users",
+			[]string{"add", "list", "passwd", "delete"}, userCmd},
+		{"token", "manage the API tokens",
+			[]string{"create", "list", "revoke"}, tokenCmd},
+		{"config", "display the runner configuration", []string{"show"},
+			configCmd},
+		{"completion", "print the bash or zsh completion script",
+			[]string{"bash", "zsh"}, completionCmd},
+		{"help", "display the help of the command", nil, helpCmd},
+	}
+}
+
+/*
+ * findCommand - find the subcommand by name; nil if not found
+ */
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+/*
+ * usage - display the list of the subcommands
+ */
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: goatf <command> [options] [arguments]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s%s\n", c.name, c.descr)
+	}
+	fmt.Fprintln(os.Stderr,
+		"\nUse 'goatf help <command>' for the options of the command.")
+	fmt.Fprintln(os.Stderr,
+		"Without the command, the options are passed to 'goatf run'.")
+}
+
+/*
+ * helpCmd - the 'help' subcommand: display the description of the command
+ * and its options
+ */
+func helpCmd(args []string) int {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		usage()
+		return 0
+	}
+	c := findCommand(args[0])
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", args[0])
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "goatf %s - %s\n\n", c.name, c.descr)
+	if c.name == "help" {
+		fmt.Fprintln(os.Stderr, "Usage: goatf help [command [subcommand]]")
+		return 0
+	}
+	// the commands display their own usage; the commands with subcommands
+	// display the usage of the subcommand, if given
+	c.run(append(args[1:], "-h"))
+	return 0
+}
+
+// The exit status of the runner when the execution has been aborted by a
+// signal.
+const ExitAborted = 130
+
+/*
+ * handleSignals - the first SIGINT/SIGTERM aborts the execution gracefully:
+ * the running scripts are killed, cleanup actions are executed and the report
+ * is written; the second signal forces the immediate exit
+ */
+func handleSignals(r *Runner, cancel context.CancelFunc) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		r.logger.Warning(fmt.Sprintf(
+			"Signal %q received: aborting the execution...\n", sig))
+		r.logger.Warning("Send the signal again to exit immediately.\n")
+		cancel()
+		sig = <-sigs
+		r.logger.Error(fmt.Sprintf("Signal %q received: exiting NOW.\n", sig))
+		r.logger.Close()
+		os.Exit(ExitAborted)
+	}()
+}
+
+/*
+ * runCmd - the 'run' subcommand: execute the test set
+ */
+func runCmd(args []string) int {
 	r := NewRunner()
-	// parse CLI arguments
-	parseArgs(r)
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	runFlags(r, fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: goatf run [options] [config]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	// the config can be given as an argument, too
+	if fs.NArg() > 1 || (fs.NArg() == 1 && r.input != "") {
+		fs.Usage()
+		return 1
+	}
+	if fs.NArg() == 1 {
+		fs.Set("i", fs.Arg(0))
+	}
+	// the settings not given on the command line are taken from the
+	// environment and the configuration file
+	if _, err := applyConfig(fs, r); err != nil {
+		fmt.Println(err)
+		fmt.Println("Exiting...")
+		return 1
+	}
 	// initialize new Runner; if initializaton fails, exit gracefully 
 	err := r.initialize()
 	if err != nil {
 		fmt.Println(err)
 		fmt.Println("Please define the input configuration file")
-		fmt.Println("Use '-h' switch to display help")
+		fmt.Println("Use 'goatf help run' to display help")
 		fmt.Println("Exiting...")
-		os.Exit(1)
+		return 1
 	}
 //	r.display(true) // DEBUG
-	// now, run the damn thing....
-	r.Run()
+	// now, run the damn thing....; signals abort the execution
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handleSignals(r, cancel)
+	r.Run(ctx)
 	//
 	//r.display(true) // DEBUG
 	r.CreateReports()
 	// close the logger
 	r.logger.Close()
+	return r.ExitCode()
+}
+
+/*
+ * dispatch - run the subcommand given by the command line arguments and
+ * return the exit status
+ */
+func dispatch(args []string) int {
+	switch {
+	case len(args) == 0:
+		usage()
+		return 1
+	case args[0] == "-h" || args[0] == "-help" || args[0] == "--help":
+		usage()
+		return 0
+	case strings.HasPrefix(args[0], "-"):
+		// the runner options without the command, as it used to be
+		return runCmd(args)
+	}
+	c := findCommand(args[0])
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+		usage()
+		return 1
+	}
+	return c.run(args[1:])
+}
+
+/*
+ * main -
+ */
+func main() {
+//	    atf.RunBats() // for testing purposes : test/bats.go
+	os.Exit(dispatch(os.Args[1:]))
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The valid test set config that passes at once.
+const quickConfig = `{"Name": "quick", "Cases": [{"Name": "a",
+"Expected": "Pass", "Steps": [{"Name": "step", "Expected": "Pass",
+"Action": {"Script": "true"}}]}]}`
+
+// Writes the test set configs used by the command tests into a new
+// directory: "valid.json" and "invalid.json". Returns the directory.
+func commandConfigs(t *testing.T) string {
+	dir := t.TempDir()
+	configs := []struct{ name, text string }{
+		{"valid.json", quickConfig},
+		{"invalid.json", `{"Name": "bad", "Cases": [{"Name": "a",
+"Expected": "Maybe", "Steps": []}]}`},
+	}
+	for _, c := range configs {
+		err := os.WriteFile(filepath.Join(dir, c.name), []byte(c.text), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestDispatch(t *testing.T) {
+	dir := commandConfigs(t)
+	valid := filepath.Join(dir, "valid.json")
+	invalid := filepath.Join(dir, "invalid.json")
+	tests := []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{}, 1},
+		{[]string{"-h"}, 0},
+		{[]string{"--help"}, 0},
+		{[]string{"nope"}, 1},
+		{[]string{"help"}, 0},
+		{[]string{"help", "help"}, 0},
+		{[]string{"help", "nope"}, 1},
+		{[]string{"validate"}, 1},
+		{[]string{"validate", "-q", valid}, 0},
+		{[]string{"validate", invalid}, 1},
+		{[]string{"validate", valid, invalid}, 1},
+		{[]string{"validate", filepath.Join(dir, "none.json")}, 1},
+		{[]string{"completion"}, 1},
+		{[]string{"completion", "fish"}, 1},
+		{[]string{"completion", "bash"}, 0},
+	}
+	for _, test := range tests {
+		if code := dispatch(test.args); code != test.expected {
+			t.Errorf("%q: got exit status %d, expected %d", test.args,
+				code, test.expected)
+		}
+	}
+}
+
+// Every command and its subcommands are completed by both shells.
+func TestCompletion(t *testing.T) {
+	scripts := map[string]string{"bash": bashCompletion(),
+		"zsh": zshCompletion()}
+	for shell, script := range scripts {
+		for _, c := range commands {
+			if !strings.Contains(script, c.name) {
+				t.Errorf("%s: command %q not completed", shell, c.name)
+			}
+			if len(c.subs) == 0 {
+				continue
+			}
+			subs := c.name + ") subs=\"" + strings.Join(c.subs, " ") + "\""
+			if !strings.Contains(script, subs) {
+				t.Errorf("%s: subcommands of %q not completed", shell,
+					c.name)
+			}
+		}
+	}
+}
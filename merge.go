@@ -0,0 +1,84 @@
+/*
+ * merge.go - the 'merge' subcommand: merge several saved JSON test reports
+ * into a consolidated one
+ *
+ * Usage: goatf merge [-p latest|worst|rerun] [-w dir] [-root dir] report.json...
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"bitbucket.org/miranr/goatf/atf"
+)
+
+/*
+ * mergeCmd - load the test reports, merge them and create all the supported
+ * reports from the merged result
+ */
+func mergeCmd(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	policy := fs.String("p", "latest", fmt.Sprintf("merge policy: %s",
+		strings.Join(atf.ValidMergePolicies, ", ")))
+	workdir := fs.String("w", ".", "output directory for merged reports")
+	root := fs.String("root", defaultRootDir(),
+		"root of the working dirs with the audit log")
+	cssfile := fs.String("c", "cfg/report_def.css",
+		"custom CSS file for HTML report")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			"Usage: goatf merge [options] report.json [report.json...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 1
+	}
+	p, err := atf.MergePolicyFromString(*policy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid merge policy %q\n", *policy)
+		return 1
+	}
+
+	reports := make([]*atf.TestReport, 0, fs.NArg())
+	for _, name := range fs.Args() {
+		tr, err := atf.LoadTestReport(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot load report %q: %s\n", name, err)
+			return 1
+		}
+		reports = append(reports, tr)
+	}
+	merged, err := atf.MergeReports(p, reports...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot merge reports: %s\n", err)
+		return 1
+	}
+
+	// we reuse the runner to create all the reports
+	r := NewRunner()
+	r.tr = merged
+	r.workdir = *workdir
+	r.rootdir = *root
+	r.cssfile = *cssfile
+	r.xml = true
+	r.json = true
+	r.initiator = osUsername()
+	r.auditAction = atf.AuditMerged
+	r.auditDetails = map[string]string{"Policy": *policy,
+		"Reports": strings.Join(fs.Args(), " ")}
+	if err = os.MkdirAll(r.workdir, 0755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err = r.createConsoleLog(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer r.logger.Close()
+	r.CreateReports()
+	return 0
+}
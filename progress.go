@@ -0,0 +1,331 @@
+/*
+ * progress.go - the live console progress display of the runner
+ *
+ * The progress display is a subscriber to the execution events. When STDOUT
+ * is a terminal, a single status line is redrawn in place: the current test
+ * case and step, elapsed time, pass/fail/skip counters and the estimated time
+ * to finish (computed from the durations of the previous runs recorded in the
+ * history store). When STDOUT is not a terminal, a plain line is printed for
+ * every finished test case instead. At the end, a summary table is displayed
+ * (colourised on terminal).
+ */
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"bitbucket.org/miranr/goatf/atf"
+)
+
+// ANSI escape sequences used by the progress display
+const (
+	ansiReset     = "\033[0m"
+	ansiBold      = "\033[1m"
+	ansiRed       = "\033[31m"
+	ansiGreen     = "\033[32m"
+	ansiYellow    = "\033[33m"
+	ansiClearLine = "\r\033[K"
+)
+
+// How often the status line is redrawn (so the elapsed time keeps ticking).
+const progressTick = time.Second
+
+/*
+ * isTerminal - report whether the file is a terminal (character device)
+ */
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+/*
+ * terminalWidth - return the width of the terminal; the COLUMNS environment
+ * variable is used, if defined, otherwise 80 columns are assumed
+ */
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
+
+/*
+ * Progress - the live progress display
+ */
+type Progress struct {
+	out io.Writer
+	tty bool // redraw the status line in place and use colours
+
+	// the expected durations of the test cases (by name), from history
+	estimates map[string]time.Duration
+
+	set     *atf.TestSet
+	total   int
+	cases   []*atf.TestCase // finished (or skipped) test cases
+	passed  int
+	failed  int
+	skipped int
+
+	started     time.Time
+	current     *atf.TestCase
+	caseStarted time.Time
+	step        string
+
+	mutex sync.Mutex
+	stop  chan bool
+}
+
+/*
+ * NewProgress - create a new progress display writing to given file; the
+ * estimates are the expected durations of the test cases (may be nil)
+ */
+func NewProgress(f *os.File, estimates map[string]time.Duration) *Progress {
+	if estimates == nil {
+		estimates = make(map[string]time.Duration)
+	}
+	return &Progress{out: f, tty: isTerminal(f), estimates: estimates,
+		cases: make([]*atf.TestCase, 0)}
+}
+
+/*
+ * Progress.HandleEvent - update the display; implements the atf.Subscriber
+ * interface
+ */
+func (p *Progress) HandleEvent(e atf.Event) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	switch ev := e.(type) {
+	case *atf.SetStarted:
+		p.set = ev.Set
+		p.total = len(ev.Set.Cases)
+		p.started = ev.When()
+		if p.tty {
+			p.stop = make(chan bool)
+			go p.tick(p.stop)
+		}
+	case *atf.CaseStarted:
+		p.current = ev.Case
+		p.caseStarted = ev.When()
+		p.step = ""
+	case *atf.StepStarted:
+		p.step = ev.Step.Name
+	case *atf.CaseFinished:
+		p.current = nil
+		p.count(ev.Case, ev.Result)
+		p.caseLine(ev.Case, ev.Result, ev.Duration)
+	case *atf.CaseSkipped:
+		status := ev.Case.Status
+		if ev.Reason == "aborted" {
+			status = "NotTested"
+		}
+		p.count(ev.Case, status)
+		p.caseLine(ev.Case, status, ev.Case.Duration)
+	case *atf.SetFinished:
+		if p.stop != nil {
+			close(p.stop)
+			p.stop = nil
+		}
+		if p.tty {
+			fmt.Fprint(p.out, ansiClearLine)
+		}
+		p.summary(ev.Duration, ev.Aborted)
+		return
+	}
+	if p.tty {
+		p.draw()
+	}
+}
+
+/*
+ * Progress.tick - redraw the status line periodically until stopped
+ */
+func (p *Progress) tick(stop chan bool) {
+	t := time.NewTicker(progressTick)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			p.mutex.Lock()
+			p.draw()
+			p.mutex.Unlock()
+		}
+	}
+}
+
+/*
+ * Progress.count - count the finished test case
+ */
+func (p *Progress) count(tc *atf.TestCase, status atf.TestResult) {
+	p.cases = append(p.cases, tc)
+	switch status {
+	case "Pass", "XFail":
+		p.passed++
+	case "Fail":
+		p.failed++
+	default:
+		p.skipped++
+	}
+}
+
+/*
+ * Progress.caseLine - print a line for the finished test case; on terminal
+ * only the failures are printed (above the status line)
+ */
+func (p *Progress) caseLine(tc *atf.TestCase, status atf.TestResult,
+	d time.Duration) {
+
+	if p.tty {
+		if status == "Fail" {
+			fmt.Fprintf(p.out, "%s%s %s (%s)\n", ansiClearLine,
+				p.colour(status), tc.Name, d.Round(time.Millisecond))
+		}
+		return
+	}
+	fmt.Fprintf(p.out, "[%*d/%d] %-9s %s (%s)\n", len(strconv.Itoa(p.total)),
+		len(p.cases), p.total, status, tc.Name, d.Round(time.Millisecond))
+}
+
+/*
+ * Progress.eta - estimate the remaining time of the execution; returns false
+ * when it cannot be estimated (yet)
+ */
+func (p *Progress) eta(now time.Time) (time.Duration, bool) {
+	if p.set == nil {
+		return 0, false
+	}
+	// the average duration of the cases finished so far is used for the cases
+	// that have no history
+	finished := make(map[*atf.TestCase]bool)
+	var sum time.Duration
+	for _, tc := range p.cases {
+		finished[tc] = true
+		sum += tc.Duration
+	}
+	var remaining time.Duration
+	for _, tc := range p.set.Cases {
+		if finished[tc] {
+			continue
+		}
+		d, found := p.estimates[tc.Name]
+		if !found {
+			if len(p.cases) == 0 {
+				return 0, false
+			}
+			d = sum / time.Duration(len(p.cases))
+		}
+		if tc == p.current {
+			if d -= now.Sub(p.caseStarted); d < 0 {
+				d = 0
+			}
+		}
+		remaining += d
+	}
+	return remaining, true
+}
+
+/*
+ * Progress.draw - redraw the status line
+ */
+func (p *Progress) draw() {
+	if p.started.IsZero() {
+		return
+	}
+	now := time.Now()
+	eta := "--:--"
+	if d, ok := p.eta(now); ok {
+		eta = fmtClock(d)
+	}
+	line := fmt.Sprintf("[%d/%d] %s ETA %s | pass %d fail %d skip %d",
+		len(p.cases), p.total, fmtClock(now.Sub(p.started)), eta,
+		p.passed, p.failed, p.skipped)
+	if p.current != nil {
+		line += " | " + p.current.Name
+		if p.step != "" {
+			line += " > " + p.step
+		}
+	}
+	if w := terminalWidth() - 1; len(line) > w {
+		line = line[:w]
+	}
+	fmt.Fprint(p.out, ansiClearLine+line)
+}
+
+/*
+ * Progress.summary - display the final summary table
+ */
+func (p *Progress) summary(d time.Duration, aborted bool) {
+	width := len("Test case")
+	for _, tc := range p.cases {
+		if len(tc.Name) > width {
+			width = len(tc.Name)
+		}
+	}
+	rule := strings.Repeat("-", width+27) + "\n"
+	fmt.Fprintln(p.out)
+	fmt.Fprintln(p.out, p.bold(fmt.Sprintf("%-*s  %-9s  %12s", width,
+		"Test case", "Status", "Duration")))
+	fmt.Fprint(p.out, rule)
+	for _, tc := range p.cases {
+		fmt.Fprintf(p.out, "%-*s  %s  %12s\n", width, tc.Name,
+			p.colour(tc.Status), tc.Duration.Round(time.Millisecond))
+	}
+	fmt.Fprint(p.out, rule)
+	total := fmt.Sprintf("%d cases: %d passed, %d failed, %d skipped in %s",
+		p.total, p.passed, p.failed, p.skipped, d.Round(time.Millisecond))
+	if aborted {
+		total += " (ABORTED)"
+	}
+	fmt.Fprintln(p.out, p.bold(total))
+}
+
+/*
+ * Progress.colour - return the test result padded (and coloured on terminal)
+ */
+func (p *Progress) colour(status atf.TestResult) string {
+	s := fmt.Sprintf("%-9s", status)
+	if !p.tty {
+		return s
+	}
+	switch status {
+	case "Pass", "XFail":
+		return ansiGreen + s + ansiReset
+	case "Fail":
+		return ansiRed + s + ansiReset
+	}
+	return ansiYellow + s + ansiReset
+}
+
+/*
+ * Progress.bold - return the text in bold (on terminal)
+ */
+func (p *Progress) bold(s string) string {
+	if !p.tty {
+		return s
+	}
+	return ansiBold + s + ansiReset
+}
+
+/*
+ * fmtClock - format the duration as a clock: mm:ss or h:mm:ss
+ */
+func fmtClock(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := int(d / time.Hour)
+	m := int(d % time.Hour / time.Minute)
+	s := int(d % time.Minute / time.Second)
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%02d:%02d", m, s)
+}
@@ -0,0 +1,74 @@
+/*
+ * report.go - the 'report' subcommand: regenerate the reports from a saved
+ * test report
+ *
+ * Usage: goatf report [-w dir] [-root dir] [-c css] [-X] [-J] [-T] report.json
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"bitbucket.org/miranr/goatf/atf"
+)
+
+/*
+ * reportCmd - load the saved test report and create the requested reports
+ * from it (e.g. after the CSS or the report templates have been changed)
+ */
+func reportCmd(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	workdir := fs.String("w", "",
+		"output directory (default: the directory of the saved report)")
+	root := fs.String("root", defaultRootDir(),
+		"root of the working dirs with the audit log")
+	cssfile := fs.String("c", "cfg/report_def.css",
+		"custom CSS file for HTML report")
+	xml := fs.Bool("X", false, "create XML report (beside HTML report)")
+	json := fs.Bool("J", false, "create JSON report (beside HTML report)")
+	text := fs.Bool("T", false,
+		"create plain text report (beside HTML report)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: goatf report [options] report.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+	tr, err := atf.LoadTestReport(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot load report %q: %s\n", fs.Arg(0), err)
+		return 1
+	}
+
+	// we reuse the runner to create the reports
+	r := NewRunner()
+	r.tr = tr
+	r.workdir = *workdir
+	if r.workdir == "" {
+		r.workdir = filepath.ToSlash(filepath.Dir(fs.Arg(0)))
+	}
+	r.rootdir = *root
+	r.cssfile = *cssfile
+	r.xml = *xml
+	r.json = *json
+	r.text = *text
+	r.initiator = osUsername()
+	r.auditAction = atf.AuditRegenerated
+	r.auditDetails = map[string]string{"Report": fs.Arg(0)}
+	if err = os.MkdirAll(r.workdir, 0755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err = r.createConsoleLog(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer r.logger.Close()
+	r.CreateReports()
+	return 0
+}
@@ -5,12 +5,17 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"os"
+	"os/user"
 	"path"
 	"path/filepath"
 	"runtime"
+	"time"
 	"bitbucket.org/miranr/goatf/atf"
 	"bitbucket.org/miranr/goatf/atf/utils"
 )
@@ -22,15 +27,57 @@ type Runner struct {
 	tr      *atf.TestReport // TestSet that's be run
 	input   string          // input configuration file (currently only JSON)
 	workdir string          // working directory
+	rootdir string          // root of the working directories
+	history bool            // record the results into the history store
+	flakyRuns  int          // number of previous runs to compute flakiness
+	quarantine float64      // flakiness threshold for quarantine (0: none)
 	logfile string
-	syslog  string
+	logFormat string   // the format (template) of the text logs
+	logTime string     // the time layout of the text logs
+	fileLevel string   // the level of the file logs (empty: default)
+	consoleLevel string // the level of the console log (empty: default)
+	syslogLevel string // the level of the syslog (empty: default)
+	jsonlog string     // JSON log file name (empty: none)
+	caseLogs bool      // create the per-case log files
+	logMaxSize string  // rotate the log files over this size (e.g. "10M")
+	logMaxAge time.Duration // rotate the log files older than this
+	logMaxBackups int  // keep this many rotated log files (0: all)
+	logCompress bool   // gzip the rotated log files
+	logAppend bool     // append to the existing log files
+	logBuffer int      // the size of the log handler buffers (messages)
+	logOverflow string // what to do when the buffer is full: block or drop
+	syslog  string     // syslog server: host[:port]
+	syslogProto string // syslog transport: udp, tcp or tls
+	syslogFormat string // syslog message format: 5424 or 3164
+	syslogCA string    // CA certificate(s) file for syslog over TLS
+	sutlog  string     // listen for the SUT syslog messages: [host]:port
+	sutlogProto string // SUT syslog transport: udp, tcp or both
 	report  string
 	cssfile string
+	rerun   string     // previous JSON report: rerun only its failed cases
+	prev    *atf.TestReport // previous report, loaded when rerunning
+	resume  string     // working directory of the interrupted run to resume
+	state   *atf.JournalState // execution state loaded from the journal
+	journal *atf.Journal // journal of the execution progress
+	incremental bool   // update reports after every finished test case
+	abortCleanup bool  // execute cleanup actions when execution is aborted
+	progress bool      // display the live progress instead of console log
+	quiet   bool       // do not log to console (e.g. when run by server)
+	events  *atf.EventBus  // the execution events are published here
+	initiator string   // the user that initiated the run (default: OS user)
+	auditAction string // the action recorded when the reports are created
+	auditDetails map[string]string // and its additional details
 	xml     bool       // create XML report (beside HTML report)
 	json    bool       // create JSON report (beside HTML report)
+	text    bool       // create plain text report (beside HTML report)
     par     bool       // run tests in parallel? (default: false) TODO
+	configFile string  // runner configuration file (see config.go)
+	profile string     // the selected profile of the configuration file
+	variables map[string]string // passed to the scripts' environment
+	interpreters map[string]string // script interpreters (by language)
 	debug   bool       // enable debug mode (for testing purposes only)
 	logger  *utils.Log // a logger instance (
+	logctx  utils.LogContext // what's being executed (see logEvent())
 }
 
 /*
@@ -40,7 +87,18 @@ type Runner struct {
 func NewRunner() *Runner {
 	var r = new(Runner)
 	r.logger = utils.NewLog()
+	// the execution progress is published as events; the logger is always
+	// subscribed
+	r.events = atf.NewEventBus()
+	r.events.Subscribe(atf.SubscriberFunc(r.logEvent))
+	r.auditAction = atf.AuditRunFinished
+	r.logFormat = utils.DefaultLogFormat
+	r.logTime = utils.DefaultTimeLayout
+	r.logBuffer = utils.DefaultBufferSize
+	r.logOverflow = utils.OverflowBlock.String()
     r.par = false // run sequentially by default
+	r.variables = make(map[string]string)
+	r.interpreters = make(map[string]string)
 	return r
 }
 
@@ -52,12 +110,35 @@ func NewRunner() *Runner {
 func (r *Runner) display(complete bool) {
 	fmt.Printf("Input config file: %q\n", r.input)
 	fmt.Printf("Working dir: %q\n", r.workdir)
+	fmt.Printf("Working dirs root: %q\n", r.rootdir)
+	fmt.Printf("Record history? %t\n", r.history)
+	fmt.Printf("Flakiness computed from last %d runs\n", r.flakyRuns)
+	fmt.Printf("Quarantine threshold: %.2f\n", r.quarantine)
 	fmt.Printf("Log filename: %q\n", r.logfile)
-	fmt.Printf("Syslog server IP: %q\n", r.syslog)
+	fmt.Printf("Log format: %q, time layout: %q\n", r.logFormat, r.logTime)
+	fmt.Printf("Log levels: file=%q console=%q syslog=%q\n", r.fileLevel,
+		r.consoleLevel, r.syslogLevel)
+	fmt.Printf("JSON log filename: %q\n", r.jsonlog)
+	fmt.Printf("Per-case log files? %t\n", r.caseLogs)
+	fmt.Printf("Log rotation: size=%q age=%s backups=%d gzip=%t append=%t\n",
+		r.logMaxSize, r.logMaxAge, r.logMaxBackups, r.logCompress,
+		r.logAppend)
+	fmt.Printf("Log buffer: %d messages, overflow: %s\n", r.logBuffer,
+		r.logOverflow)
+	fmt.Printf("Syslog server: %q (%s, RFC %s)\n", r.syslog, r.syslogProto,
+		r.syslogFormat)
+	fmt.Printf("SUT syslog receiver: %q (%s)\n", r.sutlog, r.sutlogProto)
 	fmt.Printf("Final report name: %q\n", r.report)
+	fmt.Printf("Rerun failed cases from: %q\n", r.rerun)
+	fmt.Printf("Resume the run in: %q\n", r.resume)
 	fmt.Printf("(Optional) CCS file for HTML report: %q\n", r.cssfile)
 	fmt.Printf("Debug node enabled? %t\n", r.debug)
 	fmt.Printf("Parallel execution? %t\n", r.par)
+	fmt.Printf("Configuration file: %q, profile: %q\n", r.configFile,
+		r.profile)
+	fmt.Printf("Variables: %v\n", r.variables)
+	fmt.Printf("Interpreters: %v\n", r.interpreters)
+	fmt.Printf("Incremental reports? %t\n", r.incremental)
 
 	// display loggers
 	fmt.Printf("Loggers:\n")
@@ -80,24 +161,38 @@ func (r *Runner) display(complete bool) {
 /*
  * Runner.setWorkDir - set the working directory
  * Join both of the input parameters into proper system PATH.
- * If both input parameters are empty strings, create the default value; this
+ * If both input parameters are empty strings, create the default value under
+ * the root of the working dirs (when defined) or under the default root; this
  * is OS dependant: on WinXY the default is bound to USERPROFILE environment
  * variable, while on POSIX systems, the default is bound to HOME envronment
  * variable.
  */
 func (r *Runner) setWorkDir(basedir string, tsName string) {
 	if basedir == "" {
-		if runtime.GOOS == "windows" {
-			basedir = os.Getenv("USERPROFILE")
-		} else {
-			basedir = os.Getenv("HOME")
+		root := r.rootdir
+		if root == "" {
+			root = defaultRootDir()
 		}
-		basedir = path.Join(basedir, "goatf",
+		basedir = path.Join(root,
 			fmt.Sprintf("%s_%s", tsName, utils.NowFile()))
 	}
 	r.workdir = filepath.ToSlash(basedir)
 }
 
+/*
+ * defaultRootDir - return the default root of the working directories
+ * This is OS dependant: on WinXY the default is bound to USERPROFILE
+ * environment variable, while on POSIX systems, the default is bound to HOME
+ * environment variable.
+ */
+func defaultRootDir() string {
+	basedir := os.Getenv("HOME")
+	if runtime.GOOS == "windows" {
+		basedir = os.Getenv("USERPROFILE")
+	}
+	return filepath.ToSlash(path.Join(basedir, "goatf"))
+}
+
 /*
  * Runner.collect - collect the configuration that'll be executed
  * Parse the configuration file and create/update the appropriate data 
@@ -105,22 +200,65 @@ func (r *Runner) setWorkDir(basedir string, tsName string) {
  */
 func (r *Runner) collect() (err error) {
 
-	var ts *atf.TestSet = new(atf.TestSet)
-    //ts.Sut = new(atf.SysUnderTest)
+	var ts *atf.TestSet
 
 	if r.input != "" {
-		ts = atf.Collect(r.input)
+		ts, err = atf.LoadTestSet(r.input)
 	} else {
 		return errors.New("There's no configuration file defined.")
 	}
 
-	if ts == nil {
-		return errors.New("Test set is empty.")
+	if err != nil {
+		return fmt.Errorf("Cannot read %q: %s", r.input, err)
+	}
+	ts.Initialize()
+	// when rerunning, only the previously failed cases are executed
+	if r.rerun != "" {
+		if err = r.selectFailed(ts); err != nil {
+			return err
+		}
 	}
 	r.tr = atf.CreateTestReport(ts)
 	return
 }
 
+/*
+ * Runner.selectFailed - load the previous report and keep only the cases that
+ * have failed (or have not been tested) in the previous run
+ */
+func (r *Runner) selectFailed(ts *atf.TestSet) (err error) {
+	r.prev, err = atf.LoadTestReport(r.rerun)
+	if err != nil {
+		return err
+	}
+	if r.prev.TestSet.Name != ts.Name {
+		return fmt.Errorf("Report %q belongs to test set %q, not %q.",
+			r.rerun, r.prev.TestSet.Name, ts.Name)
+	}
+	ts.Select(r.prev.FailedCases())
+	if len(ts.Cases) == 0 {
+		return errors.New("There are no failed test cases to rerun.")
+	}
+	return nil
+}
+
+/*
+ * Runner.mergeRerun - merge the results of the rerun into the previous report;
+ * the rerun results are marked as such
+ */
+func (r *Runner) mergeRerun() {
+	r.tr.MarkRerun()
+	merged, err := atf.MergeReports(atf.MergeRerunOverridesFailure,
+		r.prev, r.tr)
+	if err != nil {
+		r.logger.Error(fmt.Sprintf("Cannot merge rerun results: %s\n", err))
+		return
+	}
+	r.tr = merged
+	r.logger.Notice(fmt.Sprintf("Rerun results merged with report %q\n",
+		r.rerun))
+}
+
 // Let's define the default levels for different log handlers:
 // all text goes only to file logger, console should take only the most
 // important printous, while syslog handler should omit sending the execution
@@ -152,10 +290,16 @@ func (r *Runner) createLog() error {
 		logfile = path.Join(r.workdir, "output.log")
 	}
 	r.logfile = logfile
+	// the JSON log lives in the working directory, too, unless absolute
+	if r.jsonlog != "" && !path.IsAbs(r.jsonlog) {
+		r.jsonlog = path.Join(r.workdir, r.jsonlog)
+	}
 	// now the real thing...
-	format := "%s %s %s"
-	err := r.createLoggers(format, r.debug)
+	err := r.createLoggers(r.logFormat, r.debug)
 	if err != nil {
+		// the handlers created so far have their files open
+		r.logger.Close()
+		r.logger = utils.NewLog()
 		return err
 	}
     r.logger.Start()
@@ -168,44 +312,179 @@ func (r *Runner) createLog() error {
 }
 
 /*
- * Runner.createLoggers -
+ * logLevel - the log level by name; when not given, the default one is used
+ * (or debug in debug mode)
+ */
+func logLevel(name string, def utils.Severity,
+	debug bool) (utils.Severity, error) {
+	switch {
+	case name != "":
+		sev := utils.SeverityFromString(name)
+		if sev == utils.UnknownSeverity {
+			return def, fmt.Errorf("Invalid log level %q", name)
+		}
+		return sev, nil
+	case debug:
+		return utils.Debug, nil
+	}
+	return def, nil
+}
+
+/*
+ * Runner.createLoggers - create the log handlers; the text handlers share the
+ * formatter created from the format and the time layout
  */
 func (r *Runner) createLoggers(format string, debug bool) error {
 	// first, we define log levels (severity) 
-	fLevel := defFileLevel   // this is level for file handler
-	sLevel := defSyslogLevel // this is level for syslog & console handlers
-	if debug {
-		fLevel = utils.Debug
-		sLevel = utils.Debug
+	fLevel, err := logLevel(r.fileLevel, defFileLevel, debug)
+	if err != nil {
+		return err
 	}
+	sLevel, err := logLevel(r.syslogLevel, defSyslogLevel, debug)
+	if err != nil {
+		return err
+	}
+	cLevel, err := logLevel(r.consoleLevel, defStreamLevel, debug)
+	if err != nil {
+		return err
+	}
+	formatter, err := utils.NewTemplateFormatter(format, r.logTime)
+	if err != nil {
+		return err
+	}
+	formatter.Source = "goatf"
 	// now create file logger
-	f, err := utils.NewFileHandler(r.logfile, format, fLevel)
+	rotate, err := r.rotateConfig()
+	if err != nil {
+		return err
+	}
+	f, err := utils.NewRotatingFileHandler(r.logfile, format, fLevel, rotate)
 	if err != nil {
 		return err
 	}
 	if f != nil {
+		f.SetFormatter(formatter)
 		r.logger.Handlers = r.logger.AddHandler(f)
 	}
-	// and create console logger
-	l := utils.NewStreamHandler(format, sLevel)
-	if l != nil {
+	// the JSON log and the per-case logs use the same level as the file log
+	if r.jsonlog != "" {
+		j, err := utils.NewJsonFileHandler(r.jsonlog, fLevel, rotate)
+		if err != nil {
+			return err
+		}
+		r.logger.Handlers = r.logger.AddHandler(j)
+	}
+	if r.caseLogs {
+		c := utils.NewCaseFileHandler(r.workdir, format, fLevel)
+		c.SetFormatter(formatter)
+		r.logger.Handlers = r.logger.AddHandler(c)
+	}
+	// and create console logger; when the progress is displayed, the console
+	// takes only the errors (unless the console level is given)
+	if r.progress && r.consoleLevel == "" {
+		cLevel = utils.Error
+	}
+	l := utils.NewStreamHandler(format, cLevel)
+	l.SetFormatter(formatter)
+	if !r.quiet {
 		r.logger.Handlers = r.logger.AddHandler(l)
 	}
 	// and finally create syslog logger if needed
 	if r.syslog != "" {
-		var s *utils.SyslogHandler
-		s = utils.NewSyslogHandler(r.syslog, format, sLevel)
-		if s != nil {
-			r.logger.Handlers = r.logger.AddHandler(s)
+		s, err := r.createSyslogHandler(format, sLevel)
+		if err != nil {
+			return err
+		}
+		r.logger.Handlers = r.logger.AddHandler(s)
+	}
+	// all the handlers share the buffer size and the overflow policy
+	overflow, err := utils.OverflowPolicyFromString(r.logOverflow)
+	if err != nil {
+		return err
+	}
+	for _, h := range r.logger.Handlers {
+		h.SetBufferSize(r.logBuffer)
+		h.SetOverflow(overflow)
+	}
+	return nil
+}
+
+/*
+ * Runner.rotateConfig - the rotation of the log files; the resumed run always
+ * appends to the logs of the interrupted one
+ */
+func (r *Runner) rotateConfig() (utils.RotateConfig, error) {
+	cfg := utils.RotateConfig{MaxAge: r.logMaxAge, MaxBackups: r.logMaxBackups,
+		Compress: r.logCompress, Append: r.logAppend || r.resume != ""}
+	if r.logMaxSize != "" {
+		size, err := utils.ParseSize(r.logMaxSize)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.MaxSize = size
+	}
+	return cfg, nil
+}
+
+/*
+ * Runner.createSyslogHandler - create the syslog handler using the given
+ * transport and message format
+ */
+func (r *Runner) createSyslogHandler(format string,
+	sev utils.Severity) (*utils.SyslogHandler, error) {
+
+	s := utils.NewSyslogHandler(r.syslog, format, sev)
+	s.Proto = r.syslogProto
+	switch s.Proto {
+	case "", "udp", "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("Invalid syslog transport %q", s.Proto)
+	}
+	var err error
+	if s.MsgFormat, err = utils.SyslogFormatFromString(r.syslogFormat); err != nil {
+		return nil, err
+	}
+	if r.syslogCA != "" {
+		pem, err := os.ReadFile(r.syslogCA)
+		if err != nil {
+			return nil, err
 		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %q", r.syslogCA)
+		}
+		s.TLSConfig = &tls.Config{RootCAs: pool}
 	}
-	return err
+	return s, nil
+}
+
+/*
+ * Runner.createConsoleLog - create and start a console-only logger; used by
+ * the subcommands that do not execute the test set
+ */
+func (r *Runner) createConsoleLog() error {
+	l := utils.NewStreamHandler(utils.DefaultLogFormat, defStreamLevel)
+	r.logger.Handlers = r.logger.AddHandler(l)
+	return r.logger.Start()
 }
 
 /*
  * Runner.initalize - 
  */
 func (r *Runner) initialize() error {
+	// the script interpreters given by the configuration file
+	for lang, exe := range r.interpreters {
+		if err := atf.SetInterpreter(lang, exe); err != nil {
+			return fmt.Errorf("Invalid interpreter %q: %q", lang, exe)
+		}
+	}
+	// when resuming, the journal of the interrupted run is loaded first: it
+	// also remembers the input configuration file
+	if r.resume != "" {
+		if err := r.loadJournal(); err != nil {
+			return err
+		}
+	}
 	// let's collect the configuration
 	err := r.collect()
 	if err != nil {
@@ -219,51 +498,322 @@ func (r *Runner) initialize() error {
 		return err
 	}
 	// create log file
-	err = r.createLog()
-	return err
+	if err = r.createLog(); err != nil {
+		return err
+	}
+	r.attribute()
+	// restore the completed cases of the interrupted run
+	if r.state != nil {
+		r.restoreState()
+	}
+	return nil
 }
 
 /*
- * Runner.Run -
+ * Runner.attribute - record who initiated the run, on which host, using
+ * which GoATF version and config file into the report
  */
-func (r *Runner) Run() {
-	// define a logging closure to be passed around...
-	fn := atf.ExecDisplayFnCback(func(params ...string) {
-        // we check that at least two string args are present; if more, we
-        // ignore them
-		if len(params) < 2 {
-			panic("Callback: Wrong number of parameters.")
+func (r *Runner) attribute() {
+	r.tr.Initiator = r.initiator
+	if r.tr.Initiator == "" {
+		r.tr.Initiator = osUsername()
+	}
+	r.tr.Host, _ = os.Hostname()
+	r.tr.Version = atf.Version
+	hash, err := atf.HashFile(r.input)
+	if err != nil {
+		r.logger.Warning(fmt.Sprintf("Cannot hash config file: %s\n", err))
+	}
+	r.tr.ConfigHash = hash
+}
+
+/*
+ * osUsername - return the name of the current OS user
+ */
+func osUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
+
+/*
+ * Runner.audit - record the action into the audit log in the root of the
+ * working directories; the given files are hashed, so their later
+ * modification is detected
+ */
+func (r *Runner) audit(action string, details map[string]string,
+	files ...string) {
+
+	subject, _ := filepath.Abs(r.workdir)
+	root := r.rootdir
+	if root == "" {
+		root = defaultRootDir()
+	}
+	// the reports may be edited by someone else than the initiator of the run
+	who := r.initiator
+	if who == "" {
+		who = r.tr.Initiator
+	}
+	host, _ := os.Hostname()
+	e := &atf.AuditEntry{User: who, Host: host, Action: action,
+		Subject: filepath.ToSlash(subject), Details: details}
+	for i, name := range files {
+		if abs, err := filepath.Abs(name); err == nil {
+			files[i] = filepath.ToSlash(abs)
 		}
-        // now log the message
-		lvl := params[0] // the first arg is logging level
-		msg := params[1] // the second arg is logging message
-		r.logger.LogS(lvl, msg)
-	})
+	}
+	log := atf.OpenAuditLog(root)
+	if err := log.Append(e, files...); err != nil {
+		r.logger.Error(fmt.Sprintf("Cannot record audit entry: %s\n", err))
+		return
+	}
+	r.logger.Debug(fmt.Sprintf("Audit entry %d recorded into %s\n", e.Seq,
+		log.String()))
+}
+
+/*
+ * Runner.loadJournal - load the journal of the interrupted run; the working
+ * directory of the interrupted run is reused
+ */
+func (r *Runner) loadJournal() (err error) {
+	r.workdir = r.resume
+	r.state, err = atf.LoadJournal(path.Join(r.resume, atf.JournalFilename))
+	if err != nil {
+		return err
+	}
+	if r.input == "" {
+		r.input = r.state.Input
+	}
+	return nil
+}
+
+/*
+ * Runner.restoreState - restore the results of the cases completed in the
+ * interrupted run; these cases are not executed again
+ */
+func (r *Runner) restoreState() {
+	n := r.tr.TestSet.Resume(r.state)
+	r.logger.Notice(fmt.Sprintf("Resuming run in %q: %d of %d cases completed\n",
+		r.workdir, n, len(r.tr.TestSet.Cases)))
+	for name, steps := range r.state.Steps {
+		r.logger.Notice(fmt.Sprintf(
+			"Case %q was interrupted after %d step(s), executing it again\n",
+			name, len(steps)))
+	}
+}
 
-	// execution begins...
-	r.tr.Started = utils.Now()
-	r.logger.Notice(fmt.Sprintf("     Started: %s\n", r.tr.Started))
+/*
+ * Runner.openJournal - open the journal and register it as an observer of
+ * the test set execution, so every finished step and case is journaled
+ */
+func (r *Runner) openJournal() error {
+	var err error
+	filename := path.Join(r.workdir, atf.JournalFilename)
+	if r.journal, err = atf.OpenJournal(filename); err != nil {
+		return err
+	}
+	// the start is recorded only once, resumed runs keep the original one
+	if r.state == nil {
+		input, err := filepath.Abs(r.input)
+		if err != nil {
+			return err
+		}
+		if err = r.journal.Start(r.tr.Started, input); err != nil {
+			return err
+		}
+	}
+	r.events.Subscribe(r.journal)
+	return nil
+}
+
+/*
+ * Runner.startSutLog - start receiving the SUT syslog messages into the
+ * working directory and register the receiver as an observer of the test set
+ * execution, so the messages are attached to the test cases
+ */
+func (r *Runner) startSutLog() (*atf.SutLog, error) {
+	filename := path.Join(r.workdir, atf.SutLogFilename)
+	sutlog, err := atf.StartSutLog(r.sutlogProto, r.sutlog, filename)
+	if err != nil {
+		return nil, err
+	}
+	r.events.Subscribe(sutlog)
+	r.logger.Notice(fmt.Sprintf("Receiving SUT logs: %s\n", sutlog))
+	return sutlog, nil
+}
+
+/*
+ * Runner.Run - execute the test set; when the context is cancelled, the
+ * execution is aborted and the report is marked as such
+ */
+func (r *Runner) Run(ctx context.Context) {
+	if r.progress {
+		r.events.Subscribe(NewProgress(os.Stdout, r.caseEstimates()))
+	}
+
+	// execution begins...; a resumed run keeps the original start
+	r.tr.Started = time.Now()
+	if r.state != nil && !r.state.Started.IsZero() {
+		r.tr.Started = r.state.Started
+	}
+	r.logger.Notice(fmt.Sprintf("     Started: %s\n",
+		r.tr.Started.Format(time.RFC3339)))
+	r.audit(atf.AuditRunStarted, map[string]string{
+		"TestSet": r.tr.TestSet.Name, "Config": r.input,
+		"ConfigHash": r.tr.ConfigHash})
+
+	// capture the SUT logs; the cases must get their SUT logs attached
+	// before they are journaled
+	if r.sutlog != "" {
+		sutlog, err := r.startSutLog()
+		if err != nil {
+			r.logger.Error(fmt.Sprintf("Cannot receive SUT logs: %s\n", err))
+		} else {
+			defer sutlog.Close()
+			ctx = atf.WithSutLog(ctx, sutlog)
+		}
+	}
+
+	// the variables are passed to the executed scripts
+	if len(r.variables) > 0 {
+		ctx = atf.WithVariables(ctx, r.variables)
+	}
+
+	// journal the execution progress, so the run can be resumed
+	if err := r.openJournal(); err != nil {
+		r.logger.Error(fmt.Sprintf("Cannot open journal: %s\n", err))
+	} else {
+		defer r.journal.Close()
+	}
+
+	// compute the flakiness of the cases from the previous runs
+	if r.flakyRuns > 0 {
+		r.computeFlakiness()
+	}
+
+	// keep the reports up to date while the test set is executed
+	if r.incremental {
+		r.events.Subscribe(&reportUpdater{r})
+		r.updateReports()
+	}
 
 	// run test set only if it's not empty...
 	if r.tr.TestSet != nil {
 		r.logger.Notice(fmt.Sprintf("# Starting Test set: %q\n",
 						r.tr.TestSet.Name))
-		r.tr.TestSet.Execute(&fn) // we pass a ptr to defined closure
+		if !r.abortCleanup {
+			ctx = atf.SkipCleanupOnAbort(ctx)
+		}
+		r.tr.TestSet.Execute(ctx, r.events)
 	}
 
-	r.tr.Finished = utils.Now()
+	r.tr.Finished = time.Now()
+	r.tr.Aborted = ctx.Err() != nil
+	if r.tr.Aborted {
+		r.logger.Warning("Execution has been ABORTED.\n")
+	}
 	r.logger.Notice(fmt.Sprintf("# Test set: %q end.\n", r.tr.TestSet.Name))
-	r.logger.Notice(fmt.Sprintf("     Finished: %s\n", r.tr.Finished))
+	r.logger.Notice(fmt.Sprintf("     Finished: %s\n",
+		r.tr.Finished.Format(time.RFC3339)))
 	// This is the end of execution
 
+	// when rerunning, the final report contains the previous results, too;
+	// the history gets only the results of this run, the previous ones have
+	// already been recorded
+	run := r.tr
+	if r.prev != nil {
+		r.mergeRerun()
+	}
+
+	// and finally, the results are recorded into the history store; the
+	// aborted runs would only distort the trends
+	if r.history && !run.Aborted {
+		r.saveHistory(run)
+	}
+}
+
+/*
+ * Runner.computeFlakiness - compute the flakiness scores of the test cases
+ * from the previous runs recorded in the history store in the working dirs
+ * root; cases above the quarantine threshold are quarantined
+ */
+func (r *Runner) computeFlakiness() {
+	version := ""
+	if r.tr.TestSet.Sut != nil {
+		version = r.tr.TestSet.Sut.Version
+	}
+	h := atf.OpenHistory(r.rootdir)
+	records, err := h.Query(&atf.HistoryQuery{TestSet: r.tr.TestSet.Name,
+		SutVersion: version})
+	if err != nil {
+		r.logger.Warning(fmt.Sprintf("Cannot read history: %s\n", err))
+	}
+	scores := atf.ComputeFlakiness(records, version, r.flakyRuns)
+	for _, name := range r.tr.SetFlakiness(scores, r.quarantine) {
+		r.logger.Warning(fmt.Sprintf(
+			"Test case %q is flaky: quarantined\n", name))
+	}
+}
+
+/*
+ * Runner.ExitCode - return the exit status of the execution: non-zero if any
+ * of the test cases (that is not quarantined) has failed or if the execution
+ * has been aborted
+ */
+func (r *Runner) ExitCode() int {
+	if r.tr != nil && r.tr.Aborted {
+		return ExitAborted
+	}
+	if r.tr != nil && len(r.tr.Failures()) > 0 {
+		return 1
+	}
+	return 0
+}
+
+/*
+ * Runner.caseEstimates - return the expected durations of the test cases, the
+ * averages from the previous runs recorded in the history store
+ */
+func (r *Runner) caseEstimates() map[string]time.Duration {
+	estimates := make(map[string]time.Duration)
+	h := atf.OpenHistory(r.rootdir)
+	records, err := h.Query(&atf.HistoryQuery{TestSet: r.tr.TestSet.Name})
+	if err != nil {
+		r.logger.Warning(fmt.Sprintf("Cannot read history: %s\n", err))
+		return estimates
+	}
+	for _, t := range atf.CaseTrends(records) {
+		if d := t.AvgDuration(); d > 0 {
+			estimates[t.Case] = d
+		}
+	}
+	return estimates
+}
+
+/*
+ * Runner.saveHistory - record the results of the run into the history store
+ * in the root of the working directories
+ */
+func (r *Runner) saveHistory(tr *atf.TestReport) {
+	h := atf.OpenHistory(r.rootdir)
+	if err := h.Add(tr); err != nil {
+		r.logger.Error(fmt.Sprintf("Cannot record history: %s\n", err))
+		return
+	}
+	r.logger.Info(fmt.Sprintf("Results recorded into %s\n", h.String()))
 }
 
 /*
- * Runner.createHtmlHeader -
+ * createHtmlHeader - create the <head> section of the HTML page; both the
+ * mandatory CSS file and the given custom CSS file are referenced.
  */
 const mandatory_css = "cfg/always.css"
 
-func (r *Runner) createHtmlHeader(name string) string {
+func createHtmlHeader(name, cssfile string) string {
 	s := "<!DOCTYPE html>\n"
 	s += "<html>\n<head>\n"
 	s += fmt.Sprintf("<meta charset=%q>\n", "utf-8")
@@ -273,12 +823,37 @@ func (r *Runner) createHtmlHeader(name string) string {
 	_, f1 := path.Split(mandatory_css)
 	s += fmt.Sprintf("href=%q>\n", f1)
 	s += "<link rel=\"stylesheet\" type=\"text/css\" "
-	_, f2 := path.Split(r.cssfile)
+	_, f2 := path.Split(cssfile)
 	s += fmt.Sprintf("href=%q>\n", f2)
 	s += "</head>\n"
 	return s
 }
 
+/*
+ * writeHtmlPage - write a complete HTML page with given title and body into
+ * file and copy the CSS files beside it
+ */
+func writeHtmlPage(filename, title, body, cssfile string) error {
+	html := createHtmlHeader(title, cssfile)
+	html += "<body>\n"
+	html += body
+	html += "</body>\n</html>\n"
+	// the file itself
+	if err := utils.WriteTextFileAtomic(filename, html); err != nil {
+		return err
+	}
+	// copy the CSS files with HTML page
+	dir, _ := path.Split(filepath.ToSlash(filename))
+	_, f1 := path.Split(mandatory_css)
+	_, f2 := path.Split(cssfile)
+	_, err := utils.CopyFile(path.Join(dir, f1), mandatory_css)
+	_, err = utils.CopyFile(path.Join(dir, f2), cssfile)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 /*
  * Runner.createXmlReport - create a XML version of the  test report 
  */
@@ -292,13 +867,7 @@ func (r *Runner) createXmlReport(filename string) error {
 	x += trXml
 
     // write XML file
-	fout, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0755)
-	if err != nil {
-		return err
-	}
-	defer fout.Close()
-	fmt.Fprint(fout, x)
-	return nil
+	return utils.WriteTextFileAtomic(filename, x)
 }
 
 func (r *Runner) createJsonReport(filename string) error {
@@ -308,15 +877,17 @@ func (r *Runner) createJsonReport(filename string) error {
         return err
     }
 
-    //
-    f, err := os.Create(filename)
-    if  err != nil {
-        return err
-    }
-    defer f.Close()
+    return utils.WriteTextFileAtomic(filename, json)
+}
+
+func (r *Runner) createTextReport(filename string) error {
 
-    fmt.Fprint(f, json)
-    return nil
+	text, err := r.tr.Text()
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteTextFileAtomic(filename, text)
 }
 
 /*
@@ -324,36 +895,28 @@ func (r *Runner) createJsonReport(filename string) error {
  */
 func (r *Runner) createHtmlReport(filename string) error {
 	// HTML report is always created
-	html := r.createHtmlHeader(r.tr.TestSet.Name)
-	html += "<body>\n"
 	h, err := r.tr.Html()
 	if err != nil {
 		return err
 	}
-	html += h
-	html += "</body>\n</html>\n"
-	// the file itself
-	fout, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
-	}
-	defer fout.Close()
-	fmt.Fprint(fout, html)
-	// copy the CSS files with HTML report
-	_, f1 := path.Split(mandatory_css)
-	_, f2 := path.Split(r.cssfile)
-	_, err = utils.CopyFile(path.Join(r.workdir, f1), mandatory_css)
-	_, err = utils.CopyFile(path.Join(r.workdir, f2), r.cssfile)
-	if err != nil {
-		return err
-	}
-	return nil
+	return writeHtmlPage(filename, r.tr.TestSet.Name, h, r.cssfile)
 }
 
 /*
- * Runner.CreateReports
+ * Runner.CreateReports - create the reports; the created reports are
+ * recorded into the audit log
  */
 func (r *Runner) CreateReports() {
+	created := make([]string, 0, 4)
+	defer func() {
+		details := map[string]string{"TestSet": r.tr.TestSet.Name,
+			"Status": r.tr.Summary().Status}
+		for k, v := range r.auditDetails {
+			details[k] = v
+		}
+		r.audit(r.auditAction, details, created...)
+	}()
+
 	// always create HTML report
 	filename := filepath.ToSlash(path.Join(r.workdir, "report.html"))
 	err := r.createHtmlReport(filename)
@@ -362,6 +925,7 @@ func (r *Runner) CreateReports() {
 		r.logger.Error(fmt.Sprintf("Reason: %s\n", err))
 		return
 	}
+	created = append(created, filename)
 	r.logger.Notice(fmt.Sprintf("HTML report %q created.\n", filename))
 
 	// create XML report, if needed
@@ -373,6 +937,7 @@ func (r *Runner) CreateReports() {
 			r.logger.Error(fmt.Sprintf("Reason: %s\n", err))
 			return
 		}
+		created = append(created, filename)
 		r.logger.Notice(fmt.Sprintf("XML report %q created.\n", filename))
 	}
 
@@ -385,8 +950,130 @@ func (r *Runner) CreateReports() {
 			r.logger.Error(fmt.Sprintf("Reason: %s\n", err))
 			return
 		}
+		created = append(created, filename)
 		r.logger.Notice(fmt.Sprintf("JSON report %q created.\n", filename))
     }
+
+	// plain text report upon request
+	if r.text {
+		filename = filepath.ToSlash(path.Join(r.workdir, "report.txt"))
+		err := r.createTextReport(filename)
+		if err != nil {
+			r.logger.Error("Text report could not be created.\n")
+			r.logger.Error(fmt.Sprintf("Reason: %s\n", err))
+			return
+		}
+		created = append(created, filename)
+		r.logger.Notice(fmt.Sprintf("Text report %q created.\n", filename))
+	}
+}
+
+/*
+ * Runner.updateReports - rewrite the reports with the partial results of the
+ * execution that is still in progress
+ */
+func (r *Runner) updateReports() {
+	r.tr.InProgress = true
+	defer func() { r.tr.InProgress = false }()
+
+	filename := filepath.ToSlash(path.Join(r.workdir, "report.html"))
+	err := r.createHtmlReport(filename)
+	if err == nil && r.xml {
+		filename = filepath.ToSlash(path.Join(r.workdir, "report.xml"))
+		err = r.createXmlReport(filename)
+	}
+	if err == nil && r.json {
+		filename = filepath.ToSlash(path.Join(r.workdir, "report.json"))
+		err = r.createJsonReport(filename)
+	}
+	if err == nil && r.text {
+		filename = filepath.ToSlash(path.Join(r.workdir, "report.txt"))
+		err = r.createTextReport(filename)
+	}
+	if err != nil {
+		r.logger.Error(fmt.Sprintf("Report %q could not be updated: %s\n",
+			filename, err))
+		return
+	}
+	r.logger.Debug("Reports updated.\n")
+}
+
+/*
+ * reportUpdater - a subscriber to the execution events that updates the
+ * reports after every finished test case
+ */
+type reportUpdater struct {
+	r *Runner
+}
+
+func (u *reportUpdater) HandleEvent(e atf.Event) {
+	if _, ok := e.(*atf.CaseFinished); ok {
+		u.r.updateReports()
+	}
+}
+
+/*
+ * Runner.setLogContext - set the log context: the test set, case and step
+ * being executed
+ */
+func (r *Runner) setLogContext(set, tc, step string) {
+	r.logctx = utils.LogContext{TestSet: set, TestCase: tc, TestStep: step}
+	r.logger.SetContext(r.logctx)
+}
+
+/*
+ * Runner.logEvent - log the execution event; the log context is entered
+ * before the first message and left after the last one
+ */
+func (r *Runner) logEvent(e atf.Event) {
+	switch ev := e.(type) {
+	case *atf.SetStarted:
+		r.setLogContext(ev.Set.Name, "", "")
+		r.logger.Notice(fmt.Sprintf(">>> Entering Test Set %q\n", ev.Set.Name))
+	case *atf.SetFinished:
+		r.logger.Notice(fmt.Sprintf("<<< Leaving test set %q\n", ev.Set.Name))
+		r.setLogContext("", "", "")
+	case *atf.ActionStarted:
+		owner := "test set"
+		if ev.Case != nil {
+			owner = "case"
+		}
+		r.logger.Notice(fmt.Sprintf("Executing %s %s action: %q\n", owner,
+			ev.Role, ev.Action.String()))
+	case *atf.ActionFinished:
+		r.logger.Info(atf.FmtOutput(ev.Output))
+	case *atf.CaseStarted:
+		if r.caseLogs {
+			ev.Case.LogFile = utils.CaseLogName(ev.Case.Name)
+		}
+		r.setLogContext(r.logctx.TestSet, ev.Case.Name, "")
+		r.logger.Notice(fmt.Sprintf(">>> Entering TestCase %q\n", ev.Case.Name))
+	case *atf.CaseSkipped:
+		r.logger.Notice(fmt.Sprintf("Test case %q %s, skipping.\n",
+			ev.Case.Name, ev.Reason))
+	case *atf.CaseFinished:
+		r.logger.Notice(fmt.Sprintf("Test case evaluated to %q in %s\n",
+			ev.Result, ev.Duration))
+		r.logger.Notice(fmt.Sprintf("<<< Leaving TestCase %q\n", ev.Case.Name))
+		r.setLogContext(r.logctx.TestSet, "", "")
+	case *atf.StepStarted:
+		r.setLogContext(r.logctx.TestSet, r.logctx.TestCase, ev.Step.Name)
+		r.logger.Info(fmt.Sprintf(">>> Entering test step %q\n", ev.Step.Name))
+		if ev.Step.Action != nil && ev.Step.Action.IsExecutable() {
+			r.logger.Notice(fmt.Sprintf("Executing test step action: %q\n",
+				ev.Step.Action.String()))
+		}
+	case *atf.StepFinished:
+		if ev.Step.Action != nil && ev.Step.Action.IsExecutable() {
+			r.logger.Info(atf.FmtOutput(ev.Output))
+		}
+		r.logger.Notice(fmt.Sprintf("Test step evaluated to %q in %s\n",
+			ev.Result, ev.Duration))
+		r.logger.Info(fmt.Sprintf("<<< Leaving test step %q\n", ev.Step.Name))
+		r.setLogContext(r.logctx.TestSet, r.logctx.TestCase, "")
+	case *atf.Message:
+		r.logger.LogS(ev.Severity, ev.Text)
+	}
 }
 
 /*
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"bitbucket.org/miranr/goatf/atf"
+)
+
+// Creates a report of the test set with given case statuses (by name).
+func testReport(start time.Time, aborted bool,
+	cases map[string]atf.TestResult) *atf.TestReport {
+	ts := &atf.TestSet{Name: "set"}
+	for name, status := range cases {
+		ts.Cases = append(ts.Cases, &atf.TestCase{Name: name, Status: status})
+	}
+	return &atf.TestReport{TestSet: ts, Started: start,
+		Finished: start.Add(time.Minute), Aborted: aborted}
+}
+
+func TestRunnerExitCodeAfterRerun(t *testing.T) {
+	start := time.Date(2026, 10, 26, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		rerun    map[string]atf.TestResult
+		aborted  bool
+		expected int
+	}{
+		{"clean rerun passed", map[string]atf.TestResult{"b": "Pass"},
+			false, 0},
+		{"clean rerun failed", map[string]atf.TestResult{"b": "Fail"},
+			false, 1},
+		{"aborted rerun", map[string]atf.TestResult{"b": "NotTested"},
+			true, ExitAborted},
+	}
+	for _, test := range tests {
+		r := NewRunner()
+		r.prev = testReport(start, true,
+			map[string]atf.TestResult{"a": "Pass", "b": "NotTested"})
+		r.tr = testReport(start.Add(time.Hour), test.aborted, test.rerun)
+		r.mergeRerun()
+		if code := r.ExitCode(); code != test.expected {
+			t.Errorf("%q: got exit code %d, expected %d", test.name, code,
+				test.expected)
+		}
+	}
+}
+
+func TestRunnerRootDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	tests := []struct {
+		args             []string
+		workdir, rootdir string
+	}{
+		// the working dir elsewhere does not move the root
+		{[]string{"-w", "/tmp/run1"}, "/tmp/run1", defaultRootDir()},
+		{[]string{"-root", "/srv/goatf", "-w", "/tmp/run1"}, "/tmp/run1",
+			"/srv/goatf"},
+		// the default working dir is created under the root
+		{[]string{"-root", "/srv/goatf"}, "/srv/goatf/set_", "/srv/goatf"},
+		{[]string{}, defaultRootDir() + "/set_", defaultRootDir()},
+	}
+	for _, test := range tests {
+		r := NewRunner()
+		fs := flag.NewFlagSet("run", flag.ContinueOnError)
+		runFlags(r, fs)
+		if err := fs.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		r.setWorkDir(r.workdir, "set")
+		if !strings.HasPrefix(r.workdir, test.workdir) {
+			t.Errorf("%q: got workdir %q, expected %q...", test.args,
+				r.workdir, test.workdir)
+		}
+		if r.rootdir != test.rootdir {
+			t.Errorf("%q: got root %q, expected %q", test.args, r.rootdir,
+				test.rootdir)
+		}
+	}
+}
+
+// The history records only the results of the rerun, not the previous ones
+// merged into its report.
+func TestRunnerRerunHistory(t *testing.T) {
+	root := t.TempDir()
+	prevStart := time.Date(2026, 10, 26, 8, 0, 0, 0, time.UTC)
+	r := NewRunner()
+	r.rootdir, r.workdir, r.history = root, root+"/rerun", true
+	r.prev = testReport(prevStart, false,
+		map[string]atf.TestResult{"a": "Pass", "b": "Fail"})
+	ts := &atf.TestSet{Name: "set", Cases: []*atf.TestCase{&atf.TestCase{
+		Name: "b", Expected: "Pass", Steps: []*atf.TestStep{&atf.TestStep{
+			Name: "step", Expected: "Pass",
+			Action: atf.CreateManualAction("check it")}}}}}
+	ts.Initialize()
+	r.tr = atf.CreateTestReport(ts)
+	r.Run(context.Background())
+
+	if n := len(r.tr.TestSet.Cases); n != 2 {
+		t.Errorf("merged report: got %d cases, expected 2", n)
+	}
+	records, err := atf.OpenHistory(root).Query(&atf.HistoryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d history records, expected 1", len(records))
+	}
+	rec := records[0]
+	if rec.Started.Equal(prevStart) {
+		t.Errorf("history record has the start of the previous run")
+	}
+	if len(rec.Cases) != 1 || rec.Cases[0].Name != "b" {
+		t.Errorf("history record: got %d cases, expected only %q",
+			len(rec.Cases), "b")
+	}
+}
+
+// Reads the JSON report from the working dir of the runner.
+func readJsonReport(t *testing.T, r *Runner) *atf.TestReport {
+	b, err := os.ReadFile(filepath.Join(r.workdir, "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := new(atf.TestReport)
+	if err = json.Unmarshal(b, tr); err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func TestRunnerUpdateReports(t *testing.T) {
+	start := time.Date(2026, 10, 26, 8, 0, 0, 0, time.UTC)
+	r := NewRunner()
+	r.rootdir, r.json, r.cssfile = t.TempDir(), true, "cfg/report_def.css"
+	r.workdir = filepath.Join(r.rootdir, "run")
+	if err := os.Mkdir(r.workdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	r.tr = testReport(start, false,
+		map[string]atf.TestResult{"a": "Pass", "b": "NotTested"})
+	u := &reportUpdater{r}
+
+	// only the finished test cases update the reports
+	u.HandleEvent(&atf.CaseStarted{Case: r.tr.TestSet.Cases[0]})
+	for _, name := range []string{"report.html", "report.json"} {
+		if _, err := os.Stat(filepath.Join(r.workdir, name)); err == nil {
+			t.Errorf("%q: created when the case has started", name)
+		}
+	}
+	u.HandleEvent(&atf.CaseFinished{Case: r.tr.TestSet.Cases[0],
+		Result: "Pass"})
+	if _, err := os.Stat(filepath.Join(r.workdir, "report.html")); err != nil {
+		t.Errorf("HTML report not updated: %s", err)
+	}
+	if tr := readJsonReport(t, r); !tr.InProgress {
+		t.Errorf("partial report is not marked in progress")
+	}
+	if r.tr.InProgress {
+		t.Errorf("the report of the runner is left in progress")
+	}
+
+	// the final report replaces the partial one
+	r.CreateReports()
+	if tr := readJsonReport(t, r); tr.InProgress {
+		t.Errorf("final report is marked in progress")
+	}
+}
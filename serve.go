@@ -0,0 +1,479 @@
+/*
+ * serve.go - the implementation of the 'goatf serve' subcommand
+ *
+ * The embedded HTTP server exposes the REST API to trigger and observe the
+ * runs, so the tests can be started on a lab machine without SSH:
+ *
+ *   POST   /api/runs                  start a run; the test set config is
+ *                                     either uploaded as request body (JSON
+ *                                     or XML, according to Content-Type) or
+ *                                     referenced by '?config=<path>' relative
+ *                                     to the configs directory
+ *   GET    /api/runs                  list the runs
+ *   GET    /api/runs/{id}             display the run
+ *   GET    /api/runs/{id}/report      fetch the TestReport as JSON
+ *   GET    /api/runs/{id}/report.html fetch the TestReport as HTML
+ *   GET    /api/runs/{id}/cases/{log} fetch the log file of the test case
+ *                                     (linked from the HTML report)
+ *   GET    /api/runs/{id}/events      stream the run events (SSE, see
+ *                                     stream.go)
+ *   DELETE /api/runs/{id}             cancel the run
+ *
+ * The runs reuse the Runner logic: every run has its own working directory
+ * under the root and the reports are updated after every finished test case,
+ * so the reports of the running test sets can be fetched, too.
+ *
+ * The web dashboard is served, too (see dashboard.go).
+ *
+ * The clients authenticate against the user store (see atf.FileUserStore,
+ * managed by 'goatf user') using the password, session cookie or API token
+ * (see auth.go) and the permissions are granted according to their roles (see
+ * atf.RolePermissions). Who did what is recorded into the server log.
+ */
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"bitbucket.org/miranr/goatf/atf"
+	"bitbucket.org/miranr/goatf/atf/utils"
+)
+
+// The maximum size of the uploaded test set config.
+const maxConfigSize = 16 << 20
+
+// The statuses of the runs.
+const (
+	runRunning = "running"
+	runPassed  = "passed"
+	runFailed  = "failed"
+	runAborted = "aborted"
+)
+
+/*
+ * serverRun - a single run started by the server
+ */
+type serverRun struct {
+	ID       string
+	TestSet  string
+	Input    string
+	Workdir  string
+	User     string
+	Status   string
+	Started  time.Time
+	Finished *time.Time `json:",omitempty"`
+
+	// cancels the run
+	cancel context.CancelFunc
+
+	// the recorded events of the run
+	stream *eventStream
+}
+
+/*
+ * Server - the GoATF HTTP server
+ */
+type Server struct {
+	root    string // root of the working dirs
+	configs string // directory with the test set configs
+	cssfile string // CSS file for the HTML reports
+
+	users    atf.UserStore
+	tokens   atf.TokenStore
+	sessions *sessions
+	log      *utils.Log // the server log, including the audit records
+
+	runs  map[string]*serverRun
+	next  int
+	mutex sync.Mutex
+	wg    sync.WaitGroup
+}
+
+/*
+ * serveCmd - run the HTTP server
+ */
+func serveCmd(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	root := fs.String("root", defaultRootDir(), "root of the working dirs")
+	configs := fs.String("configs", ".",
+		"directory with the test set configs that can be referenced")
+	users := fs.String("users", defaultUsersFile, "JSON file with the users")
+	tokens := fs.String("tokens", defaultTokensFile,
+		"JSON file with the API tokens")
+	logfile := fs.String("log", "",
+		"server log file (default: server.log in the root)")
+	cssfile := fs.String("c", "cfg/report_def.css",
+		"custom CSS file for HTML report")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: goatf serve [options]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if !utils.FileExists(*users) {
+		fmt.Fprintf(os.Stderr, "No users in %q, use 'goatf user add'\n",
+			*users)
+		return 1
+	}
+
+	if *logfile == "" {
+		*logfile = path.Join(*root, "server.log")
+	}
+	s, err := NewServer(*root, *configs, *cssfile,
+		atf.OpenFileUserStore(*users), atf.OpenFileTokenStore(*tokens),
+		*logfile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	srv := &http.Server{Addr: *addr, Handler: s.Handler()}
+
+	// the first signal stops the server: the running runs are aborted and
+	// their reports are written
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt,
+		syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+		srv.Shutdown(context.Background())
+	}()
+
+	fmt.Printf("GoATF server listening on %s\n", *addr)
+	if err = srv.ListenAndServe(); err != http.ErrServerClosed {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	s.Close()
+	return 0
+}
+
+/*
+ * NewServer - create a new server instance; the users are authenticated
+ * against the given stores and the server log is appended to the given file
+ */
+func NewServer(root, configs, cssfile string, users atf.UserStore,
+	tokens atf.TokenStore, logfile string) (*Server, error) {
+	s := &Server{root: root, configs: configs, cssfile: cssfile,
+		users: users, tokens: tokens, sessions: newSessions(defSessionTTL),
+		runs: make(map[string]*serverRun)}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	var err error
+	if s.log, err = createServerLog(logfile); err != nil {
+		return nil, fmt.Errorf("Cannot create server log: %s", err)
+	}
+	return s, nil
+}
+
+/*
+ * Server.Close - abort all the running runs and wait for them to finish
+ */
+func (s *Server) Close() {
+	s.mutex.Lock()
+	for _, run := range s.runs {
+		run.cancel()
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+	s.log.Close()
+}
+
+/*
+ * Server.Handler - return the HTTP handler of the API
+ */
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/login", s.login)
+	mux.HandleFunc("POST /api/logout", s.logout)
+	mux.HandleFunc("GET /api/whoami",
+		s.authorize(atf.ViewPermission, s.whoami))
+	mux.HandleFunc("POST /api/tokens",
+		s.authorize(atf.ViewPermission, s.createToken))
+	mux.HandleFunc("GET /api/tokens",
+		s.authorize(atf.ViewPermission, s.listTokens))
+	mux.HandleFunc("DELETE /api/tokens/{id}",
+		s.authorize(atf.ViewPermission, s.revokeToken))
+	mux.HandleFunc("POST /api/runs",
+		s.authorize(atf.RunPermission, s.startRun))
+	mux.HandleFunc("GET /api/runs",
+		s.authorize(atf.ViewPermission, s.listRuns))
+	mux.HandleFunc("GET /api/runs/{id}",
+		s.authorize(atf.ViewPermission, s.getRun))
+	mux.HandleFunc("GET /api/runs/{id}/report",
+		s.authorize(atf.ViewPermission, s.getReport("report.json")))
+	mux.HandleFunc("GET /api/runs/{id}/report.html",
+		s.authorize(atf.ViewPermission, s.getReport("report.html")))
+	mux.HandleFunc("GET /api/runs/{id}/cases/{log}",
+		s.authorize(atf.ViewPermission, s.getCaseLog))
+	mux.HandleFunc("GET /api/runs/{id}/events",
+		s.authorize(atf.ViewPermission, s.streamEvents))
+	mux.HandleFunc("DELETE /api/runs/{id}",
+		s.authorize(atf.RunPermission, s.cancelRun))
+	s.handleDashboard(mux)
+	return mux
+}
+
+/*
+ * httpError - reply with the error as JSON
+ */
+func httpError(w http.ResponseWriter, code int, msg string) {
+	writeJson(w, code, map[string]string{"Error": msg})
+}
+
+/*
+ * writeJson - reply with the value encoded as JSON
+ */
+func writeJson(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+/*
+ * Server.config - resolve the test set config of the new run: either the
+ * referenced config file or the uploaded one (saved into the uploads dir)
+ */
+func (s *Server) config(req *http.Request, id string) (string, error) {
+	if ref := req.URL.Query().Get("config"); ref != "" {
+		// the referenced file must not escape from the configs directory
+		clean := filepath.Clean("/" + ref)
+		input := filepath.Join(s.configs, clean)
+		if _, err := os.Stat(input); err != nil {
+			return "", fmt.Errorf("config %q not found", ref)
+		}
+		return input, nil
+	}
+	b, err := io.ReadAll(io.LimitReader(req.Body, maxConfigSize))
+	if err != nil {
+		return "", err
+	}
+	if len(b) == 0 {
+		return "", errors.New("test set config is missing")
+	}
+	ext := ".json"
+	if strings.Contains(req.Header.Get("Content-Type"), "xml") {
+		ext = ".xml"
+	}
+	dir := path.Join(s.root, "uploads")
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	input := path.Join(dir, "run"+id+ext)
+	return input, os.WriteFile(input, b, 0644)
+}
+
+/*
+ * Server.startRun - start a new run of the test set
+ */
+func (s *Server) startRun(w http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	s.next++
+	id := strconv.Itoa(s.next)
+	s.mutex.Unlock()
+
+	input, err := s.config(req, id)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// the runner is configured as if it were started from the command line;
+	// the working dir name is unique even for concurrent runs of the same set
+	r := NewRunner()
+	r.input = input
+	r.rootdir = s.root
+	r.workdir = path.Join(s.root, fmt.Sprintf("run%s_%s", id, utils.NowFile()))
+	r.cssfile = s.cssfile
+	r.json = true
+	r.incremental = true
+	r.history = true
+	r.flakyRuns = 10
+	r.abortCleanup = true
+	r.caseLogs = true
+	r.quiet = true
+	r.initiator = currentUser(req).Username
+	if err = r.initialize(); err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &serverRun{ID: id, TestSet: r.tr.TestSet.Name, Input: input,
+		Workdir: r.workdir, User: currentUser(req).Username,
+		Status: runRunning, Started: time.Now(), cancel: cancel,
+		stream: newEventStream()}
+	r.events.Subscribe(run.stream)
+	s.mutex.Lock()
+	s.runs[id] = run
+	s.mutex.Unlock()
+	s.audit(req, nil, "started run %s of test set %q", id, run.TestSet)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+		defer run.stream.Close()
+		r.Run(ctx)
+		r.CreateReports()
+		r.logger.Close()
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		finished := time.Now()
+		run.Finished = &finished
+		switch {
+		case r.tr.Aborted:
+			run.Status = runAborted
+		case r.ExitCode() != 0:
+			run.Status = runFailed
+		default:
+			run.Status = runPassed
+		}
+		s.log.Notice(fmt.Sprintf("Run %s of test set %q finished: %s\n",
+			id, run.TestSet, run.Status))
+	}()
+
+	w.Header().Set("Location", "/api/runs/"+id)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	writeJson(w, http.StatusCreated, run)
+}
+
+/*
+ * Server.listRuns - list all the runs, the latest first
+ */
+func (s *Server) listRuns(w http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	runs := make([]*serverRun, 0, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Started.After(runs[j].Started)
+	})
+	writeJson(w, http.StatusOK, runs)
+}
+
+/*
+ * Server.run - return the run given in the request path (or reply with 404)
+ */
+func (s *Server) run(w http.ResponseWriter, req *http.Request) *serverRun {
+	run, found := s.runs[req.PathValue("id")]
+	if !found {
+		httpError(w, http.StatusNotFound, "run not found")
+	}
+	return run
+}
+
+/*
+ * Server.getRun - display the run
+ */
+func (s *Server) getRun(w http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if run := s.run(w, req); run != nil {
+		writeJson(w, http.StatusOK, run)
+	}
+}
+
+/*
+ * Server.getReport - return the handler that serves the report file of the
+ * run; the reports of the running test sets are partial
+ */
+func (s *Server) getReport(filename string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		s.mutex.Lock()
+		run := s.run(w, req)
+		s.mutex.Unlock()
+		if run == nil {
+			return
+		}
+		b, err := os.ReadFile(path.Join(run.Workdir, filename))
+		if err != nil {
+			httpError(w, http.StatusNotFound, "report not available yet")
+			return
+		}
+		ctype := "application/json"
+		if path.Ext(filename) == ".html" {
+			ctype = "text/html; charset=utf-8"
+		}
+		w.Header().Set("Content-Type", ctype)
+		w.Write(b)
+	}
+}
+
+/*
+ * Server.getCaseLog - reply with the log file of the test case
+ */
+func (s *Server) getCaseLog(w http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	run := s.run(w, req)
+	s.mutex.Unlock()
+	if run == nil {
+		return
+	}
+	name := req.PathValue("log")
+	if name != path.Base(name) || path.Ext(name) != ".log" {
+		httpError(w, http.StatusBadRequest, "invalid log file name")
+		return
+	}
+	b, err := os.ReadFile(path.Join(run.Workdir, utils.CaseLogDir, name))
+	if err != nil {
+		httpError(w, http.StatusNotFound, "log not available")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(b)
+}
+
+/*
+ * Server.streamEvents - stream the events of the run to the client
+ */
+func (s *Server) streamEvents(w http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	run := s.run(w, req)
+	s.mutex.Unlock()
+	if run != nil {
+		run.stream.serve(w, req)
+	}
+}
+
+/*
+ * Server.cancelRun - cancel the run; the run is aborted gracefully and its
+ * report is still written
+ */
+func (s *Server) cancelRun(w http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	run := s.run(w, req)
+	if run == nil {
+		return
+	}
+	if run.Status != runRunning {
+		httpError(w, http.StatusConflict, "run is not running")
+		return
+	}
+	run.cancel()
+	s.audit(req, nil, "cancelled run %s", run.ID)
+	writeJson(w, http.StatusAccepted, run)
+}
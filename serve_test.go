@@ -0,0 +1,274 @@
+//go:build !windows
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"bitbucket.org/miranr/goatf/atf"
+)
+
+// The test set config that runs until it is cancelled (see quickConfig).
+const slowConfig = `{"Name": "slow", "Cases": [{"Name": "a",
+"Expected": "Pass", "Steps": [{"Name": "step", "Expected": "Pass",
+"Action": {"Script": "sleep", "Args": "10"}}]}]}`
+
+// Starts the server with the users "alice" (admin) and "gina" (guest); the
+// configs directory contains the quick config as "quick.json".
+func testServer(t *testing.T) *httptest.Server {
+	dir := t.TempDir()
+	users := atf.OpenFileUserStore(filepath.Join(dir, "users.json"))
+	for _, u := range []struct{ name, password, role string }{
+		{"alice", "secret1", "admin"},
+		{"gina", "secret2", "guest"},
+	} {
+		user, err := atf.CreateNewUser(u.name, u.password, u.role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = users.Add(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configs := filepath.Join(dir, "configs")
+	if err := os.Mkdir(configs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := os.WriteFile(filepath.Join(configs, "quick.json"),
+		[]byte(quickConfig), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := atf.OpenFileTokenStore(filepath.Join(dir, "tokens.json"))
+	s, err := NewServer(filepath.Join(dir, "root"), configs,
+		"cfg/report_def.css", users, tokens, filepath.Join(dir, "serve.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+	return ts
+}
+
+// Sends the request as alice and returns the response with its body.
+func apiRequest(t *testing.T, ts *httptest.Server, method, url,
+	body string) (*http.Response, string) {
+	return apiRequestAs(t, ts, "alice", "secret1", method, url, body)
+}
+
+// Sends the request authenticated with given username and password (none if
+// empty) and returns the response with its body.
+func apiRequestAs(t *testing.T, ts *httptest.Server, username, password,
+	method, url, body string) (*http.Response, string) {
+	req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+// Starts the run of given config and returns its ID.
+func startTestRun(t *testing.T, ts *httptest.Server, config string) string {
+	resp, body := apiRequest(t, ts, "POST", "/api/runs", config)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("got status %d (%s), expected %d", resp.StatusCode, body,
+			http.StatusCreated)
+	}
+	run := new(serverRun)
+	if err := json.Unmarshal([]byte(body), run); err != nil {
+		t.Fatal(err)
+	}
+	if loc := resp.Header.Get("Location"); loc != "/api/runs/"+run.ID {
+		t.Errorf("got location %q", loc)
+	}
+	return run.ID
+}
+
+// Waits until the run is finished and returns it.
+func waitTestRun(t *testing.T, ts *httptest.Server, id string) *serverRun {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		_, body := apiRequest(t, ts, "GET", "/api/runs/"+id, "")
+		run := new(serverRun)
+		if err := json.Unmarshal([]byte(body), run); err != nil {
+			t.Fatal(err)
+		}
+		if run.Status != runRunning {
+			return run
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("run %s has not finished", id)
+	return nil
+}
+
+func TestServerAuthorization(t *testing.T) {
+	ts := testServer(t)
+	tests := []struct {
+		name               string
+		username, password string
+		method, url        string
+		expected           int
+	}{
+		{"anonymous", "", "", "GET", "/api/runs", http.StatusUnauthorized},
+		{"wrong password", "alice", "secret2", "GET", "/api/runs",
+			http.StatusUnauthorized},
+		{"unknown user", "eve", "secret1", "GET", "/api/runs",
+			http.StatusUnauthorized},
+		{"guest lists", "gina", "secret2", "GET", "/api/runs",
+			http.StatusOK},
+		{"guest starts", "gina", "secret2", "POST", "/api/runs",
+			http.StatusForbidden},
+		{"guest cancels", "gina", "secret2", "DELETE", "/api/runs/1",
+			http.StatusForbidden},
+		{"admin lists", "alice", "secret1", "GET", "/api/runs",
+			http.StatusOK},
+	}
+	for _, test := range tests {
+		resp, _ := apiRequestAs(t, ts, test.username, test.password,
+			test.method, test.url, quickConfig)
+		if resp.StatusCode != test.expected {
+			t.Errorf("%q: got status %d, expected %d", test.name,
+				resp.StatusCode, test.expected)
+		}
+	}
+}
+
+func TestServerStartRun(t *testing.T) {
+	ts := testServer(t)
+	tests := []struct {
+		name, url, body string
+		expected        int
+	}{
+		{"uploaded", "/api/runs", quickConfig, http.StatusCreated},
+		{"referenced", "/api/runs?config=quick.json", "", http.StatusCreated},
+		{"missing config", "/api/runs", "", http.StatusBadRequest},
+		{"unknown config", "/api/runs?config=none.json", "",
+			http.StatusBadRequest},
+		{"escaping config", "/api/runs?config=../configs/quick.json", "",
+			http.StatusBadRequest},
+		{"invalid config", "/api/runs", "{", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		resp, body := apiRequest(t, ts, "POST", test.url, test.body)
+		if resp.StatusCode != test.expected {
+			t.Errorf("%q: got status %d (%s), expected %d", test.name,
+				resp.StatusCode, body, test.expected)
+		}
+	}
+}
+
+func TestServerObserveRun(t *testing.T) {
+	ts := testServer(t)
+	id := startTestRun(t, ts, quickConfig)
+	run := waitTestRun(t, ts, id)
+	if run.Status != runPassed || run.TestSet != "quick" ||
+		run.User != "alice" || run.Finished == nil {
+		t.Errorf("got run %+v", run)
+	}
+
+	_, body := apiRequest(t, ts, "GET", "/api/runs", "")
+	runs := make([]*serverRun, 0)
+	if err := json.Unmarshal([]byte(body), &runs); err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].ID != id {
+		t.Errorf("got runs %s", body)
+	}
+
+	resp, body := apiRequest(t, ts, "GET", "/api/runs/"+id+"/report", "")
+	tr := new(atf.TestReport)
+	if err := json.Unmarshal([]byte(body), tr); err != nil {
+		t.Fatalf("report: %s", err)
+	}
+	if ctype := resp.Header.Get("Content-Type"); ctype != "application/json" {
+		t.Errorf("report: got content type %q", ctype)
+	}
+	if tr.Initiator != "alice" || tr.InProgress ||
+		tr.TestSet.Cases[0].Status != "Pass" {
+		t.Errorf("report: got %s", body)
+	}
+	resp, body = apiRequest(t, ts, "GET", "/api/runs/"+id+"/report.html", "")
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") ||
+		!strings.Contains(body, "quick") {
+		t.Errorf("HTML report: got %q", body)
+	}
+
+	tests := []struct {
+		url      string
+		expected int
+	}{
+		{"/api/runs/99", http.StatusNotFound},
+		{"/api/runs/99/report", http.StatusNotFound},
+		{"/api/runs/" + id + "/cases/none.log", http.StatusNotFound},
+		{"/api/runs/" + id + "/cases/report.json", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		resp, _ = apiRequest(t, ts, "GET", test.url, "")
+		if resp.StatusCode != test.expected {
+			t.Errorf("%q: got status %d, expected %d", test.url,
+				resp.StatusCode, test.expected)
+		}
+	}
+}
+
+func TestServerCancelRun(t *testing.T) {
+	ts := testServer(t)
+	id := startTestRun(t, ts, slowConfig)
+	resp, body := apiRequest(t, ts, "DELETE", "/api/runs/"+id, "")
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("got status %d (%s), expected %d", resp.StatusCode, body,
+			http.StatusAccepted)
+	}
+	start := time.Now()
+	if run := waitTestRun(t, ts, id); run.Status != runAborted {
+		t.Errorf("got status %q, expected %q", run.Status, runAborted)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("cancelled run finished after %s", d)
+	}
+	// the report of the cancelled run is still written
+	_, body = apiRequest(t, ts, "GET", "/api/runs/"+id+"/report", "")
+	tr := new(atf.TestReport)
+	if err := json.Unmarshal([]byte(body), tr); err != nil || !tr.Aborted {
+		t.Errorf("report: got %s", body)
+	}
+
+	tests := []struct {
+		id       string
+		expected int
+	}{
+		{id, http.StatusConflict},
+		{"99", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		resp, _ = apiRequest(t, ts, "DELETE", "/api/runs/"+test.id, "")
+		if resp.StatusCode != test.expected {
+			t.Errorf("%q: got status %d, expected %d", test.id,
+				resp.StatusCode, test.expected)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * stream.go - live streaming of the run events over Server-Sent Events
+ *
+ * Every run started by the server records its execution events (as
+ * atf.EventRecords) into an event stream. The clients subscribe to the stream
+ * over SSE (GET /api/runs/{id}/events): first, the events recorded so far are
+ * replayed (from the 'Last-Event-ID' header or the 'from' query parameter, if
+ * given), then the new events are sent as they are published. The stream ends
+ * when the run is finished.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"bitbucket.org/miranr/goatf/atf"
+)
+
+/*
+ * eventStream - the recorded events of a single run
+ */
+type eventStream struct {
+	records []*atf.EventRecord
+	closed  bool
+
+	// closed (and replaced) whenever a new record is added or the stream is
+	// closed, so the waiting clients are woken up
+	notify chan struct{}
+	mutex  sync.Mutex
+}
+
+/*
+ * newEventStream - create a new, empty event stream
+ */
+func newEventStream() *eventStream {
+	return &eventStream{records: make([]*atf.EventRecord, 0),
+		notify: make(chan struct{})}
+}
+
+/*
+ * eventStream.HandleEvent - record the event; implements the atf.Subscriber
+ * interface
+ */
+func (s *eventStream) HandleEvent(e atf.Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records = append(s.records, atf.NewEventRecord(e))
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+/*
+ * eventStream.Close - close the stream: no more events will be recorded
+ */
+func (s *eventStream) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.notify)
+	}
+}
+
+/*
+ * eventStream.since - return the records starting with given index, whether
+ * the stream is closed and the channel to wait on for the new records
+ */
+func (s *eventStream) since(from int) ([]*atf.EventRecord, bool,
+	<-chan struct{}) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if from > len(s.records) {
+		from = len(s.records)
+	}
+	return s.records[from:], s.closed, s.notify
+}
+
+/*
+ * eventStream.serve - stream the events to the SSE client; the event IDs are
+ * the indices of the records, so the client can resume the stream
+ */
+func (s *eventStream) serve(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	from := 0
+	if id, err := strconv.Atoi(req.Header.Get("Last-Event-ID")); err == nil {
+		from = id + 1
+	} else if n, err := strconv.Atoi(req.URL.Query().Get("from")); err == nil {
+		from = n
+	}
+	if from < 0 {
+		from = 0
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		records, closed, notify := s.since(from)
+		for _, rec := range records {
+			b, err := json.Marshal(rec)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", from, rec.Kind, b)
+			from++
+		}
+		flusher.Flush()
+		if closed {
+			return
+		}
+		select {
+		case <-notify:
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
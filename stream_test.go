@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"bitbucket.org/miranr/goatf/atf"
+)
+
+// A single event received over SSE.
+type sseEvent struct {
+	id, kind string
+	rec      *atf.EventRecord
+}
+
+// Reads the SSE events until the end of the stream.
+func readEvents(t *testing.T, r io.Reader) []*sseEvent {
+	events := make([]*sseEvent, 0)
+	e := new(sseEvent)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		field, value, _ := strings.Cut(scanner.Text(), ": ")
+		switch field {
+		case "id":
+			e.id = value
+		case "event":
+			e.kind = value
+		case "data":
+			e.rec = new(atf.EventRecord)
+			if err := json.Unmarshal([]byte(value), e.rec); err != nil {
+				t.Fatal(err)
+			}
+		case "":
+			events = append(events, e)
+			e = new(sseEvent)
+		}
+	}
+	return events
+}
+
+// Creates the stream with the events of a test set with a single case.
+func testEventStream() *eventStream {
+	ts := &atf.TestSet{Name: "set"}
+	tc := &atf.TestCase{Name: "a"}
+	s := newEventStream()
+	s.HandleEvent(&atf.SetStarted{Set: ts})
+	s.HandleEvent(&atf.CaseStarted{Case: tc})
+	s.HandleEvent(&atf.ActionOutput{Case: tc, Role: "setup", Line: "ready"})
+	return s
+}
+
+func TestEventStreamReplay(t *testing.T) {
+	s := testEventStream()
+	s.Close()
+	tests := []struct {
+		name, url, lastId string
+		expected          string // the IDs of the events
+	}{
+		{"all", "/", "", "0 1 2"},
+		{"last event ID", "/", "0", "1 2"},
+		{"from", "/?from=2", "", "2"},
+		{"last event ID wins", "/?from=2", "0", "1 2"},
+		{"beyond the end", "/?from=9", "", ""},
+		{"negative", "/?from=-1", "", "0 1 2"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.url, nil)
+		if test.lastId != "" {
+			req.Header.Set("Last-Event-ID", test.lastId)
+		}
+		w := httptest.NewRecorder()
+		s.serve(w, req)
+		if ctype := w.Header().Get("Content-Type"); ctype !=
+			"text/event-stream" {
+			t.Errorf("%q: got content type %q", test.name, ctype)
+		}
+		ids := make([]string, 0)
+		for _, e := range readEvents(t, w.Body) {
+			ids = append(ids, e.id)
+		}
+		if got := strings.Join(ids, " "); got != test.expected {
+			t.Errorf("%q: got events %q, expected %q", test.name, got,
+				test.expected)
+		}
+	}
+
+	events := readEvents(t, func() io.Reader {
+		w := httptest.NewRecorder()
+		s.serve(w, httptest.NewRequest("GET", "/?from=2", nil))
+		return w.Body
+	}())
+	if len(events) != 1 || events[0].kind != "ActionOutput" ||
+		events[0].rec.Case != "a" || events[0].rec.Line != "ready" {
+		t.Errorf("got %+v", events)
+	}
+}
+
+// The subscribers receive the new events as they are recorded, and the
+// stream ends when it is closed.
+func TestEventStreamLive(t *testing.T) {
+	s := testEventStream()
+	ts := httptest.NewServer(http.HandlerFunc(s.serve))
+	defer ts.Close()
+	resp, err := ts.Client().Get(ts.URL + "/?from=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	received := make(chan []*sseEvent, 1)
+	go func() { received <- readEvents(t, resp.Body) }()
+	// let the client wait for the new events after the replay
+	time.Sleep(100 * time.Millisecond)
+	tc := &atf.TestCase{Name: "a"}
+	s.HandleEvent(&atf.CaseFinished{Case: tc, Result: "Pass"})
+	s.Close()
+	select {
+	case events := <-received:
+		kinds := make([]string, 0)
+		for _, e := range events {
+			kinds = append(kinds, e.kind)
+		}
+		expected := "CaseStarted ActionOutput CaseFinished"
+		if got := strings.Join(kinds, " "); got != expected {
+			t.Errorf("got events %q, expected %q", got, expected)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("the stream has not ended")
+	}
+}
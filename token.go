@@ -0,0 +1,167 @@
+/*
+ * token.go - the 'token' subcommand: manage the API tokens of the users
+ *
+ * Usage: goatf token create [-users file] [-tokens file] [-role r]
+ *                           [-expires duration] [-descr text] username
+ *        goatf token list [-tokens file] [-user username] [-f text|json]
+ *        goatf token revoke [-tokens file] id
+ *
+ * The created token is displayed only once; only its hash is stored.
+ */
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+	"bitbucket.org/miranr/goatf/atf"
+)
+
+// The default file with the API tokens.
+const defaultTokensFile = "tokens.json"
+
+/*
+ * tokenCmd - dispatch the 'token' subcommands
+ */
+func tokenCmd(args []string) int {
+	usage := func() {
+		fmt.Fprintln(os.Stderr,
+			"Usage: goatf token create|list|revoke [options] [username|id]")
+	}
+	if len(args) < 1 {
+		usage()
+		return 1
+	}
+	fs := flag.NewFlagSet("token "+args[0], flag.ExitOnError)
+	tokens := fs.String("tokens", defaultTokensFile,
+		"JSON file with the API tokens")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: goatf token %s [options]", args[0])
+		switch args[0] {
+		case "create":
+			fmt.Fprint(os.Stderr, " username")
+		case "revoke":
+			fmt.Fprint(os.Stderr, " id")
+		}
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+
+	var err error
+	switch args[0] {
+	case "create":
+		users := fs.String("users", defaultUsersFile,
+			"JSON file with the users")
+		role := fs.String("role", "",
+			"role the token is scoped to (default: user's role)")
+		expires := fs.Duration("expires", 0,
+			"token lifetime, e.g. 720h (default: never expires)")
+		descr := fs.String("descr", "", "token description")
+		username := parseOneArg(fs, args[1:])
+		err = createToken(atf.OpenFileUserStore(*users),
+			atf.OpenFileTokenStore(*tokens), username, *role, *expires,
+			*descr)
+	case "list":
+		user := fs.String("user", "", "list only the tokens of the user")
+		format := fs.String("f", "text", "output format: text or json")
+		fs.Parse(args[1:])
+		err = listTokens(atf.OpenFileTokenStore(*tokens), *user, *format)
+	case "revoke":
+		err = revokeToken(atf.OpenFileTokenStore(*tokens),
+			parseOneArg(fs, args[1:]))
+	default:
+		usage()
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+/*
+ * createToken - create a new token for the user and display it
+ */
+func createToken(users atf.UserStore, tokens atf.TokenStore, username,
+	role string, ttl time.Duration, descr string) error {
+
+	u, err := users.Get(username)
+	if err != nil {
+		return err
+	}
+	t, token, err := atf.NewApiToken(u, role, ttl, descr)
+	if err != nil {
+		return err
+	}
+	if err = tokens.Add(t); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Token %s created for %s (role %s)\n", t.ID,
+		t.Username, t.Role)
+	fmt.Println(token)
+	return nil
+}
+
+/*
+ * listTokens - display the tokens (of the user, if given)
+ */
+func listTokens(s atf.TokenStore, username, format string) error {
+	tokens, err := s.List()
+	if err != nil {
+		return err
+	}
+	result := make([]*atf.ApiToken, 0, len(tokens))
+	for _, t := range tokens {
+		if username == "" || t.Username == username {
+			t.Hash = ""
+			result = append(result, t)
+		}
+	}
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case "text":
+		now := time.Now()
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUSER\tROLE\tCREATED\tEXPIRES\tSTATUS\tDESCRIPTION")
+		for _, t := range result {
+			expires, status := "never", "valid"
+			if t.Expires != nil {
+				expires = t.Expires.Format(time.RFC3339)
+			}
+			switch {
+			case t.Revoked != nil:
+				status = "revoked"
+			case !t.Valid(now):
+				status = "expired"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Username,
+				t.Role, t.Created.Format(time.RFC3339), expires, status,
+				t.Descr)
+		}
+		w.Flush()
+	default:
+		return fmt.Errorf("Unknown output format %q", format)
+	}
+	return nil
+}
+
+/*
+ * revokeToken - revoke the token with given ID
+ */
+func revokeToken(s atf.TokenStore, id string) error {
+	t, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	t.Revoke()
+	return s.Update(t)
+}
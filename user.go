@@ -0,0 +1,183 @@
+/*
+ * user.go - the 'user' subcommand: manage the users of the GoATF server
+ *
+ * Usage: goatf user add [-users file] [-role r] [-name n] [-email e] username
+ *        goatf user list [-users file] [-f text|json]
+ *        goatf user passwd [-users file] [-role r] username
+ *        goatf user delete [-users file] username
+ *
+ * The passwords are read from STDIN (one per line), so they can be piped;
+ * when STDIN is a terminal, the user is prompted.
+ */
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"bitbucket.org/miranr/goatf/atf"
+)
+
+// The default file with the users.
+const defaultUsersFile = "users.json"
+
+/*
+ * userCmd - dispatch the 'user' subcommands
+ */
+func userCmd(args []string) int {
+	usage := func() {
+		fmt.Fprintln(os.Stderr,
+			"Usage: goatf user add|list|passwd|delete [options] [username]")
+	}
+	if len(args) < 1 {
+		usage()
+		return 1
+	}
+	fs := flag.NewFlagSet("user "+args[0], flag.ExitOnError)
+	users := fs.String("users", defaultUsersFile, "JSON file with the users")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: goatf user %s [options]", args[0])
+		if args[0] != "list" {
+			fmt.Fprint(os.Stderr, " username")
+		}
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+
+	var err error
+	switch args[0] {
+	case "add":
+		role := fs.String("role", "user", "user role: admin, user or guest")
+		name := fs.String("name", "", "full name")
+		email := fs.String("email", "", "e-mail address")
+		username := parseOneArg(fs, args[1:])
+		err = addUser(atf.OpenFileUserStore(*users), username, *role, *name,
+			*email)
+	case "list":
+		format := fs.String("f", "text", "output format: text or json")
+		fs.Parse(args[1:])
+		err = listUsers(atf.OpenFileUserStore(*users), *format)
+	case "passwd":
+		role := fs.String("role", "", "change the user role, too")
+		username := parseOneArg(fs, args[1:])
+		err = changeUser(atf.OpenFileUserStore(*users), username, *role)
+	case "delete":
+		username := parseOneArg(fs, args[1:])
+		err = atf.OpenFileUserStore(*users).Delete(username)
+	default:
+		usage()
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+/*
+ * parseOneArg - parse the flags and return the (mandatory) single argument,
+ * e.g. the username
+ */
+func parseOneArg(fs *flag.FlagSet, args []string) string {
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	return fs.Arg(0)
+}
+
+// reads the passwords from STDIN
+var stdin = bufio.NewReader(os.Stdin)
+
+/*
+ * readPassword - read the password from STDIN, prompting when STDIN is a
+ * terminal
+ */
+func readPassword(prompt string) (string, error) {
+	if isTerminal(os.Stdin) {
+		fmt.Fprint(os.Stderr, prompt)
+	}
+	// the last line may not be terminated, so only an empty line is an error
+	line, _ := stdin.ReadString('\n')
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("Empty password")
+	}
+	return line, nil
+}
+
+/*
+ * addUser - add a new user into the store
+ */
+func addUser(s atf.UserStore, username, role, name, email string) error {
+	password, err := readPassword("Password: ")
+	if err != nil {
+		return err
+	}
+	u, err := atf.CreateNewUser(username, password, role)
+	if err != nil {
+		return err
+	}
+	u.Name, u.Email = name, email
+	return s.Add(u)
+}
+
+/*
+ * changeUser - set the new password (and role, if given) of the user
+ */
+func changeUser(s atf.UserStore, username, role string) error {
+	u, err := s.Get(username)
+	if err != nil {
+		return err
+	}
+	password, err := readPassword("New password: ")
+	if err != nil {
+		return err
+	}
+	u.SetPassword(password)
+	if role != "" {
+		if err = u.SetRole(role); err != nil {
+			return err
+		}
+	}
+	return s.Update(u)
+}
+
+/*
+ * listUsers - display the users in the store; the password hashes are never
+ * displayed
+ */
+func listUsers(s atf.UserStore, format string) error {
+	users, err := s.List()
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		u.Password = ""
+	}
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(users, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case "text":
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "USERNAME\tROLE\tNAME\tE-MAIL")
+		for _, u := range users {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", u.Username, u.Role, u.Name,
+				u.Email)
+		}
+		w.Flush()
+	default:
+		return fmt.Errorf("Unknown output format %q", format)
+	}
+	return nil
+}
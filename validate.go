@@ -0,0 +1,52 @@
+/*
+ * validate.go - the 'validate' subcommand: check the test set configs
+ * without executing them
+ *
+ * Usage: goatf validate [-q] config...
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"bitbucket.org/miranr/goatf/atf"
+)
+
+/*
+ * validateCmd - load and validate the test set configs; the exit status is
+ * non-zero when any of them is invalid
+ */
+func validateCmd(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	quiet := fs.Bool("q", false, "display only the problems")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: goatf validate [options] config...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 1
+	}
+
+	status := 0
+	for _, name := range fs.Args() {
+		ts, err := atf.LoadTestSet(name)
+		if err != nil {
+			fmt.Printf("%s: %s\n", name, err)
+			status = 1
+			continue
+		}
+		problems := ts.Validate()
+		for _, p := range problems {
+			fmt.Printf("%s: %s\n", name, p)
+		}
+		if len(problems) > 0 {
+			status = 1
+		} else if !*quiet {
+			fmt.Printf("%s: OK, %d test cases\n", name, len(ts.Cases))
+		}
+	}
+	return status
+}
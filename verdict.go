@@ -0,0 +1,94 @@
+/*
+ * verdict.go - the 'verdict' subcommand: sign off the manual test steps
+ *
+ * Usage: goatf verdict [-users file] [-root dir] -user username -case name
+ *                      -step name -result Pass|Fail [-comment text]
+ *                      report.json
+ *
+ * The tester is authenticated (the password is read from STDIN), the verdict
+ * is recorded into the report, the reports in the report's directory are
+ * created again and the sign-off is recorded into the audit log.
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"bitbucket.org/miranr/goatf/atf"
+	"bitbucket.org/miranr/goatf/atf/utils"
+)
+
+/*
+ * verdictCmd - record the verdict of the manual step into the report
+ */
+func verdictCmd(args []string) int {
+	fs := flag.NewFlagSet("verdict", flag.ExitOnError)
+	users := fs.String("users", defaultUsersFile, "JSON file with the users")
+	root := fs.String("root", defaultRootDir(),
+		"root of the working dirs with the audit log")
+	username := fs.String("user", osUsername(), "the tester")
+	tc := fs.String("case", "", "test case name (mandatory)")
+	step := fs.String("step", "", "test step name (mandatory)")
+	result := fs.String("result", "", "step result: Pass or Fail (mandatory)")
+	comment := fs.String("comment", "", "comment of the tester")
+	cssfile := fs.String("c", "cfg/report_def.css",
+		"custom CSS file for HTML report")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: goatf verdict [options] report.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *tc == "" || *step == "" || *result == "" {
+		fs.Usage()
+		return 1
+	}
+
+	password, err := readPassword(fmt.Sprintf("Password for %s: ", *username))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	tester, err := atf.Authenticate(atf.OpenFileUserStore(*users), *username,
+		password)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	tr, err := atf.LoadTestReport(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot load report %q: %s\n", fs.Arg(0), err)
+		return 1
+	}
+	err = tr.SetVerdict(*tc, *step, tester, atf.TestResult(*result), *comment)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot record verdict of step %q in %q: %s\n",
+			*step, *tc, err)
+		return 1
+	}
+
+	// we reuse the runner to create the reports that exist in the directory
+	r := NewRunner()
+	r.tr = tr
+	r.workdir = filepath.ToSlash(filepath.Dir(fs.Arg(0)))
+	r.rootdir = *root
+	r.cssfile = *cssfile
+	r.xml = utils.FileExists(path.Join(r.workdir, "report.xml"))
+	r.json = true
+	r.text = utils.FileExists(path.Join(r.workdir, "report.txt"))
+	r.initiator = tester.Username
+	r.auditAction = atf.AuditVerdict
+	r.auditDetails = map[string]string{"Case": *tc, "Step": *step,
+		"Result": *result, "Comment": *comment}
+	if err = r.createConsoleLog(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer r.logger.Close()
+	r.logger.Notice(fmt.Sprintf("Step %q of case %q signed off by %s: %s\n",
+		*step, *tc, tester.Username, *result))
+	r.CreateReports()
+	return 0
+}
@@ -0,0 +1,216 @@
+// app.js - the GoATF dashboard: a single page application using the
+// dashboard API served by 'goatf serve' (see dashboard.go)
+"use strict";
+
+var main = document.getElementById("main");
+
+// escape the text for HTML
+function esc(s) {
+    return String(s === undefined || s === null ? "" : s)
+        .replace(/&/g, "&amp;").replace(/</g, "&lt;")
+        .replace(/>/g, "&gt;").replace(/"/g, "&quot;");
+}
+
+// CSS class for the status/result
+function cls(s) {
+    return String(s || "").toLowerCase().replace(/\s+/g, "");
+}
+
+// format the duration given in nanoseconds
+function dur(ns) {
+    if (!ns) { return "0s"; }
+    if (ns < 1e6) { return (ns / 1e3).toFixed(0) + "µs"; }
+    if (ns < 1e9) { return (ns / 1e6).toFixed(0) + "ms"; }
+    return (ns / 1e9).toFixed(2) + "s";
+}
+
+// format the timestamp
+function ts(t) {
+    return t && t.indexOf("0001-") !== 0 ? new Date(t).toLocaleString() : "";
+}
+
+// the header tells the server not to ask for basic authentication, so the
+// login form is displayed instead
+function getJson(url) {
+    return fetch(url, {headers: {"X-Requested-With": "goatf"}})
+        .then(function (resp) {
+            if (resp.status === 401) { throw new LoginRequired(); }
+            if (!resp.ok) {
+                throw new Error(resp.status + " " + resp.statusText);
+            }
+            return resp.json();
+        });
+}
+
+function LoginRequired() {
+    this.message = "login required";
+}
+
+function fail(err) {
+    if (err instanceof LoginRequired) {
+        showLogin();
+        return;
+    }
+    main.innerHTML = "<p class=\"failed\">Error: " + esc(err.message) + "</p>";
+}
+
+// the login form; the session cookie is set by the server
+function showLogin(msg) {
+    var h = "<form class=\"login\" id=\"login\">";
+    if (msg) { h += "<p class=\"failed\">" + esc(msg) + "</p>"; }
+    h += "<label>Username <input name=\"username\" autofocus></label>";
+    h += "<label>Password <input name=\"password\" type=\"password\">" +
+        "</label><button>Log in</button></form>";
+    main.innerHTML = h;
+    document.getElementById("login").addEventListener("submit", function (e) {
+        e.preventDefault();
+        fetch("api/login", {method: "POST", body: new FormData(e.target)})
+            .then(function (resp) {
+                if (resp.ok) { route(); } else { showLogin("Login failed"); }
+            });
+    });
+}
+
+function logout() {
+    fetch("api/logout", {method: "POST"}).then(function () { showLogin(); });
+}
+
+// the list of runs, with filters
+function showRuns(params) {
+    var q = new URLSearchParams(params);
+    getJson("api/reports?" + q.toString()).then(function (runs) {
+        var h = "<form class=\"filters\" id=\"filters\">";
+        h += "Test set <input name=\"set\" value=\"" + esc(q.get("set")) + "\">";
+        h += "SUT <input name=\"sut\" value=\"" + esc(q.get("sut")) + "\">";
+        h += "Version <input name=\"version\" value=\"" +
+            esc(q.get("version")) + "\">";
+        h += "Status <select name=\"status\">";
+        ["", "passed", "failed", "aborted", "in progress"].forEach(function (s) {
+            h += "<option" + (q.get("status") === s ? " selected" : "") + ">" +
+                esc(s) + "</option>";
+        });
+        h += "</select><button>Filter</button></form>";
+        h += "<table><tr><th>Started</th><th>Test set</th><th>SUT</th>" +
+            "<th>Version</th><th>Status</th><th>Passed</th><th>Failed</th>" +
+            "<th>Not tested</th></tr>";
+        runs.forEach(function (r) {
+            h += "<tr><td><a href=\"#/run/" + encodeURI(r.Dir) + "\">" +
+                esc(ts(r.Started)) + "</a></td><td>" + esc(r.TestSet) +
+                "</td><td>" + esc(r.SutName) + "</td><td>" +
+                esc(r.SutVersion) + "</td><td class=\"" + cls(r.Status) +
+                "\">" + esc(r.Status) + "</td><td>" + r.Passed + "</td><td>" +
+                r.Failed + "</td><td>" + r.NotTested + "</td></tr>";
+        });
+        h += "</table>";
+        if (runs.length === 0) { h += "<p>No runs found.</p>"; }
+        main.innerHTML = h;
+        document.getElementById("filters").onsubmit = function (e) {
+            e.preventDefault();
+            var f = new URLSearchParams(new FormData(e.target));
+            Array.from(f.keys()).forEach(function (k) {
+                if (!f.get(k)) { f.delete(k); }
+            });
+            location.hash = "#/?" + f.toString();
+        };
+    }).catch(fail);
+}
+
+// a single action with its output
+function actionHtml(role, a) {
+    if (!a || a.Script === "No action") { return ""; }
+    var h = "<tr><td>" + esc(role) + "</td><td>" + esc(a.Script) + " " +
+        esc(a.Args) + "</td><td class=\"" + cls(a.Result) + "\">" +
+        esc(a.Result) + "</td><td>" + dur(a.Duration) + "</td></tr>";
+    if (a.Output) {
+        h += "<tr><td colspan=\"4\"><pre class=\"output\">" + esc(a.Output) +
+            "</pre></td></tr>";
+    }
+    return h;
+}
+
+// the drill-down of a single run
+function showRun(dir) {
+    getJson("api/reports/" + encodeURI(dir)).then(function (tr) {
+        var set = tr.TestSet;
+        var h = "<h2>Test set: " + esc(set.Name) + "</h2>";
+        h += "<p>Started: " + esc(ts(tr.Started)) + "<br>Finished: " +
+            (tr.InProgress ? "in progress" : esc(ts(tr.Finished))) +
+            (tr.Aborted ? " <span class=\"aborted\">aborted</span>" : "") +
+            "</p>";
+        if (set.Sut) {
+            h += "<p>SUT: " + esc(set.Sut.Name) + " " + esc(set.Sut.Version) +
+                "</p>";
+        }
+        h += "<table>" + actionHtml("Setup", set.Setup) +
+            actionHtml("Cleanup", set.Cleanup) + "</table>";
+        (set.Cases || []).forEach(function (tc) {
+            h += "<h3>Test case: " + esc(tc.Name) +
+                " <span class=\"" + cls(tc.Status) + "\">" + esc(tc.Status) +
+                "</span> " + dur(tc.Duration) +
+                " <a href=\"#/history/" + encodeURIComponent(set.Name) + "/" +
+                encodeURIComponent(tc.Name) + "\">history</a></h3>";
+            if (tc.Warning) { h += "<p>Warning: " + esc(tc.Warning) + "</p>"; }
+            h += "<table><tr><th>Step</th><th>Action</th><th>Result</th>" +
+                "<th>Duration</th></tr>";
+            h += actionHtml("Setup", tc.Setup);
+            (tc.Steps || []).forEach(function (step) {
+                h += actionHtml(step.Name, step.Action);
+            });
+            h += actionHtml("Cleanup", tc.Cleanup);
+            h += "</table>";
+        });
+        main.innerHTML = h;
+    }).catch(fail);
+}
+
+// the history chart of a single test case: a bar per run, the height is the
+// duration and the colour is the status
+function showHistory(set, tcase) {
+    var q = new URLSearchParams({set: set, case: tcase});
+    getJson("api/history?" + q.toString()).then(function (records) {
+        var h = "<h2>History: " + esc(set) + " / " + esc(tcase) + "</h2>";
+        if (records.length === 0) {
+            main.innerHTML = h + "<p>No history.</p>";
+            return;
+        }
+        var max = 1, passed = 0;
+        records.forEach(function (r) {
+            max = Math.max(max, r.Cases[0].Duration || 0);
+            if (r.Cases[0].Status === "Pass") { passed++; }
+        });
+        h += "<p>Runs: " + records.length + ", pass rate: " +
+            (100 * passed / records.length).toFixed(1) + "%, max duration: " +
+            dur(max) + "</p>";
+        var bw = 16, height = 150, width = records.length * (bw + 4) + 10;
+        h += "<svg width=\"" + width + "\" height=\"" + (height + 20) + "\">";
+        records.forEach(function (r, i) {
+            var c = r.Cases[0];
+            var bh = Math.max(2, height * (c.Duration || 0) / max);
+            h += "<rect class=\"bar " + cls(c.Status) + "\" x=\"" +
+                (5 + i * (bw + 4)) + "\" y=\"" + (height - bh) + "\" width=\"" +
+                bw + "\" height=\"" + bh + "\"><title>" + esc(ts(r.Started)) +
+                " " + esc(r.SutVersion) + ": " + esc(c.Status) + " " +
+                dur(c.Duration) + "</title></rect>";
+        });
+        h += "<text x=\"5\" y=\"" + (height + 15) + "\">oldest</text>";
+        h += "<text x=\"" + (width - 40) + "\" y=\"" + (height + 15) +
+            "\">newest</text></svg>";
+        main.innerHTML = h;
+    }).catch(fail);
+}
+
+// hash based routing: #/?filters, #/run/<dir>, #/history/<set>/<case>
+function route() {
+    var hash = location.hash.replace(/^#/, "") || "/";
+    var m;
+    if ((m = hash.match(/^\/run\/(.+)$/))) {
+        showRun(decodeURI(m[1]));
+    } else if ((m = hash.match(/^\/history\/([^\/]+)\/(.+)$/))) {
+        showHistory(decodeURIComponent(m[1]), decodeURIComponent(m[2]));
+    } else {
+        showRuns(hash.indexOf("?") >= 0 ? hash.slice(hash.indexOf("?") + 1) : "");
+    }
+}
+
+window.addEventListener("hashchange", route);
+route();